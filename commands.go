@@ -0,0 +1,464 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"true_accord/shared/config"
+	"true_accord/shared/fees"
+	"true_accord/shared/forecast"
+	"true_accord/shared/output"
+	"true_accord/shared/reconciliation"
+	trueaccordapiconnector "true_accord/shared/trueaccordapi"
+	"true_accord/shared/validation"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const programName = "true_accord"
+
+// Exit codes
+const (
+	exitOK = 0
+	// exitFailure ... the API or output failed, or some debts could not be processed
+	exitFailure = 1
+	// exitUsage ... the command line, arguments or configuration are invalid
+	exitUsage = 2
+	// exitFindings ... validate found error findings
+	exitFindings = 3
+	// exitNotFound ... the requested debt or payment plan doesn't exist
+	exitNotFound = 4
+)
+
+// stdout ... is where commands write their output; replaced in tests
+var stdout io.Writer = os.Stdout
+
+// command ... is a CLI subcommand. run returns the exit code.
+type command struct {
+	name        string
+	arguments   string
+	description string
+	run         func(ctx context.Context, args []string) int
+}
+
+var commands = []command{
+	{name: "enrich", description: "Enrich every debt with its payment plan, next payment date and delinquency (default)", run: runEnrich},
+	{name: "debt", arguments: "<debt-id>", description: "Show a single debt with its payment plan, payments and installments", run: runDebt},
+	{name: "schedule", arguments: "<payment-plan-id>", description: "Show the installment schedule of a payment plan and the payments applied to it", run: runSchedule},
+	{name: "summary", description: "Show portfolio totals over the enriched debts", run: runSummary},
+	{name: "forecast", description: "Project the collections expected per week or month over the forecast horizon", run: runForecast},
+	{name: "validate", description: "Check debts, payment plans and payments for data-quality problems", run: runValidate},
+	{name: "schema", description: "Show the JSON Schema of the enrich output (output version 2)", run: runSchema},
+}
+
+func findCommand(name string) *command {
+	for i := range commands {
+		if commands[i].name == name {
+			return &commands[i]
+		}
+	}
+	return nil
+}
+
+// printUsage ... writes the CLI help to w
+func printUsage(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s [command] [arguments] [flags]\n\nCommands:\n", programName)
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-30s %s\n", cmd.name+" "+cmd.arguments, cmd.description)
+	}
+
+	fmt.Fprintf(w, "\nExit codes: %d success, %d failure, %d invalid usage or configuration, %d validation errors found, %d not found\n",
+		exitOK, exitFailure, exitUsage, exitFindings, exitNotFound)
+	fmt.Fprintf(w, "\nFlags (accepted by every command):\n")
+	config.PrintDefaults(w)
+}
+
+// printCommandUsage ... writes the help of a single command to w
+func printCommandUsage(w io.Writer, cmd *command) {
+	fmt.Fprintf(w, "Usage: %s %s %s [flags]\n\n%s\n\nFlags:\n", programName, cmd.name, cmd.arguments, cmd.description)
+	config.PrintDefaults(w)
+}
+
+// usageError ... logs an invalid command line and returns exitUsage
+func usageError(format string, args ...interface{}) int {
+	log.WithFields(log.Fields{
+		"Message": fmt.Sprintf(format, args...),
+	}).Error()
+	return exitUsage
+}
+
+// failure ... logs a failed command and returns exitFailure
+func failure(err error, message string) int {
+	log.WithFields(log.Fields{
+		"Message": message,
+		"Error":   err,
+	}).Error()
+	return exitFailure
+}
+
+// writeDocument ... writes a single result in the configured output format
+func writeDocument(v interface{}) error {
+	return output.WriteDocument(stdout, appConfig.Format, v)
+}
+
+// writeList ... writes each of n results returned by record in the configured output format
+func writeList(n int, record func(i int) interface{}) error {
+	writer, err := output.NewWriter(stdout, appConfig.Format)
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < n; i++ {
+		if err = writer.Write(record(i)); err != nil {
+			return err
+		}
+	}
+
+	return writer.Close()
+}
+
+// parseIDArgument ... returns the single ID argument of a command
+func parseIDArgument(cmd string, args []string) (id int64, code int) {
+	if len(args) != 1 {
+		return 0, usageError("%s expects exactly one ID argument, got %d", cmd, len(args))
+	}
+
+	id, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		return 0, usageError("Invalid %s ID %q, expected an integer", cmd, args[0])
+	}
+
+	return id, exitOK
+}
+
+// filterDebts ... returns the debts selected by the debt_ids filter
+func filterDebts(debts []trueaccordapiconnector.Debt) []trueaccordapiconnector.Debt {
+	if len(appConfig.DebtIDs) == 0 {
+		return debts
+	}
+
+	selected := make(map[int64]bool)
+	for _, debtID := range appConfig.DebtIDs {
+		selected[debtID] = true
+	}
+
+	var filtered []trueaccordapiconnector.Debt
+	for _, debt := range debts {
+		if selected[debt.ID] {
+			filtered = append(filtered, debt)
+		}
+	}
+	return filtered
+}
+
+// keepStatus ... returns whether an enriched debt passes the status filter
+func keepStatus(res EnrichedDebt) bool {
+	if len(appConfig.Statuses) == 0 {
+		return true
+	}
+
+	for _, status := range appConfig.Statuses {
+		if res.Status == status {
+			return true
+		}
+	}
+	return false
+}
+
+// forEachEnrichedDebt ... fetches and enriches the selected debts and passes those passing the filters to handle in
+// debt ID order. Returns exitFailure if the run failed or any debt could not be enriched, including debts reported
+// as FAILED because their payment plan couldn't be scheduled or reconciled.
+func forEachEnrichedDebt(ctx context.Context, handle func(EnrichedDebt)) int {
+	if appConfig.Bulk {
+		indexedConnector, err := trueaccordapiconnector.NewIndexedConnector(ctx, trueAccordAPIConnector)
+		if err != nil {
+			err.LogError()
+			return exitFailure
+		}
+		trueAccordAPIConnector = indexedConnector
+	}
+
+	debts, err := trueAccordAPIConnector.GetDebts(ctx)
+	if err != nil {
+		err.LogError()
+		return exitFailure
+	}
+	debts = filterDebts(debts)
+
+	progress := func(done, total int) {}
+	if appConfig.Progress {
+		progress = logProgress
+	}
+
+	enriched := 0
+	pipelineErr := enrichDebts(ctx, debts, appConfig.Concurrency, progress, func(res EnrichedDebt) {
+		if res.Status != reconciliation.StatusFailed {
+			enriched++
+		}
+		if keepStatus(res) {
+			handle(res)
+		}
+	})
+	if pipelineErr != nil {
+		return failure(pipelineErr, "Enrichment stopped before all debts were processed")
+	}
+
+	if enriched < len(debts) {
+		log.WithFields(log.Fields{
+			"Message": fmt.Sprintf("%d of %d debts could not be enriched", len(debts)-enriched, len(debts)),
+		}).Error()
+		return exitFailure
+	}
+
+	return exitOK
+}
+
+// runEnrich ... writes every enriched debt in the configured output format as it is enriched
+func runEnrich(ctx context.Context, args []string) int {
+	if len(args) != 0 {
+		return usageError("enrich takes no arguments, got %q", args)
+	}
+
+	writer, err := output.NewWriter(stdout, appConfig.Format)
+	if err != nil {
+		return failure(err, "Failed to create the output writer")
+	}
+
+	var writeErr error
+	code := forEachEnrichedDebt(ctx, func(res EnrichedDebt) {
+		if writeErr == nil {
+			writeErr = writer.Write(presentEnrichedDebt(res))
+		}
+	})
+
+	if writeErr == nil {
+		writeErr = writer.Close()
+	}
+	if writeErr != nil {
+		return failure(writeErr, "Failed to write enriched debts")
+	}
+
+	return code
+}
+
+// DebtDetail ... is a single enriched debt with its active payment plan, payments and installments
+type DebtDetail struct {
+	EnrichedDebt
+
+	PaymentPlan  *trueaccordapiconnector.PaymentPlan `json:"payment_plan"`
+	Payments     []trueaccordapiconnector.Payment    `json:"payments"`
+	Installments []reconciliation.InstallmentStatus  `json:"installments"`
+	// PaymentPlanHistory is every payment plan of the debt, oldest first, with the payments attributed to each
+	PaymentPlanHistory []reconciliation.PlanPayments `json:"payment_plan_history"`
+	// Fees is the late fees charged on the installments of the active plan, including waived fees
+	Fees []fees.Fee `json:"fees"`
+}
+
+// runDebt ... writes the detail of a single debt
+func runDebt(ctx context.Context, args []string) int {
+	debtID, code := parseIDArgument("debt", args)
+	if code != exitOK {
+		return code
+	}
+
+	debt, err := trueAccordAPIConnector.GetDebtByID(ctx, debtID)
+	if err != nil {
+		err.LogError()
+		return exitFailure
+	}
+	if debt == nil {
+		return notFound(fmt.Sprintf("Debt %d not found", debtID))
+	}
+
+	history, err := fetchPaymentPlanHistory(ctx, *debt)
+	if err != nil {
+		err.LogError()
+		return exitFailure
+	}
+
+	detail := DebtDetail{
+		EnrichedDebt:       enrichPaymentPlans(*debt, history),
+		Payments:           []trueaccordapiconnector.Payment{},
+		Installments:       []reconciliation.InstallmentStatus{},
+		PaymentPlanHistory: history,
+		Fees:               []fees.Fee{},
+	}
+	if detail.feeAssessment.Fees != nil {
+		detail.Fees = detail.feeAssessment.Fees
+	}
+
+	if active := reconciliation.Active(history); active != nil {
+		detail.PaymentPlan = &active.PaymentPlan
+		detail.Payments = append(detail.Payments, active.Payments...)
+
+		res, reconcileErr := reconcilePlan(&active.PaymentPlan, active.Payments, location(*debt, &active.PaymentPlan))
+		if reconcileErr != nil {
+			return failure(reconcileErr, fmt.Sprintf("Failed to reconcile payments for debtID: %d", debtID))
+		}
+		detail.Installments = res.Installments
+	}
+
+	if printErr := writeDocument(presentDebtDetail(detail)); printErr != nil {
+		return failure(printErr, fmt.Sprintf("Failed to write debtID: %d", debtID))
+	}
+	return exitOK
+}
+
+// runSchedule ... writes the installments of a payment plan with the payments applied to them.
+// Dates are in the plan's time_zone, or the configured default since the debt isn't fetched.
+func runSchedule(ctx context.Context, args []string) int {
+	paymentPlanID, code := parseIDArgument("schedule", args)
+	if code != exitOK {
+		return code
+	}
+
+	paymentPlan, err := trueAccordAPIConnector.GetPaymentPlanByID(ctx, paymentPlanID)
+	if err != nil {
+		err.LogError()
+		return exitFailure
+	}
+	if paymentPlan == nil {
+		return notFound(fmt.Sprintf("Payment plan %d not found", paymentPlanID))
+	}
+
+	// Apply the payments attributed to the plan across the debt's plan history
+	debt := trueaccordapiconnector.Debt{ID: paymentPlan.DebtID}
+	history, err := fetchPaymentPlanHistory(ctx, debt)
+	if err != nil {
+		err.LogError()
+		return exitFailure
+	}
+
+	var payments []trueaccordapiconnector.Payment
+	for _, plan := range history {
+		if plan.PaymentPlan.ID == paymentPlanID {
+			payments = plan.Payments
+		}
+	}
+
+	res, reconcileErr := reconcilePlan(paymentPlan, payments, location(debt, paymentPlan))
+	if reconcileErr != nil {
+		return failure(reconcileErr, fmt.Sprintf("Failed to build the schedule of paymentPlanID: %d", paymentPlanID))
+	}
+
+	printErr := writeList(len(res.Installments), func(i int) interface{} {
+		return res.Installments[i]
+	})
+	if printErr != nil {
+		return failure(printErr, "Failed to write installments")
+	}
+	return exitOK
+}
+
+// runSummary ... writes the portfolio totals over the enriched debts passing the filters
+func runSummary(ctx context.Context, args []string) int {
+	if len(args) != 0 {
+		return usageError("summary takes no arguments, got %q", args)
+	}
+
+	// The summary of the debts that could be enriched is still written when others failed
+	summary := newSummary()
+	code := forEachEnrichedDebt(ctx, summary.add)
+
+	// The csv, tsv and table formats list one metric per row rather than one very wide row
+	var err error
+	if appConfig.Format == output.JSON || appConfig.Format == output.NDJSON {
+		err = writeDocument(summary)
+	} else {
+		metrics := summary.metrics()
+		err = writeList(len(metrics), func(i int) interface{} {
+			return metrics[i]
+		})
+	}
+
+	if err != nil {
+		return failure(err, "Failed to write the summary")
+	}
+	return code
+}
+
+// runForecast ... writes the collections expected per period from the unpaid installments of the debts passing the filters
+func runForecast(ctx context.Context, args []string) int {
+	if len(args) != 0 {
+		return usageError("forecast takes no arguments, got %q", args)
+	}
+
+	projection, err := forecast.New(nowIn(defaultLocation()), appConfig.HorizonDays, appConfig.Period, appConfig.Haircuts)
+	if err != nil {
+		return failure(err, "Failed to create the forecast")
+	}
+
+	// The forecast of the debts that could be enriched is still written when others failed
+	code := forEachEnrichedDebt(ctx, func(res EnrichedDebt) {
+		projection.Add(res.installments, res.Status)
+	})
+
+	buckets := projection.Buckets()
+	if err = writeList(len(buckets), func(i int) interface{} {
+		return buckets[i]
+	}); err != nil {
+		return failure(err, "Failed to write the forecast")
+	}
+	return code
+}
+
+// runValidate ... writes the data-quality findings over every debt, payment plan and payment
+func runValidate(ctx context.Context, args []string) int {
+	if len(args) != 0 {
+		return usageError("validate takes no arguments, got %q", args)
+	}
+
+	debts, err := trueAccordAPIConnector.GetDebts(ctx)
+	if err != nil {
+		err.LogError()
+		return exitFailure
+	}
+
+	paymentPlans, err := trueAccordAPIConnector.GetAllPaymentPlans(ctx)
+	if err != nil {
+		err.LogError()
+		return exitFailure
+	}
+
+	payments, err := trueAccordAPIConnector.GetAllPayments(ctx)
+	if err != nil {
+		err.LogError()
+		return exitFailure
+	}
+
+	findings := validation.Validate(debts, paymentPlans, payments)
+	report := validation.NewReport(validation.Counts{Debts: len(debts), PaymentPlans: len(paymentPlans), Payments: len(payments)}, findings)
+
+	// json writes the whole report; the other formats write one finding per line or row
+	var printErr error
+	if appConfig.Format == output.JSON {
+		printErr = writeDocument(report)
+	} else {
+		printErr = writeList(len(findings), func(i int) interface{} {
+			return findings[i]
+		})
+	}
+	if printErr != nil {
+		return failure(printErr, "Failed to write findings")
+	}
+
+	log.WithFields(log.Fields{
+		"Message": fmt.Sprintf("Validated %d debts, %d payment plans and %d payments: %d errors, %d warnings", len(debts), len(paymentPlans), len(payments), report.Errors, report.Warnings),
+	}).Info()
+
+	if validation.HasErrors(findings) {
+		return exitFindings
+	}
+	return exitOK
+}
+
+// notFound ... logs a missing entity and returns exitNotFound
+func notFound(message string) int {
+	log.WithFields(log.Fields{
+		"Message": message,
+	}).Error()
+	return exitNotFound
+}
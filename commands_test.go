@@ -0,0 +1,446 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"true_accord/shared/clock"
+	"true_accord/shared/config"
+	"true_accord/shared/money"
+	"true_accord/shared/reconciliation"
+	trueaccordapiconnector "true_accord/shared/trueaccordapi"
+	"true_accord/shared/validation"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// captureOutput ... runs the commands with configuration c and returns their output
+func captureOutput(c config.Config) (output *bytes.Buffer, restore func()) {
+	output = &bytes.Buffer{}
+	previousConfig, previousStdout := appConfig, stdout
+
+	appConfig, stdout = c, output
+	return output, func() {
+		appConfig, stdout = previousConfig, previousStdout
+	}
+}
+
+func TestRunSuccessHelp(t *testing.T) {
+	output, restore := captureOutput(config.Default())
+	defer restore()
+
+	assert.Equal(t, exitOK, run([]string{"help"}))
+	assert.Contains(t, output.String(), "Commands:")
+	assert.Contains(t, output.String(), "schedule <payment-plan-id>")
+	assert.Contains(t, output.String(), "-concurrency")
+
+	output.Reset()
+	assert.Equal(t, exitOK, run([]string{"debt", "--help"}))
+	assert.Contains(t, output.String(), "Usage: true_accord debt <debt-id> [flags]")
+}
+
+func TestRunFailureUsage(t *testing.T) {
+	_, restore := captureOutput(config.Default())
+	defer restore()
+
+	os.Setenv("TRUEACCORD_API_URL", "http://localhost")
+	defer os.Unsetenv("TRUEACCORD_API_URL")
+
+	assert.Equal(t, exitUsage, run([]string{"report"}))
+	assert.Equal(t, exitUsage, run([]string{"enrich", "--concurrency", "0"}))
+	assert.Equal(t, exitUsage, run([]string{"enrich", "--unknown-flag"}))
+	assert.Equal(t, exitUsage, run([]string{"debt"}))
+	assert.Equal(t, exitUsage, run([]string{"debt", "first"}))
+	assert.Equal(t, exitUsage, run([]string{"schedule", "1", "2"}))
+}
+
+func TestRunEnrichSuccessFilters(t *testing.T) {
+	c := config.Default()
+	c.Format = "json"
+	c.Statuses = []string{"NO_PAYMENT_PLAN"}
+	c.DebtIDs = []int64{1, 2, 3}
+
+	output, restore := captureOutput(c)
+	defer restore()
+	trueAccordAPIConnector = newTestPortfolio(6)
+
+	assert.Equal(t, exitOK, runEnrich(context.Background(), nil))
+
+	var results []EnrichedDebt
+	assert.Nil(t, json.Unmarshal(output.Bytes(), &results))
+	assert.Equal(t, 2, len(results))
+	assert.Equal(t, int64(1), results[0].ID)
+	assert.Equal(t, int64(3), results[1].ID)
+}
+
+func TestRunEnrichFailurePartial(t *testing.T) {
+	output, restore := captureOutput(config.Default())
+	defer restore()
+
+	connector := newTestPortfolio(2)
+	connector.debts = append(connector.debts, trueaccordapiconnector.Debt{ID: -1, Amount: money.MustParse("10")})
+	trueAccordAPIConnector = connector
+
+	assert.Equal(t, exitFailure, runEnrich(context.Background(), nil))
+	assert.Equal(t, 2, strings.Count(output.String(), "\n"), "The debts that could be enriched are still written")
+}
+
+func TestRunEnrichFailureUnschedulablePlan(t *testing.T) {
+	output, restore := captureOutput(config.Default())
+	defer restore()
+
+	connector := newTestPortfolio(4)
+	connector.paymentPlans[2][0].InstallmentFrequency = "YEARLY"
+	trueAccordAPIConnector = connector
+
+	assert.Equal(t, exitFailure, runEnrich(context.Background(), nil))
+	assert.Equal(t, 4, strings.Count(output.String(), "\n"), "The FAILED debt is still written")
+	assert.Contains(t, output.String(), `"delinquency_status":"FAILED"`)
+}
+
+func TestRunDebtSuccess(t *testing.T) {
+	output, restore := captureOutput(config.Default())
+	defer restore()
+	connector := newTestPortfolio(2)
+	trueAccordAPIConnector = connector
+
+	assert.Equal(t, exitOK, runDebt(context.Background(), []string{"0"}))
+	assert.Equal(t, 0, connector.fullScans, "The debt is fetched by ID")
+
+	var detail DebtDetail
+	assert.Nil(t, json.Unmarshal(output.Bytes(), &detail))
+	assert.Equal(t, int64(0), detail.ID)
+	assert.Equal(t, int64(0), detail.PaymentPlan.ID)
+	assert.Equal(t, 1, len(detail.Payments))
+	assert.Equal(t, 4, len(detail.Installments))
+	assert.Equal(t, money.MustParse("25"), detail.Installments[0].AmountPaid)
+}
+
+func TestRunDebtSuccessPlanHistory(t *testing.T) {
+	output, restore := captureOutput(config.Default())
+	defer restore()
+
+	connector := newTestPortfolio(1)
+	connector.debts[0].Amount = money.MustParse("150")
+	connector.paymentPlans[0] = []trueaccordapiconnector.PaymentPlan{
+		{ID: 11, DebtID: 0, AmountToPay: money.MustParse("60"), InstallmentFrequency: "WEEKLY", InstallmentAmount: money.MustParse("20"), StartDate: "2020-10-15"},
+		{ID: 10, DebtID: 0, AmountToPay: money.MustParse("100"), InstallmentFrequency: "BI_WEEKLY", InstallmentAmount: money.MustParse("50"), StartDate: "2020-09-01"},
+	}
+	connector.payments = map[int64][]trueaccordapiconnector.Payment{
+		10: {
+			{Amount: money.MustParse("50"), Date: "2020-09-01", PaymentPlanID: 10},
+			{Amount: money.MustParse("20"), Date: "2020-10-29", PaymentPlanID: 10},
+		},
+		11: {
+			{Amount: money.MustParse("20"), Date: "2020-10-15", PaymentPlanID: 11},
+			{Amount: money.MustParse("20"), Date: "2020-10-22", PaymentPlanID: 11},
+		},
+	}
+	trueAccordAPIConnector = connector
+
+	assert.Equal(t, exitOK, runDebt(context.Background(), []string{"0"}))
+
+	var detail DebtDetail
+	assert.Nil(t, json.Unmarshal(output.Bytes(), &detail))
+	assert.Equal(t, int64(11), *detail.ActivePaymentPlanID)
+	assert.Equal(t, int64(11), detail.PaymentPlan.ID)
+	assert.Equal(t, 2, detail.PaymentPlans)
+	assert.Equal(t, 3, len(detail.Payments), "The payment recorded against the broken plan counts toward the active plan")
+	assert.Equal(t, "PAID_OFF", detail.Status)
+	assert.Equal(t, money.Zero, detail.RemainingDebt)
+	assert.Equal(t, money.MustParse("110"), detail.TotalPaid)
+	assert.Equal(t, money.MustParse("40"), detail.DebtBalance, "The debt balance counts payments to every plan")
+
+	assert.Equal(t, 2, len(detail.PaymentPlanHistory))
+	assert.Equal(t, int64(10), detail.PaymentPlanHistory[0].PaymentPlan.ID)
+	assert.False(t, detail.PaymentPlanHistory[0].Active)
+	assert.Equal(t, 1, len(detail.PaymentPlanHistory[0].Payments))
+}
+
+func TestRunDebtFailureNotFound(t *testing.T) {
+	_, restore := captureOutput(config.Default())
+	defer restore()
+	trueAccordAPIConnector = newTestPortfolio(2)
+
+	assert.Equal(t, exitNotFound, runDebt(context.Background(), []string{"7"}))
+}
+
+func TestRunScheduleSuccess(t *testing.T) {
+	output, restore := captureOutput(config.Default())
+	defer restore()
+	connector := newTestPortfolio(2)
+	trueAccordAPIConnector = connector
+
+	assert.Equal(t, exitOK, runSchedule(context.Background(), []string{"0"}))
+	assert.Equal(t, 0, connector.fullScans, "The payment plan is fetched by ID")
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	assert.Equal(t, 4, len(lines))
+	assert.Contains(t, lines[0], `"installment_number":1`)
+	assert.Contains(t, lines[3], `"due_date":"2020-10-22T00:00:00Z"`)
+
+	assert.Equal(t, exitNotFound, runSchedule(context.Background(), []string{"1"}))
+}
+
+func TestRunSummarySuccess(t *testing.T) {
+	output, restore := captureOutput(config.Default())
+	defer restore()
+	trueAccordAPIConnector = newTestPortfolio(4)
+
+	assert.Equal(t, exitOK, runSummary(context.Background(), nil))
+
+	var summary Summary
+	assert.Nil(t, json.Unmarshal(output.Bytes(), &summary))
+	assert.Equal(t, 4, summary.Debts)
+	assert.Equal(t, 2, summary.InPaymentPlan)
+	assert.Equal(t, money.MustParse("400.06"), summary.TotalDebt)
+	assert.Equal(t, 2, summary.ByStatus["NO_PAYMENT_PLAN"])
+	assert.Equal(t, 0, summary.ByStatus["PAID_OFF"])
+	assert.Equal(t, money.MustParse("50"), summary.CollectedToDate)
+
+	c := config.Default()
+	c.Format = "table"
+	appConfig = c
+
+	output.Reset()
+	assert.Equal(t, exitOK, runSummary(context.Background(), nil))
+	assert.Contains(t, output.String(), "METRIC")
+	assert.Regexp(t, `ageing\.1_30_days\.debts +2\n`, output.String())
+}
+
+func TestRunSummaryFailureUnschedulablePlan(t *testing.T) {
+	output, restore := captureOutput(config.Default())
+	defer restore()
+
+	portfolio := newTestPortfolio(4)
+	portfolio.paymentPlans[2][0].InstallmentFrequency = "YEARLY"
+	trueAccordAPIConnector = portfolio
+
+	assert.Equal(t, exitFailure, runSummary(context.Background(), nil))
+
+	var summary Summary
+	assert.Nil(t, json.Unmarshal(output.Bytes(), &summary), "The summary is still written")
+	assert.Equal(t, 4, summary.Debts)
+	assert.Equal(t, 1, summary.ByStatus["FAILED"])
+	assert.Equal(t, 1, summary.ByStatus["LATE"])
+}
+
+func TestRunForecastSuccess(t *testing.T) {
+	enrichmentClock = clock.NewFixedClock(time.Date(2020, 10, 5, 0, 0, 0, 0, time.UTC))
+	defer func() {
+		enrichmentClock = clock.NewFixedClock(testNow)
+	}()
+
+	c := config.Default()
+	c.HorizonDays = 30
+	c.Haircuts = map[string]float64{"CURRENT": 0.1}
+
+	output, restore := captureOutput(c)
+	defer restore()
+	trueAccordAPIConnector = newTestPortfolio(4)
+
+	assert.Equal(t, exitOK, runForecast(context.Background(), nil))
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	assert.Equal(t, 5, len(lines))
+	assert.Equal(t, `{"period_start":"2020-10-05T00:00:00Z","period_end":"2020-10-11T00:00:00Z","installments":2,"scheduled":50.00,"expected":45.00}`, lines[0])
+	assert.Contains(t, lines[3], `"installments":0`)
+}
+
+func TestRunForecastFailureUnschedulablePlan(t *testing.T) {
+	enrichmentClock = clock.NewFixedClock(time.Date(2020, 10, 5, 0, 0, 0, 0, time.UTC))
+	defer func() {
+		enrichmentClock = clock.NewFixedClock(testNow)
+	}()
+
+	c := config.Default()
+	c.HorizonDays = 30
+
+	output, restore := captureOutput(c)
+	defer restore()
+
+	portfolio := newTestPortfolio(4)
+	portfolio.paymentPlans[2][0].InstallmentFrequency = "YEARLY"
+	trueAccordAPIConnector = portfolio
+
+	assert.Equal(t, exitFailure, runForecast(context.Background(), nil))
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	assert.Equal(t, 5, len(lines), "The buckets are still written")
+	assert.Contains(t, lines[0], `"installments":1,"scheduled":25.00`)
+}
+
+func TestRunValidateFailureFindings(t *testing.T) {
+	output, restore := captureOutput(config.Default())
+	defer restore()
+
+	connector := newTestPortfolio(2)
+	connector.payments[9] = []trueaccordapiconnector.Payment{{Amount: money.MustParse("5"), Date: "2020-10-01", PaymentPlanID: 9}}
+	trueAccordAPIConnector = connector
+
+	assert.Equal(t, exitFindings, runValidate(context.Background(), nil))
+	assert.Contains(t, output.String(), `"check":"ORPHANED_PAYMENT"`)
+
+	c := config.Default()
+	c.Format = "json"
+	appConfig = c
+
+	output.Reset()
+	assert.Equal(t, exitFindings, runValidate(context.Background(), nil))
+
+	var report validation.Report
+	assert.Nil(t, json.Unmarshal(output.Bytes(), &report))
+	assert.Equal(t, validation.Counts{Debts: 2, PaymentPlans: 1, Payments: 2}, report.Checked)
+	assert.Equal(t, 1, report.Errors)
+	assert.Equal(t, 1, report.ByCheck["ORPHANED_PAYMENT"])
+	assert.Equal(t, int64(9), *report.Findings[0].PaymentPlanID)
+
+	appConfig = config.Default()
+	delete(connector.payments, 9)
+	output.Reset()
+	assert.Equal(t, exitOK, runValidate(context.Background(), nil))
+	assert.Empty(t, output.String())
+}
+
+func TestRunEnrichSuccessCSV(t *testing.T) {
+	c := config.Default()
+	c.Format = "csv"
+
+	output, restore := captureOutput(c)
+	defer restore()
+	trueAccordAPIConnector = newTestPortfolio(2)
+
+	assert.Equal(t, exitOK, runEnrich(context.Background(), nil))
+	assert.Equal(t, ""+
+		"id,amount,time_zone,apr,accrual_start_date,day_count,is_in_payment_plan,remaining_amount,next_payment_due_date,days_past_due,amount_past_due,missed_installments,delinquency_status,"+
+		"payment_plan_id,payment_plan_count,total_paid,debt_balance,original_debt,settlement_amount,discount_forgiven,paid_toward_plan,remaining_on_plan,late_fees,fees_waived,amount_owed,accrued_interest,payoff_amount\n"+
+		"0,100.00,,0,,,true,75.00,2020-10-22T00:00:00Z,22,75.00,3,LATE,0,1,25.00,75.00,100.00,100.00,0.00,25.00,75.00,0.00,0.00,75.00,0.00,75.00\n"+
+		"1,100.01,,0,,,false,100.01,,0,0.00,0,NO_PAYMENT_PLAN,,0,0.00,100.01,100.01,100.01,0.00,0.00,0.00,0.00,0.00,100.01,0.00,100.01\n", output.String())
+}
+
+func TestRunEnrichSuccessLegacy(t *testing.T) {
+	c := config.Default()
+	c.OutputVersion = config.OutputVersionLegacy
+
+	output, restore := captureOutput(c)
+	defer restore()
+	trueAccordAPIConnector = newTestPortfolio(2)
+
+	assert.Equal(t, exitOK, runEnrich(context.Background(), nil))
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	assert.Equal(t, 2, len(lines))
+	assert.Contains(t, lines[0], `"remaining_amount":"75.00","next_payment_due_date":"2020-10-22T00:00:00Z"`)
+	assert.Contains(t, lines[1], `"remaining_amount":"100.01","next_payment_due_date":"null"`)
+}
+
+func TestRunEnrichSuccessLegacyCSV(t *testing.T) {
+	c := config.Default()
+	c.OutputVersion = config.OutputVersionLegacy
+	c.Format = "csv"
+
+	output, restore := captureOutput(c)
+	defer restore()
+
+	// The time zone and interest terms of the debt are left out of version 1
+	portfolio := newTestPortfolio(2)
+	portfolio.debts[0].TimeZone = "America/New_York"
+	portfolio.debts[0].APR = 0.18
+	portfolio.debts[0].AccrualStartDate = "2020-01-01"
+	portfolio.debts[0].DayCount = "30/360"
+	trueAccordAPIConnector = portfolio
+
+	assert.Equal(t, exitOK, runEnrich(context.Background(), nil))
+	assert.Equal(t, ""+
+		"id,amount,is_in_payment_plan,remaining_amount,next_payment_due_date,days_past_due,amount_past_due,missed_installments,delinquency_status\n"+
+		"0,100.00,true,75.00,2020-10-22T00:00:00Z,22,75.00,3,LATE\n"+
+		"1,100.01,false,100.01,null,0,0.00,0,NO_PAYMENT_PLAN\n", output.String())
+}
+
+// assertMatchesSchema ... checks every line of NDJSON enrich output against the types, enums and required fields of
+// enrichedDebtSchema
+func assertMatchesSchema(t *testing.T, ndjson string) {
+	var schema struct {
+		Required   []string `json:"required"`
+		Properties map[string]struct {
+			Type interface{}   `json:"type"`
+			Enum []interface{} `json:"enum"`
+		} `json:"properties"`
+	}
+	assert.Nil(t, json.Unmarshal([]byte(enrichedDebtSchema), &schema))
+
+	jsonTypes := map[string]string{"bool": "boolean", "float64": "number", "string": "string"}
+	for _, line := range strings.Split(strings.TrimSpace(ndjson), "\n") {
+		var record map[string]interface{}
+		assert.Nil(t, json.Unmarshal([]byte(line), &record))
+		assert.Equal(t, len(schema.Required), len(record), "Every field is required and no other is allowed")
+
+		for _, key := range schema.Required {
+			value, ok := record[key]
+			assert.True(t, ok, key)
+
+			types := fmt.Sprint(schema.Properties[key].Type)
+			if value == nil {
+				assert.Contains(t, types, "null", key)
+			} else if jsonType := jsonTypes[fmt.Sprintf("%T", value)]; jsonType == "number" {
+				assert.Regexp(t, "number|integer", types, key)
+			} else {
+				assert.Contains(t, types, jsonType, key)
+			}
+
+			if enum := schema.Properties[key].Enum; enum != nil {
+				assert.Contains(t, enum, value, key)
+			}
+		}
+	}
+}
+
+func TestRunSchemaSuccess(t *testing.T) {
+	output, restore := captureOutput(config.Default())
+	defer restore()
+	trueAccordAPIConnector = newTestPortfolio(2)
+
+	assert.Equal(t, exitOK, runSchema(context.Background(), nil))
+	assert.JSONEq(t, enrichedDebtSchema, output.String())
+
+	output.Reset()
+	assert.Equal(t, exitOK, runEnrich(context.Background(), nil))
+	assertMatchesSchema(t, output.String())
+}
+
+func TestRunEnrichSuccessUnschedulablePlanMatchesSchema(t *testing.T) {
+	output, restore := captureOutput(config.Default())
+	defer restore()
+
+	// A frequency the schedule doesn't know and an installment_amount of 0 can't be scheduled
+	portfolio := newTestPortfolio(2)
+	portfolio.paymentPlans[1] = []trueaccordapiconnector.PaymentPlan{{ID: 1, DebtID: 1, AmountToPay: money.MustParse("100"), InstallmentFrequency: "YEARLY", InstallmentAmount: money.MustParse("25"), StartDate: "2020-10-01"}}
+	portfolio.paymentPlans[0][0].InstallmentAmount = money.Zero
+	trueAccordAPIConnector = portfolio
+
+	assert.Equal(t, exitFailure, runEnrich(context.Background(), nil))
+	assertMatchesSchema(t, output.String())
+
+	var records []EnrichedDebt
+	for _, line := range strings.Split(strings.TrimSpace(output.String()), "\n") {
+		var record EnrichedDebt
+		assert.Nil(t, json.Unmarshal([]byte(line), &record))
+		records = append(records, record)
+	}
+
+	assert.Equal(t, 2, len(records))
+	for i, record := range records {
+		assert.Equal(t, int64(i), record.ID)
+		assert.Equal(t, portfolio.debts[1-i].Amount, record.Amount)
+		assert.True(t, record.HasPaymentPlan)
+		assert.Equal(t, reconciliation.StatusFailed, record.Status)
+		assert.Nil(t, record.NextBillingDate)
+		assert.Equal(t, record.Amount, record.OriginalDebt)
+	}
+}
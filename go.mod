@@ -6,5 +6,6 @@ require (
 	github.com/jarcoal/httpmock v1.0.6
 	github.com/sirupsen/logrus v1.7.0
 	github.com/stretchr/testify v1.6.1
+	gopkg.in/yaml.v3 v3.0.0-20200313102051-9f266ea9e77c
 	golang.org/x/tools v0.0.0-20201030204249-4fc0492b8eca // indirect
 )
@@ -1,16 +1,29 @@
 package main
 
 import (
-	"encoding/json"
-	"errors"
+	"context"
+	"flag"
 	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
 
 	// "http"
 
-	"math"
 	"time"
 
+	"true_accord/shared/calendar"
+	"true_accord/shared/clock"
+	"true_accord/shared/config"
+	"true_accord/shared/fees"
 	"true_accord/shared/httphelpers"
+	"true_accord/shared/interest"
+	"true_accord/shared/money"
+	"true_accord/shared/output"
+	"true_accord/shared/reconciliation"
+	"true_accord/shared/schedule"
 	trueaccordapiconnector "true_accord/shared/trueaccordapi"
 
 	log "github.com/sirupsen/logrus"
@@ -18,84 +31,225 @@ import (
 
 var trueAccordAPIConnector trueaccordapiconnector.TrueAccordAPIConnector
 
-const (
-	weeklyInterval   = time.Hour * 24 * 7
-	biweeklyInterval = time.Hour * 24 * 7 * 2
-)
+// appConfig ... is the configuration of the run, loaded by initialize
+var appConfig config.Config
+
+// enrichmentClock ... is the source of "now" for every date calculation in the enrichment
+var enrichmentClock clock.Clock = clock.NewClock()
+
+// holidayCalendar ... is the calendar due dates are rolled around, loaded by initialize
+var holidayCalendar *calendar.Calendar
+
+// feeRules ... are the grace period and late fee rules, loaded by initialize
+var feeRules *fees.Rules
 
+// EnrichedDebt ... is a debt with its payment plan, next payment and delinquency information, in output version 2:
+// amounts are JSON numbers with two decimals and next_payment_due_date is null when nothing more is due
 type EnrichedDebt struct {
 	trueaccordapiconnector.Debt
 
-	HasPaymentPlan  bool   `json:"is_in_payment_plan"`
-	RemainingDebt   string `json:"remaining_amount"`
-	NextBillingDate string `json:"next_payment_due_date"`
+	HasPaymentPlan  bool        `json:"is_in_payment_plan"`
+	RemainingDebt   money.Money `json:"remaining_amount"`
+	NextBillingDate *time.Time  `json:"next_payment_due_date"`
+
+	reconciliation.Delinquency
+
+	// ActivePaymentPlanID is the plan the next payment and delinquency are reported for, of PaymentPlans in the debt's history
+	ActivePaymentPlanID *int64 `json:"payment_plan_id"`
+	PaymentPlans        int    `json:"payment_plan_count"`
+	// TotalPaid is paid to date across every payment plan; DebtBalance is the debt amount less TotalPaid
+	TotalPaid   money.Money `json:"total_paid"`
+	DebtBalance money.Money `json:"debt_balance"`
+
+	// The active plan settles OriginalDebt for SettlementAmount, forgiving DiscountForgiven
+	OriginalDebt     money.Money `json:"original_debt"`
+	SettlementAmount money.Money `json:"settlement_amount"`
+	DiscountForgiven money.Money `json:"discount_forgiven"`
+	PaidTowardPlan   money.Money `json:"paid_toward_plan"`
+	RemainingOnPlan  money.Money `json:"remaining_on_plan"`
+
+	// LateFees have accrued on the active plan under the fee rules, net of FeesWaived; AmountOwed is
+	// remaining_amount plus LateFees
+	LateFees   money.Money `json:"late_fees"`
+	FeesWaived money.Money `json:"fees_waived"`
+	AmountOwed money.Money `json:"amount_owed"`
+	// AccruedInterest is the simple interest accrued under the debt's interest terms on the debt amount less the
+	// payments made, until its first payment plan started; PayoffAmount is AmountOwed plus AccruedInterest
+	AccruedInterest money.Money `json:"accrued_interest"`
+	PayoffAmount    money.Money `json:"payoff_amount"`
+
+	// Payment plan details used by the portfolio reports; not part of the output
+	paymentPlan   *trueaccordapiconnector.PaymentPlan
+	installments  []reconciliation.InstallmentStatus
+	feeAssessment fees.Assessment
 }
 
-func initialize() {
-	log.SetFormatter(&log.TextFormatter{})
-	trueAccordAPIConnector = trueaccordapiconnector.NewTrueAccordAPIConnector()
-}
+// initialize ... loads the configuration from args and the environment and creates the TrueAccord API connector
+func initialize(name string, args []string) (remaining []string, err error) {
+	appConfig, remaining, err = config.Load(name, args, os.Getenv)
+	if err != nil {
+		return
+	}
+
+	if !appConfig.AsOf.IsZero() {
+		enrichmentClock = clock.NewFixedClock(appConfig.AsOf)
+	}
 
-// aggregateNextPaymentInfo ... returns the next payment date and amount owed according to payment plan (not debt)
-func aggregateNextPaymentInfo(paymentPlan *trueaccordapiconnector.PaymentPlan, totalPaid float64) (nextPaymentDate time.Time, err error) {
-	if paymentPlan == nil {
-		err = errors.New("No payment plan provided")
+	holidayCalendar, err = calendar.Load(appConfig.HolidayCalendar)
+	if err != nil {
+		err = fmt.Errorf("Invalid holiday_calendar %q: %v", appConfig.HolidayCalendar, err)
 		return
 	}
 
-	paymentDate, err := time.Parse("2006-01-02", paymentPlan.StartDate)
+	feeRules, err = fees.Load(appConfig.FeeRules)
 	if err != nil {
+		err = fmt.Errorf("Invalid fee_rules %q: %v", appConfig.FeeRules, err)
 		return
 	}
 
-	if paymentPlan.AmountToPay <= float64(0) {
-		err = errors.New("No payment plan amount to pay")
+	rateLimits, err := trueaccordapiconnector.NewRateLimits(appConfig.RateLimits)
+	if err != nil {
 		return
 	}
 
-	if paymentPlan.InstallmentAmount <= float64(0) && paymentPlan.AmountToPay != float64(0) {
-		err = errors.New("No installment_amount found")
+	authenticator, err := appConfig.Credentials.Authenticator()
+	if err != nil {
 		return
 	}
 
-	subtotalOwed := paymentPlan.InstallmentAmount
+	retryPolicy := trueaccordapiconnector.DefaultRetryPolicy
+	retryPolicy.MaxAttempts = appConfig.MaxAttempts
 
-	var paymentInterval time.Duration
-	if paymentPlan.InstallmentFrequency == "WEEKLY" {
-		paymentInterval = weeklyInterval
-	} else if paymentPlan.InstallmentFrequency == "BI_WEEKLY" {
-		paymentInterval = biweeklyInterval
-	} else {
-		err = errors.New("Unhandled payment interval")
+	options := []trueaccordapiconnector.Option{
+		trueaccordapiconnector.WithBaseURL(appConfig.APIURL),
+		trueaccordapiconnector.WithHTTPClient(trueaccordapiconnector.NewHTTPClient(appConfig.Concurrency, appConfig.Timeout)),
+		trueaccordapiconnector.WithPageSize(appConfig.PageSize),
+		trueaccordapiconnector.WithRetryPolicy(retryPolicy),
+		trueaccordapiconnector.WithRateLimits(rateLimits),
+	}
+	if authenticator != nil {
+		options = append(options, trueaccordapiconnector.WithAuthenticator(authenticator))
+	}
+
+	trueAccordAPIConnector = trueaccordapiconnector.NewTrueAccordAPIConnector(options...)
+	return remaining, nil
+}
+
+// locations ... caches the time zones named by debts and payment plans, with nil for names that can't be loaded
+var locations sync.Map
+
+// defaultLocation ... returns the configured time zone of debts and payment plans without their own
+func defaultLocation() *time.Location {
+	if appConfig.Location == nil {
+		return time.UTC
+	}
+	return appConfig.Location
+}
+
+// location ... returns the time zone of a payment plan (nil for the debt itself): the plan's time_zone, else the
+// debt's, else the configured default. A time zone that can't be loaded is logged once and skipped.
+func location(debt trueaccordapiconnector.Debt, paymentPlan *trueaccordapiconnector.PaymentPlan) *time.Location {
+	names := []string{debt.TimeZone}
+	if paymentPlan != nil {
+		names = []string{paymentPlan.TimeZone, debt.TimeZone}
+	}
+
+	for _, name := range names {
+		if name == "" {
+			continue
+		}
+		if loc, found := locations.Load(name); found {
+			if loc.(*time.Location) == nil {
+				continue
+			}
+			return loc.(*time.Location)
+		}
+
+		loc, err := time.LoadLocation(name)
+		if err != nil {
+			// Cache the failure as nil so each unknown time zone is only logged once
+			if _, loaded := locations.LoadOrStore(name, (*time.Location)(nil)); !loaded {
+				log.WithFields(log.Fields{
+					"Message": fmt.Sprintf("Ignoring unknown time_zone %q, first seen for debtID: %d", name, debt.ID),
+					"Error":   err.Error(),
+				}).Warn()
+			}
+			continue
+		}
+		locations.Store(name, loc)
+		return loc
+	}
+
+	return defaultLocation()
+}
+
+// nowIn ... returns the time of the enrichment in loc. A report as of a date is as of midnight on that date in loc.
+func nowIn(loc *time.Location) time.Time {
+	if !appConfig.AsOf.IsZero() {
+		year, month, day := appConfig.AsOf.Date()
+		return time.Date(year, month, day, 0, 0, 0, 0, loc)
+	}
+	return enrichmentClock.Now().In(loc)
+}
+
+// generateInstallments ... returns the installments of a payment plan due at midnight in loc, with due dates on
+// weekends and holidays moved to a business day by the configured roll convention
+func generateInstallments(paymentPlan *trueaccordapiconnector.PaymentPlan, loc *time.Location) (installments []schedule.Installment, err error) {
+	installments, err = schedule.GenerateIn(paymentPlan, loc)
+	if err != nil || holidayCalendar == nil || appConfig.RollConvention == "" || appConfig.RollConvention == calendar.RollNone {
 		return
 	}
 
-	// Retrieve next payment date and amount owed by payment date (independent of actual payments)
-	now := time.Now()
+	for i := range installments {
+		installments[i].DueDate, err = holidayCalendar.Adjust(installments[i].DueDate, appConfig.RollConvention)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return
+}
 
-	for paymentDate.Before(now) && paymentPlan.AmountToPay > subtotalOwed {
-		paymentDate = paymentDate.Add(paymentInterval)
-		subtotalOwed += paymentPlan.InstallmentAmount
+// aggregateNextPaymentInfo ... returns the next payment date and amount owed according to payment plan (not debt).
+// Installments are due at midnight in loc, rolled to a business day by the configured roll convention.
+func aggregateNextPaymentInfo(paymentPlan *trueaccordapiconnector.PaymentPlan, totalPaid money.Money, loc *time.Location) (nextPaymentDate time.Time, err error) {
+	installments, err := generateInstallments(paymentPlan, loc)
+	if err != nil {
+		return
 	}
 
-	return paymentDate, nil
+	// Retrieve next payment date by payment date (independent of actual payments)
+	now := nowIn(loc)
+
+	for _, installment := range installments {
+		nextPaymentDate = installment.DueDate
+		if !nextPaymentDate.Before(now) {
+			break
+		}
+	}
+
+	return nextPaymentDate, nil
 }
 
-// aggregatePayments ... returns the total amount paid
-func aggregatePayments(payments []trueaccordapiconnector.Payment) (totalPayments float64) {
+// aggregatePayments ... returns the total amount paid on or before today in loc. Payments with an unparseable date
+// are logged and skipped.
+func aggregatePayments(payments []trueaccordapiconnector.Payment, loc *time.Location) (totalPayments money.Money) {
 	if len(payments) == 0 {
 		return
 	}
 
-	now := time.Now()
+	now := nowIn(loc)
 
 	for _, payment := range payments {
-		paymentDate, err := time.Parse("2006-01-02", payment.Date)
+		paymentDate, err := schedule.ParseDate(payment.Date, loc)
 		if err != nil {
-			return
+			log.WithFields(log.Fields{
+				"Message": fmt.Sprintf("Skipping payment with unparseable date %q for paymentPlanID: %d", payment.Date, payment.PaymentPlanID),
+				"Error":   err.Error(),
+			}).Warn()
+			continue
 		}
 
-		if paymentDate.Before(now) {
+		if !paymentDate.After(now) {
 			totalPayments += payment.Amount
 		}
 	}
@@ -103,88 +257,182 @@ func aggregatePayments(payments []trueaccordapiconnector.Payment) (totalPayments
 	return
 }
 
-// debtDataEnrichment ... returns the debt object with paymentPlan and next payment information
-func debtDataEnrichment(debt trueaccordapiconnector.Debt, nextPaymentDate time.Time, paymentPlan *trueaccordapiconnector.PaymentPlan, totalPayments float64) (res EnrichedDebt) {
-	if nextPaymentDate.IsZero() {
+// reconcilePlan ... returns the installments of a payment plan with the payments applied to them, dated in loc.
+// Installments rolled off a weekend or holiday aren't late until after the business day they roll to.
+func reconcilePlan(paymentPlan *trueaccordapiconnector.PaymentPlan, payments []trueaccordapiconnector.Payment, loc *time.Location) (res reconciliation.Result, err error) {
+	installments, err := generateInstallments(paymentPlan, loc)
+	if err != nil {
 		return
 	}
 
-	remainingAmount := math.Max(paymentPlan.AmountToPay-totalPayments, 0)
-	if remainingAmount == 0 {
+	return reconciliation.Reconcile(installments, payments, nowIn(loc)), nil
+}
+
+// debtDataEnrichment ... returns the debt object with paymentPlan, next payment and delinquency information.
+// Without a next payment date the plan couldn't be scheduled, so the debt is reported as FAILED.
+func debtDataEnrichment(debt trueaccordapiconnector.Debt, nextPaymentDate time.Time, paymentPlan *trueaccordapiconnector.PaymentPlan, totalPayments money.Money, delinquency reconciliation.Delinquency) (res EnrichedDebt) {
+	if nextPaymentDate.IsZero() {
+		return EnrichedDebt{Debt: debt, HasPaymentPlan: true, Delinquency: reconciliation.Failed()}
+	}
+
+	remainingAmount := money.Max(paymentPlan.AmountToPay-totalPayments, money.Zero)
+	if remainingAmount.IsZero() {
 		res = EnrichedDebt{
-			debt,
-			true,
-			fmt.Sprintf("%.2f", remainingAmount),
-			"null",
+			Debt:           debt,
+			HasPaymentPlan: true,
+			RemainingDebt:  remainingAmount,
+			Delinquency:    delinquency,
 		}
 		return
 	}
 
 	res = EnrichedDebt{
-		debt,
-		true,
-		fmt.Sprintf("%.2f", remainingAmount),
-		nextPaymentDate.Format(time.RFC3339),
+		Debt:            debt,
+		HasPaymentPlan:  true,
+		RemainingDebt:   remainingAmount,
+		NextBillingDate: &nextPaymentDate,
+		Delinquency:     delinquency,
 	}
 
 	return
 }
 
-func logResult(res EnrichedDebt) error {
-	out, err := json.Marshal(res)
-	if err != nil {
-		return err
-	}
+// setBalance ... sets the debt balance from the total paid across every payment plan and reports the remaining
+// amount under the configured remaining policy. A debt without a payment plan always reports its debt balance.
+// The amount owed adds the late fees and the payoff amount adds accrued interest, so both are calculated first.
+func (res *EnrichedDebt) setBalance(totalPaid money.Money) {
+	res.TotalPaid = totalPaid
+	res.DebtBalance = money.Max(res.OriginalDebt-totalPaid, money.Zero)
 
-	fmt.Println(string(out))
-	return nil
+	if !res.HasPaymentPlan || appConfig.RemainingPolicy == config.RemainingPolicyDebt {
+		res.RemainingDebt = res.DebtBalance
+	} else {
+		res.RemainingDebt = res.RemainingOnPlan
+	}
+	res.AmountOwed = res.RemainingDebt + res.LateFees
+	res.PayoffAmount = res.AmountOwed + res.AccruedInterest
 }
 
-func main() {
-	initialize()
+// accrueInterest ... accrues simple interest under the debt's interest terms on the debt amount less the payments
+// made to its payment plans, from its accrual_start_date until the first plan in history started (as a plan's terms
+// replace the debt's) or asOf, whichever is first. Invalid terms are logged and accrue nothing.
+func (res *EnrichedDebt) accrueInterest(history []reconciliation.PlanPayments, asOf time.Time) {
+	if res.APR == 0 {
+		return
+	}
 
-	debts, err := trueAccordAPIConnector.GetDebts()
+	dayCount := res.DayCount
+	if dayCount == "" {
+		dayCount = interest.DefaultDayCount
+	}
+
+	start, err := schedule.ParseDate(res.AccrualStartDate, asOf.Location())
 	if err != nil {
-		err.LogError()
+		apiErr := httphelpers.NewAPIError(err, fmt.Sprintf("Failed to accrue interest for debtID: %d, invalid accrual_start_date %q", res.ID, res.AccrualStartDate))
+		apiErr.LogError()
+		return
 	}
 
-	for _, debt := range debts {
-		paymentPlan, err := trueAccordAPIConnector.GetPaymentPlan(debt.ID)
-		if err != nil {
-			err.LogError()
-			continue
+	// Payments with an unparseable date are already logged by aggregatePayments
+	end := asOf
+	var payments []interest.Payment
+	for i := range history {
+		if planStart, err := schedule.ParseDate(history[i].PaymentPlan.StartDate, asOf.Location()); err == nil && planStart.Before(end) {
+			end = planStart
 		}
 
-		if paymentPlan == nil {
-			res := EnrichedDebt{debt, false, fmt.Sprintf("%.2f", debt.Amount), "null"}
-
-			logError := logResult(res)
-			if logError != nil {
-				err = httphelpers.NewAPIError(logError, fmt.Sprintf("Failed to log result for debtID: %d", debt.ID))
-				err.LogError()
+		for _, payment := range history[i].Payments {
+			if paymentDate, err := schedule.ParseDate(payment.Date, asOf.Location()); err == nil {
+				payments = append(payments, interest.Payment{Date: paymentDate, Amount: payment.Amount})
 			}
-
-			continue
 		}
+	}
 
-		payments, err := trueAccordAPIConnector.GetPayments(paymentPlan.ID)
-		if err != nil {
-			err.LogError()
-		}
+	res.AccruedInterest, err = interest.AccrueOnBalance(res.Amount, payments, res.APR, start, end, dayCount)
+	if err != nil {
+		apiErr := httphelpers.NewAPIError(err, fmt.Sprintf("Failed to accrue interest for debtID: %d", res.ID))
+		apiErr.LogError()
+	}
+}
 
-		totalPaid := aggregatePayments(payments)
+// assessFees ... charges the late fees on the installments of the active payment plan under the fee rules
+func (res *EnrichedDebt) assessFees(paymentPlan *trueaccordapiconnector.PaymentPlan, asOf time.Time) {
+	if feeRules == nil {
+		return
+	}
 
-		nextPaymentDate, findPaymentErr := aggregateNextPaymentInfo(paymentPlan, totalPaid)
-		if findPaymentErr != nil {
-			err = httphelpers.NewAPIError(findPaymentErr, fmt.Sprintf("Failed to process payment plan for debtID: %d", debt.ID))
-			err.LogError()
-		}
+	res.feeAssessment = feeRules.Assess(res.ID, paymentPlan.ID, res.installments, asOf)
+	res.LateFees = res.feeAssessment.Accrued
+	res.FeesWaived = res.feeAssessment.Waived
+}
+
+func main() {
+	log.SetFormatter(&log.TextFormatter{})
+	os.Exit(run(os.Args[1:]))
+}
 
-		res := debtDataEnrichment(debt, nextPaymentDate, paymentPlan, totalPaid)
-		logError := logResult(res)
-		if logError != nil {
-			err = httphelpers.NewAPIError(logError, fmt.Sprintf("Failed to log result for debtID: %d", debt.ID))
-			err.LogError()
+// run ... runs the command named by the first argument (enrich if there is none) and returns the exit code
+func run(args []string) int {
+	name := "enrich"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+
+	if name == "help" {
+		printUsage(stdout)
+		return exitOK
+	}
+
+	cmd := findCommand(name)
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", name)
+		printUsage(os.Stderr)
+		return exitUsage
+	}
+
+	args, err := initialize(programName+" "+cmd.name, args)
+	if err == flag.ErrHelp {
+		printCommandUsage(stdout, cmd)
+		return exitOK
+	}
+	if err != nil {
+		log.WithFields(log.Fields{
+			"Message": err.Error(),
+		}).Error()
+		return exitUsage
+	}
+
+	out, err := output.Open(appConfig.Output)
+	if err != nil {
+		return failure(err, "Failed to open the output file")
+	}
+	previousStdout := stdout
+	stdout = out
+	defer func() {
+		stdout = previousStdout
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Cancel in-flight requests on SIGINT/SIGTERM so the run stops cleanly
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	go func() {
+		select {
+		case <-signals:
+			log.WithFields(log.Fields{
+				"Message": "Received interrupt, cancelling " + cmd.name,
+			}).Info()
+			cancel()
+		case <-ctx.Done():
 		}
+	}()
+
+	code := cmd.run(ctx, args)
+	if err = out.Close(); err != nil {
+		return failure(err, "Failed to close the output file")
 	}
+	return code
 }
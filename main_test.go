@@ -1,17 +1,28 @@
 package main
 
 import (
-	"bytes"
 	"errors"
-	"log"
 	"os"
 	"testing"
 	"time"
+
+	"true_accord/shared/calendar"
+	"true_accord/shared/clock"
+	"true_accord/shared/money"
+	"true_accord/shared/reconciliation"
 	trueaccordapiconnector "true_accord/shared/trueaccordapi"
 
 	"github.com/stretchr/testify/assert"
 )
 
+// testNow ... is the fixed "now" used by the enrichment in tests
+var testNow = time.Date(2020, 10, 30, 14, 31, 46, 0, time.UTC)
+
+func TestMain(m *testing.M) {
+	enrichmentClock = clock.NewFixedClock(testNow)
+	os.Exit(m.Run())
+}
+
 // Bod ... returns the beginning of the day for a given timestamp
 func Bod(t time.Time) time.Time {
 	year, month, day := t.Date()
@@ -19,180 +30,271 @@ func Bod(t time.Time) time.Time {
 }
 
 func TestAggregateNextPaymentInfoSuccess(t *testing.T) {
-	testPaymentPlan := trueaccordapiconnector.PaymentPlan{0, 0, 102.5, "WEEKLY", 51.25, "2020-09-28"}
+	testPaymentPlan := trueaccordapiconnector.PaymentPlan{ID: 0, DebtID: 0, AmountToPay: money.MustParse("102.5"), InstallmentFrequency: "WEEKLY", InstallmentAmount: money.MustParse("51.25"), StartDate: "2020-09-28"}
 	testSuccessNextPaymentDate, err := time.Parse("2006-01-02", "2020-10-05")
 	if err != nil {
 		t.Errorf(err.Error())
 	}
 
-	nextPaymentDate, err := aggregateNextPaymentInfo(&testPaymentPlan, 0.00)
+	nextPaymentDate, err := aggregateNextPaymentInfo(&testPaymentPlan, money.Zero, time.UTC)
 
 	assert.Nil(t, err)
 	assert.Equal(t, nextPaymentDate, testSuccessNextPaymentDate)
 }
 
 func TestAggregateNextPaymentInfoSuccessNoAmountOwedBalance(t *testing.T) {
-	testPaymentPlan := trueaccordapiconnector.PaymentPlan{0, 0, 0, "WEEKLY", 51.25, "2020-09-28"}
+	testPaymentPlan := trueaccordapiconnector.PaymentPlan{ID: 0, DebtID: 0, AmountToPay: money.MustParse("0"), InstallmentFrequency: "WEEKLY", InstallmentAmount: money.MustParse("51.25"), StartDate: "2020-09-28"}
 
-	_, err := aggregateNextPaymentInfo(&testPaymentPlan, 0.00)
+	_, err := aggregateNextPaymentInfo(&testPaymentPlan, money.Zero, time.UTC)
 
 	assert.NotNil(t, err)
 	assert.Equal(t, errors.New("No payment plan amount to pay"), err)
 }
 
 func TestAggregateNextPaymentInfoSuccessPartialPayments(t *testing.T) {
-	testPaymentPlan := trueaccordapiconnector.PaymentPlan{0, 0, 102.5, "WEEKLY", 51.25, "2020-09-28"}
+	testPaymentPlan := trueaccordapiconnector.PaymentPlan{ID: 0, DebtID: 0, AmountToPay: money.MustParse("102.5"), InstallmentFrequency: "WEEKLY", InstallmentAmount: money.MustParse("51.25"), StartDate: "2020-09-28"}
 	testSuccessNextPaymentDate, err := time.Parse("2006-01-02", "2020-10-05")
 	if err != nil {
 		t.Errorf(err.Error())
 	}
 
-	nextPaymentDate, err := aggregateNextPaymentInfo(&testPaymentPlan, 51.25)
+	nextPaymentDate, err := aggregateNextPaymentInfo(&testPaymentPlan, money.MustParse("51.25"), time.UTC)
 
 	assert.Nil(t, err)
 	assert.Equal(t, nextPaymentDate, testSuccessNextPaymentDate)
 }
 
 func TestAggregateNextPaymentInfoSuccessFullyPaidToDate(t *testing.T) {
-	now := time.Now()
+	now := testNow
 	nowString := now.Format("2006-01-02")
 	testSuccessNextPaymentDate := Bod(now.AddDate(0, 0, 7))
 
-	testPaymentPlan := trueaccordapiconnector.PaymentPlan{0, 0, 102.5, "WEEKLY", 51.25, nowString}
+	testPaymentPlan := trueaccordapiconnector.PaymentPlan{ID: 0, DebtID: 0, AmountToPay: money.MustParse("102.5"), InstallmentFrequency: "WEEKLY", InstallmentAmount: money.MustParse("51.25"), StartDate: nowString}
 
-	nextPaymentDate, err := aggregateNextPaymentInfo(&testPaymentPlan, 51.25)
+	nextPaymentDate, err := aggregateNextPaymentInfo(&testPaymentPlan, money.MustParse("51.25"), time.UTC)
 
 	assert.Nil(t, err)
 	assert.Equal(t, nextPaymentDate, testSuccessNextPaymentDate)
 }
 
 func TestAggregateNextPaymentInfoFailureInvalidInstallAmount(t *testing.T) {
-	testPaymentPlan := trueaccordapiconnector.PaymentPlan{0, 0, 102.5, "WEEKLY", 0, "2020-09-28"}
+	testPaymentPlan := trueaccordapiconnector.PaymentPlan{ID: 0, DebtID: 0, AmountToPay: money.MustParse("102.5"), InstallmentFrequency: "WEEKLY", InstallmentAmount: money.MustParse("0"), StartDate: "2020-09-28"}
 
-	_, err := aggregateNextPaymentInfo(&testPaymentPlan, 0.00)
+	_, err := aggregateNextPaymentInfo(&testPaymentPlan, money.Zero, time.UTC)
 
 	assert.NotNil(t, err)
 	assert.Equal(t, errors.New("No installment_amount found"), err)
 
-	testPaymentPlan = trueaccordapiconnector.PaymentPlan{0, 0, 102.5, "WEEKLY", -2, "2020-09-28"}
+	testPaymentPlan = trueaccordapiconnector.PaymentPlan{ID: 0, DebtID: 0, AmountToPay: money.MustParse("102.5"), InstallmentFrequency: "WEEKLY", InstallmentAmount: money.MustParse("-2"), StartDate: "2020-09-28"}
 
-	_, err = aggregateNextPaymentInfo(&testPaymentPlan, 0.00)
+	_, err = aggregateNextPaymentInfo(&testPaymentPlan, money.Zero, time.UTC)
 
 	assert.NotNil(t, err)
 	assert.Equal(t, errors.New("No installment_amount found"), err)
 }
 
 func TestAggregateNextPaymentInfoSuccessFutureStartDate(t *testing.T) {
-	testPaymentPlan := trueaccordapiconnector.PaymentPlan{0, 0, 102.5, "WEEKLY", 51.25, "2021-09-28"}
+	testPaymentPlan := trueaccordapiconnector.PaymentPlan{ID: 0, DebtID: 0, AmountToPay: money.MustParse("102.5"), InstallmentFrequency: "WEEKLY", InstallmentAmount: money.MustParse("51.25"), StartDate: "2021-09-28"}
 	testSuccessNextPaymentDate, err := time.Parse("2006-01-02", "2021-09-28")
 	if err != nil {
 		t.Errorf(err.Error())
 	}
 
-	nextPaymentDate, err := aggregateNextPaymentInfo(&testPaymentPlan, 0.00)
+	nextPaymentDate, err := aggregateNextPaymentInfo(&testPaymentPlan, money.Zero, time.UTC)
 
 	assert.Nil(t, err)
 	assert.Equal(t, nextPaymentDate, testSuccessNextPaymentDate)
 }
 
 func TestAggregateNextPaymentInfoSuccessBiweekly(t *testing.T) {
-	testPaymentPlan := trueaccordapiconnector.PaymentPlan{0, 0, 102.5, "BI_WEEKLY", 51.25, "2020-09-28"}
+	testPaymentPlan := trueaccordapiconnector.PaymentPlan{ID: 0, DebtID: 0, AmountToPay: money.MustParse("102.5"), InstallmentFrequency: "BI_WEEKLY", InstallmentAmount: money.MustParse("51.25"), StartDate: "2020-09-28"}
 	testSuccessNextPaymentDate, err := time.Parse("2006-01-02", "2020-10-12")
 	if err != nil {
 		t.Errorf(err.Error())
 	}
 
-	nextPaymentDate, err := aggregateNextPaymentInfo(&testPaymentPlan, 0.00)
+	nextPaymentDate, err := aggregateNextPaymentInfo(&testPaymentPlan, money.Zero, time.UTC)
 
 	assert.Nil(t, err)
 	assert.Equal(t, nextPaymentDate, testSuccessNextPaymentDate)
 }
 
 func TestAggregateNextPaymentInfoSuccessPartialInstallments(t *testing.T) {
-	testPaymentPlan := trueaccordapiconnector.PaymentPlan{0, 0, 110.00, "WEEKLY", 25.00, "2020-09-28"}
+	testPaymentPlan := trueaccordapiconnector.PaymentPlan{ID: 0, DebtID: 0, AmountToPay: money.MustParse("110.00"), InstallmentFrequency: "WEEKLY", InstallmentAmount: money.MustParse("25.00"), StartDate: "2020-09-28"}
 	testSuccessNextPaymentDate, err := time.Parse("2006-01-02", "2020-10-26")
 	if err != nil {
 		t.Errorf(err.Error())
 	}
 
-	nextPaymentDate, err := aggregateNextPaymentInfo(&testPaymentPlan, 0.00)
+	nextPaymentDate, err := aggregateNextPaymentInfo(&testPaymentPlan, money.Zero, time.UTC)
 
 	assert.Nil(t, err)
 	assert.Equal(t, nextPaymentDate, testSuccessNextPaymentDate)
 }
 
 func TestAggregateNextPaymentInfoSuccessPaymentsInProgress(t *testing.T) {
-	now := time.Now()
+	now := testNow
 	startDate := Bod(now.AddDate(0, 0, -9))
 	stringStartDate := startDate.Format("2006-01-02")
 
 	successNextPaymentDate := Bod(now.AddDate(0, 0, 5))
 
-	installmentAmount := 51.25
+	installmentAmount := money.MustParse("51.25")
 	amountOwed := installmentAmount * 4
 
-	testPaymentPlan := trueaccordapiconnector.PaymentPlan{0, 0, amountOwed, "WEEKLY", installmentAmount, stringStartDate}
+	testPaymentPlan := trueaccordapiconnector.PaymentPlan{ID: 0, DebtID: 0, AmountToPay: amountOwed, InstallmentFrequency: "WEEKLY", InstallmentAmount: installmentAmount, StartDate: stringStartDate}
 
-	nextPaymentDate, err := aggregateNextPaymentInfo(&testPaymentPlan, 0.00)
+	nextPaymentDate, err := aggregateNextPaymentInfo(&testPaymentPlan, money.Zero, time.UTC)
 
 	assert.Nil(t, err)
 	assert.Equal(t, successNextPaymentDate, nextPaymentDate)
 }
 
 func TestGetPaymentHistorySuccess(t *testing.T) {
-	testPaymentAmounts := []float64{51.25, 51.25}
-	testPayments := []trueaccordapiconnector.Payment{{testPaymentAmounts[0], "2020-09-29", 0}, {testPaymentAmounts[1], "2020-10-29", 0}}
+	testPaymentAmounts := []money.Money{money.MustParse("51.25"), money.MustParse("51.25")}
+	testPayments := []trueaccordapiconnector.Payment{{Amount: testPaymentAmounts[0], Date: "2020-09-29"}, {Amount: testPaymentAmounts[1], Date: "2020-10-29"}}
 
 	testSumResult := testPaymentAmounts[0] + testPaymentAmounts[1]
-	totalPayments := aggregatePayments(testPayments)
+	totalPayments := aggregatePayments(testPayments, time.UTC)
 	assert.Equal(t, testSumResult, totalPayments)
 }
 
+func TestGetPaymentHistorySuccessSkipsInvalidDate(t *testing.T) {
+	testPayments := []trueaccordapiconnector.Payment{
+		{Amount: money.MustParse("51.25"), Date: "2020-09-29"},
+		{Amount: money.MustParse("10"), Date: "10/01/2020"},
+		{Amount: money.MustParse("51.25"), Date: "2020-10-29"},
+	}
+
+	totalPayments := aggregatePayments(testPayments, time.UTC)
+	assert.Equal(t, money.MustParse("102.50"), totalPayments)
+}
+
 func TestGetPaymentHistorySuccessFutureDates(t *testing.T) {
-	now := time.Now()
+	now := testNow
 	firstDate := Bod(now.AddDate(0, 0, -18))
 	stringFirstDate := firstDate.Format("2006-01-02")
 
 	secondDate := Bod(now.AddDate(0, 0, 15))
 	stringSecondDate := secondDate.Format("2006-01-02")
 
-	testPaymentAmounts := []float64{51.25, 51.25}
+	testPaymentAmounts := []money.Money{money.MustParse("51.25"), money.MustParse("51.25")}
 
-	testPayments := []trueaccordapiconnector.Payment{{testPaymentAmounts[0], stringFirstDate, 0}, {testPaymentAmounts[1], stringSecondDate, 0}}
+	testPayments := []trueaccordapiconnector.Payment{{Amount: testPaymentAmounts[0], Date: stringFirstDate}, {Amount: testPaymentAmounts[1], Date: stringSecondDate}}
 
 	testSumResult := testPaymentAmounts[0]
-	totalPayments := aggregatePayments(testPayments)
+	totalPayments := aggregatePayments(testPayments, time.UTC)
 	assert.Equal(t, testSumResult, totalPayments)
 }
 
 func TestDebtDataEnrichmentSuccess(t *testing.T) {
-	now := time.Now()
+	now := testNow
 	nextPaymentDate := Bod(now.AddDate(0, 0, -18))
 	stringNextPaymentDate := nextPaymentDate.Format(time.RFC3339)
-	paymentPlan := trueaccordapiconnector.PaymentPlan{1, 1, 102.5, "WEEKLY", 10, "2020-10-10"}
-	totalPayments := 51.25
-	testDebt := trueaccordapiconnector.Debt{0, 102.5}
+	paymentPlan := trueaccordapiconnector.PaymentPlan{ID: 1, DebtID: 1, AmountToPay: money.MustParse("102.5"), InstallmentFrequency: "WEEKLY", InstallmentAmount: money.MustParse("10"), StartDate: "2020-10-10"}
+	totalPayments := money.MustParse("51.25")
+	testDebt := trueaccordapiconnector.Debt{ID: 0, Amount: money.MustParse("102.5")}
+
+	delinquency := reconciliation.Delinquency{Status: reconciliation.StatusCurrent}
 
-	successEnrichedDebt := EnrichedDebt{testDebt, true, "51.25", stringNextPaymentDate}
+	successEnrichedDebt := EnrichedDebt{Debt: testDebt, HasPaymentPlan: true, RemainingDebt: money.MustParse("51.25"), NextBillingDate: &nextPaymentDate, Delinquency: delinquency}
 
-	enrichedDebt := debtDataEnrichment(testDebt, nextPaymentDate, &paymentPlan, totalPayments)
+	enrichedDebt := debtDataEnrichment(testDebt, nextPaymentDate, &paymentPlan, totalPayments, delinquency)
 	assert.Equal(t, successEnrichedDebt, enrichedDebt)
+
+	legacy := enrichedDebt.Legacy()
+	assert.Equal(t, "51.25", legacy.RemainingDebt)
+	assert.Equal(t, stringNextPaymentDate, legacy.NextBillingDate)
 }
 
-func TestLogResultSuccess(t *testing.T) {
-	var loggedError bytes.Buffer
-	log.SetOutput(&loggedError)
+func TestAggregateNextPaymentInfoSuccessMonthly(t *testing.T) {
+	testPaymentPlan := trueaccordapiconnector.PaymentPlan{ID: 0, DebtID: 0, AmountToPay: money.MustParse("300"), InstallmentFrequency: "MONTHLY", InstallmentAmount: money.MustParse("100"), StartDate: "2020-01-31"}
+	testSuccessNextPaymentDate, err := time.Parse("2006-01-02", "2020-03-31")
+	if err != nil {
+		t.Errorf(err.Error())
+	}
+
+	nextPaymentDate, err := aggregateNextPaymentInfo(&testPaymentPlan, money.Zero, time.UTC)
+
+	assert.Nil(t, err)
+	assert.Equal(t, testSuccessNextPaymentDate, nextPaymentDate)
+}
+
+func TestAggregateNextPaymentInfoFailureUnhandledFrequency(t *testing.T) {
+	testPaymentPlan := trueaccordapiconnector.PaymentPlan{ID: 0, DebtID: 0, AmountToPay: money.MustParse("300"), InstallmentFrequency: "YEARLY", InstallmentAmount: money.MustParse("100"), StartDate: "2020-01-31"}
+
+	_, err := aggregateNextPaymentInfo(&testPaymentPlan, money.Zero, time.UTC)
+
+	assert.Equal(t, errors.New("Unhandled payment interval"), err)
+}
+
+func TestGetPaymentHistorySuccessAsOfPastDate(t *testing.T) {
+	enrichmentClock = clock.NewFixedClock(time.Date(2020, 10, 1, 0, 0, 0, 0, time.UTC))
 	defer func() {
-		log.SetOutput(os.Stderr)
+		enrichmentClock = clock.NewFixedClock(testNow)
 	}()
 
-	now := time.Now()
-	nextPaymentDate := Bod(now.AddDate(0, 0, -18))
-	stringNextPaymentDate := nextPaymentDate.Format(time.RFC3339)
-	testDebt := trueaccordapiconnector.Debt{0, 102.5}
-	testEnrichedDebt := EnrichedDebt{testDebt, true, "51.25", stringNextPaymentDate}
+	testPayments := []trueaccordapiconnector.Payment{
+		{Amount: money.MustParse("51.25"), Date: "2020-09-29"},
+		{Amount: money.MustParse("10"), Date: "2020-10-01"},
+		{Amount: money.MustParse("51.25"), Date: "2020-10-29"},
+	}
 
-	err := logResult(testEnrichedDebt)
-	assert.Nil(t, err, "LogResults should succeed with valid EnrichedDebt")
-	assert.NotNil(t, loggedError.String(), "LogResults should log the input to console")
+	totalPayments := aggregatePayments(testPayments, time.UTC)
+	assert.Equal(t, money.MustParse("61.25"), totalPayments)
+}
+
+func TestAggregateNextPaymentInfoSuccessAsOfPastDate(t *testing.T) {
+	enrichmentClock = clock.NewFixedClock(time.Date(2020, 10, 5, 0, 0, 0, 0, time.UTC))
+	defer func() {
+		enrichmentClock = clock.NewFixedClock(testNow)
+	}()
+
+	testPaymentPlan := trueaccordapiconnector.PaymentPlan{ID: 0, DebtID: 0, AmountToPay: money.MustParse("110.00"), InstallmentFrequency: "WEEKLY", InstallmentAmount: money.MustParse("25.00"), StartDate: "2020-09-28"}
+
+	nextPaymentDate, err := aggregateNextPaymentInfo(&testPaymentPlan, money.Zero, time.UTC)
+
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2020, 10, 5, 0, 0, 0, 0, time.UTC), nextPaymentDate)
+}
+
+func TestAggregateNextPaymentInfoSuccessRolledOffWeekend(t *testing.T) {
+	previousConfig, previousCalendar := appConfig, holidayCalendar
+	defer func() {
+		appConfig, holidayCalendar = previousConfig, previousCalendar
+	}()
+	holidayCalendar = calendar.FederalReserve()
+	appConfig.RollConvention = calendar.RollFollowing
+
+	// Due every Saturday; testNow is Friday 2020-10-30
+	testPaymentPlan := trueaccordapiconnector.PaymentPlan{ID: 0, DebtID: 0, AmountToPay: money.MustParse("125"), InstallmentFrequency: "WEEKLY", InstallmentAmount: money.MustParse("25"), StartDate: "2020-10-03"}
+
+	nextPaymentDate, err := aggregateNextPaymentInfo(&testPaymentPlan, money.Zero, time.UTC)
+
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2020, 11, 2, 0, 0, 0, 0, time.UTC), nextPaymentDate)
+}
+
+func TestReconcilePlanSuccessNotLateBeforeRolledDueDate(t *testing.T) {
+	previousConfig, previousCalendar := appConfig, holidayCalendar
+	enrichmentClock = clock.NewFixedClock(time.Date(2020, 10, 12, 10, 0, 0, 0, time.UTC))
+	defer func() {
+		appConfig, holidayCalendar = previousConfig, previousCalendar
+		enrichmentClock = clock.NewFixedClock(testNow)
+	}()
+	holidayCalendar = calendar.FederalReserve()
+
+	// Due Saturday 2020-10-10, and Monday 2020-10-12 is Columbus Day
+	testPaymentPlan := trueaccordapiconnector.PaymentPlan{ID: 0, DebtID: 0, AmountToPay: money.MustParse("50"), InstallmentFrequency: "WEEKLY", InstallmentAmount: money.MustParse("25"), StartDate: "2020-10-10"}
+
+	appConfig.RollConvention = calendar.RollNone
+	res, err := reconcilePlan(&testPaymentPlan, nil, time.UTC)
+	assert.Nil(t, err)
+	assert.Equal(t, reconciliation.StatusLate, res.Status)
+
+	appConfig.RollConvention = calendar.RollFollowing
+	res, err = reconcilePlan(&testPaymentPlan, nil, time.UTC)
+	assert.Nil(t, err)
+	assert.Equal(t, reconciliation.StatusCurrent, res.Status)
+	assert.Equal(t, time.Date(2020, 10, 13, 0, 0, 0, 0, time.UTC), res.Installments[0].DueDate)
 }
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"true_accord/shared/httphelpers"
+	"true_accord/shared/money"
+	"true_accord/shared/reconciliation"
+	trueaccordapiconnector "true_accord/shared/trueaccordapi"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// progressInterval ... is how many debts are processed between progress reports
+const progressInterval = 1000
+
+// enrichedResult ... is the outcome of enriching the debt at a position in the run
+type enrichedResult struct {
+	index int
+	res   EnrichedDebt
+	ok    bool
+}
+
+// enrichDebt ... fetches the payment plans and payments for a debt and returns its enriched result.
+// ok is false when the debt should be left out of the output.
+func enrichDebt(ctx context.Context, debt trueaccordapiconnector.Debt) (res EnrichedDebt, ok bool) {
+	history, err := fetchPaymentPlanHistory(ctx, debt)
+	if err != nil {
+		err.LogError()
+		return
+	}
+
+	return enrichPaymentPlans(debt, history), true
+}
+
+// fetchPaymentPlanHistory ... returns every payment plan of a debt with the payments attributed to each.
+// Failing to fetch the payments of a plan is logged and treated as no payments. Payments are attributed by their
+// calendar date in the debt's time zone.
+func fetchPaymentPlanHistory(ctx context.Context, debt trueaccordapiconnector.Debt) (history []reconciliation.PlanPayments, err *httphelpers.APIError) {
+	paymentPlans, err := trueAccordAPIConnector.GetPaymentPlans(ctx, debt.ID)
+	if err != nil {
+		return
+	}
+
+	var payments []trueaccordapiconnector.Payment
+	for _, paymentPlan := range paymentPlans {
+		planPayments, paymentsErr := trueAccordAPIConnector.GetPayments(ctx, paymentPlan.ID)
+		if paymentsErr != nil {
+			paymentsErr.LogError()
+		}
+		payments = append(payments, planPayments...)
+	}
+
+	return reconciliation.History(paymentPlans, payments, nowIn(location(debt, nil))), nil
+}
+
+// enrichPaymentPlans ... returns the enriched debt given its payment plan history. The next payment and delinquency
+// come from the active plan, while the debt balance and accrued interest count the payments made to every plan.
+func enrichPaymentPlans(debt trueaccordapiconnector.Debt, history []reconciliation.PlanPayments) EnrichedDebt {
+	active := reconciliation.Active(history)
+	if active == nil {
+		res := EnrichedDebt{
+			Debt:             debt,
+			HasPaymentPlan:   false,
+			Delinquency:      reconciliation.NoPaymentPlan(),
+			OriginalDebt:     debt.Amount,
+			SettlementAmount: debt.Amount,
+		}
+		res.accrueInterest(nil, nowIn(location(debt, nil)))
+		res.setBalance(money.Zero)
+		return res
+	}
+
+	res := enrichActivePlan(debt, &active.PaymentPlan, active.Payments)
+
+	// The payments to the active plan are already totalled
+	totalPaid := res.PaidTowardPlan
+	for i := range history {
+		if &history[i] != active {
+			totalPaid += aggregatePayments(history[i].Payments, location(debt, &history[i].PaymentPlan))
+		}
+	}
+
+	res.PaymentPlans = len(history)
+	res.accrueInterest(history, nowIn(location(debt, &active.PaymentPlan)))
+	res.setBalance(totalPaid)
+	return res
+}
+
+// enrichActivePlan ... returns the debt enriched with its active payment plan and the payments to it. The accrued
+// interest and balances, which depend on the whole history, are left to enrichPaymentPlans.
+func enrichActivePlan(debt trueaccordapiconnector.Debt, paymentPlan *trueaccordapiconnector.PaymentPlan, payments []trueaccordapiconnector.Payment) EnrichedDebt {
+	loc := location(debt, paymentPlan)
+	totalPaid := aggregatePayments(payments, loc)
+
+	nextPaymentDate, findPaymentErr := aggregateNextPaymentInfo(paymentPlan, totalPaid, loc)
+	if findPaymentErr != nil {
+		err := httphelpers.NewAPIError(findPaymentErr, fmt.Sprintf("Failed to process payment plan for debtID: %d", debt.ID))
+		err.LogError()
+	}
+
+	reconciled, reconcileErr := reconcilePlan(paymentPlan, payments, loc)
+	if reconcileErr != nil {
+		err := httphelpers.NewAPIError(reconcileErr, fmt.Sprintf("Failed to reconcile payments for debtID: %d", debt.ID))
+		err.LogError()
+	}
+
+	// A plan that can't be scheduled still reports its balances, with the FAILED status and no next payment
+	var res EnrichedDebt
+	if findPaymentErr != nil || reconcileErr != nil {
+		res = EnrichedDebt{Debt: debt, HasPaymentPlan: true, Delinquency: reconciliation.Failed()}
+	} else {
+		res = debtDataEnrichment(debt, nextPaymentDate, paymentPlan, totalPaid, reconciled.Delinquency)
+		res.installments = reconciled.Installments
+	}
+
+	res.ActivePaymentPlanID = &paymentPlan.ID
+	res.OriginalDebt = debt.Amount
+	res.SettlementAmount = paymentPlan.AmountToPay
+	res.DiscountForgiven = money.Max(debt.Amount-paymentPlan.AmountToPay, money.Zero)
+	res.PaidTowardPlan = totalPaid
+	res.RemainingOnPlan = money.Max(paymentPlan.AmountToPay-totalPaid, money.Zero)
+	res.paymentPlan = paymentPlan
+	res.assessFees(paymentPlan, nowIn(loc))
+
+	return res
+}
+
+// enrichDebts ... enriches debts with up to concurrency workers and passes the results to emit in debt ID order.
+// progress is called with the number of debts processed so far. Returns the context error if ctx is cancelled first.
+func enrichDebts(ctx context.Context, debts []trueaccordapiconnector.Debt, concurrency int, progress func(done, total int), emit func(EnrichedDebt)) error {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	ordered := make([]trueaccordapiconnector.Debt, len(debts))
+	copy(ordered, debts)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].ID < ordered[j].ID
+	})
+
+	// Stop the workers and wait for in-flight debts to finish before returning
+	var workers sync.WaitGroup
+	defer workers.Wait()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	jobs := make(chan int)
+	results := make(chan enrichedResult, concurrency)
+
+	for w := 0; w < concurrency; w++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for index := range jobs {
+				res, ok := enrichDebt(ctx, ordered[index])
+				select {
+				case results <- enrichedResult{index, res, ok}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(jobs)
+		for index := range ordered {
+			select {
+			case jobs <- index:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	go func() {
+		workers.Wait()
+		close(results)
+	}()
+
+	// Hold finished results until every earlier debt has been emitted
+	pending := make(map[int]enrichedResult)
+	next := 0
+	for next < len(ordered) {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case result, open := <-results:
+			if !open {
+				return ctx.Err()
+			}
+
+			pending[result.index] = result
+			for {
+				ready, found := pending[next]
+				if !found {
+					break
+				}
+
+				delete(pending, next)
+				next++
+
+				if ready.ok {
+					emit(ready.res)
+				}
+				progress(next, len(ordered))
+			}
+		}
+	}
+
+	return nil
+}
+
+// logProgress ... logs enrichment progress every progressInterval debts and at completion
+func logProgress(done, total int) {
+	if done%progressInterval != 0 && done != total {
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"Message": fmt.Sprintf("Enriched %d of %d debts", done, total),
+	}).Info()
+}
@@ -0,0 +1,387 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"true_accord/shared/clock"
+	"true_accord/shared/config"
+	"true_accord/shared/fees"
+	"true_accord/shared/httphelpers"
+	"true_accord/shared/interest"
+	"true_accord/shared/money"
+	"true_accord/shared/reconciliation"
+	trueaccordapiconnector "true_accord/shared/trueaccordapi"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeConnector ... is an in-memory TrueAccordAPIConnector keyed by debt ID and payment plan ID
+type fakeConnector struct {
+	debts        []trueaccordapiconnector.Debt
+	paymentPlans map[int64][]trueaccordapiconnector.PaymentPlan
+	payments     map[int64][]trueaccordapiconnector.Payment
+	delay        func(debtID int64) time.Duration
+	// fullScans counts the calls listing every debt, payment plan or payment
+	fullScans int
+}
+
+func (f *fakeConnector) GetDebts(ctx context.Context) ([]trueaccordapiconnector.Debt, *httphelpers.APIError) {
+	f.fullScans++
+	return f.debts, nil
+}
+
+func (f *fakeConnector) GetDebtByID(ctx context.Context, debtID int64) (*trueaccordapiconnector.Debt, *httphelpers.APIError) {
+	for i := range f.debts {
+		if f.debts[i].ID == debtID {
+			return &f.debts[i], nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeConnector) StreamDebts(ctx context.Context, handlePage func([]trueaccordapiconnector.Debt) error) *httphelpers.APIError {
+	f.fullScans++
+	if err := handlePage(f.debts); err != nil {
+		return httphelpers.NewAPIError(err, "Failed to GET debts")
+	}
+	return nil
+}
+
+func (f *fakeConnector) GetPaymentPlans(ctx context.Context, debtID int64) ([]trueaccordapiconnector.PaymentPlan, *httphelpers.APIError) {
+	if f.delay != nil {
+		time.Sleep(f.delay(debtID))
+	}
+
+	if debtID < 0 {
+		return nil, httphelpers.NewAPIError(errors.New("Test failure"), "Failed to GET payment plans")
+	}
+	return f.paymentPlans[debtID], nil
+}
+
+func (f *fakeConnector) GetPaymentPlanByID(ctx context.Context, paymentPlanID int64) (*trueaccordapiconnector.PaymentPlan, *httphelpers.APIError) {
+	for _, debtPlans := range f.paymentPlans {
+		for i := range debtPlans {
+			if debtPlans[i].ID == paymentPlanID {
+				return &debtPlans[i], nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeConnector) GetPayments(ctx context.Context, paymentPlanID int64) ([]trueaccordapiconnector.Payment, *httphelpers.APIError) {
+	return f.payments[paymentPlanID], nil
+}
+
+func (f *fakeConnector) GetAllPaymentPlans(ctx context.Context) (paymentPlans []trueaccordapiconnector.PaymentPlan, err *httphelpers.APIError) {
+	f.fullScans++
+	for _, debtPlans := range f.paymentPlans {
+		paymentPlans = append(paymentPlans, debtPlans...)
+	}
+	return
+}
+
+func (f *fakeConnector) GetAllPayments(ctx context.Context) (payments []trueaccordapiconnector.Payment, err *httphelpers.APIError) {
+	f.fullScans++
+	for _, planPayments := range f.payments {
+		payments = append(payments, planPayments...)
+	}
+	return
+}
+
+// newTestPortfolio ... returns a connector with count debts, every other one on a weekly payment plan
+func newTestPortfolio(count int) *fakeConnector {
+	connector := &fakeConnector{
+		paymentPlans: make(map[int64][]trueaccordapiconnector.PaymentPlan),
+		payments:     make(map[int64][]trueaccordapiconnector.Payment),
+	}
+
+	// Add debts in reverse so the pipeline has to order them
+	for id := int64(count - 1); id >= 0; id-- {
+		connector.debts = append(connector.debts, trueaccordapiconnector.Debt{ID: id, Amount: money.FromCents(10000 + id)})
+		if id%2 == 0 {
+			connector.paymentPlans[id] = []trueaccordapiconnector.PaymentPlan{{ID: id, DebtID: id, AmountToPay: money.MustParse("100"), InstallmentFrequency: "WEEKLY", InstallmentAmount: money.MustParse("25"), StartDate: "2020-10-01"}}
+			connector.payments[id] = []trueaccordapiconnector.Payment{{Amount: money.MustParse("25"), Date: "2020-10-01", PaymentPlanID: id}}
+		}
+	}
+
+	return connector
+}
+
+// enrichPaymentPlan ... returns the enriched debt given its only payment plan (nil if it has none) and payments
+func enrichPaymentPlan(debt trueaccordapiconnector.Debt, paymentPlan *trueaccordapiconnector.PaymentPlan, payments []trueaccordapiconnector.Payment) EnrichedDebt {
+	if paymentPlan == nil {
+		return enrichPaymentPlans(debt, nil)
+	}
+	return enrichPaymentPlans(debt, []reconciliation.PlanPayments{{PaymentPlan: *paymentPlan, Active: true, Payments: payments}})
+}
+
+func collectEnrichedDebts(t *testing.T, concurrency int) []EnrichedDebt {
+	var res []EnrichedDebt
+	err := enrichDebts(context.Background(), trueAccordAPIConnector.(*fakeConnector).debts, concurrency, func(done, total int) {}, func(enriched EnrichedDebt) {
+		res = append(res, enriched)
+	})
+
+	assert.Nil(t, err)
+	return res
+}
+
+func TestEnrichDebtsSuccessMatchesSequentialRun(t *testing.T) {
+	connector := newTestPortfolio(50)
+	connector.delay = func(debtID int64) time.Duration {
+		return time.Duration(50-debtID) * 100 * time.Microsecond
+	}
+	trueAccordAPIConnector = connector
+
+	sequential := collectEnrichedDebts(t, 1)
+	concurrent := collectEnrichedDebts(t, 8)
+
+	assert.Equal(t, 50, len(sequential))
+	assert.Equal(t, sequential, concurrent)
+	for i, enriched := range concurrent {
+		assert.Equal(t, int64(i), enriched.ID)
+	}
+}
+
+func TestEnrichDebtsSuccessIndexedConnectorMatchesPerDebtRequests(t *testing.T) {
+	connector := newTestPortfolio(20)
+	trueAccordAPIConnector = connector
+	perDebt := collectEnrichedDebts(t, 4)
+
+	indexedConnector, err := trueaccordapiconnector.NewIndexedConnector(context.Background(), connector)
+	assert.Nil(t, err)
+
+	trueAccordAPIConnector = indexedConnector
+	var bulk []EnrichedDebt
+	pipelineErr := enrichDebts(context.Background(), connector.debts, 4, func(done, total int) {}, func(enriched EnrichedDebt) {
+		bulk = append(bulk, enriched)
+	})
+
+	assert.Nil(t, pipelineErr)
+	assert.Equal(t, perDebt, bulk)
+}
+
+func TestEnrichDebtsSuccessSkipsFailedDebts(t *testing.T) {
+	connector := newTestPortfolio(3)
+	connector.debts = append(connector.debts, trueaccordapiconnector.Debt{ID: -1, Amount: money.MustParse("10")})
+	trueAccordAPIConnector = connector
+
+	res := collectEnrichedDebts(t, 2)
+
+	assert.Equal(t, 3, len(res))
+	assert.Equal(t, int64(0), res[0].ID)
+}
+
+func TestEnrichDebtsSuccessReportsProgress(t *testing.T) {
+	trueAccordAPIConnector = newTestPortfolio(10)
+
+	var reported []int
+	err := enrichDebts(context.Background(), trueAccordAPIConnector.(*fakeConnector).debts, 3, func(done, total int) {
+		assert.Equal(t, 10, total)
+		reported = append(reported, done)
+	}, func(EnrichedDebt) {})
+
+	assert.Nil(t, err)
+	assert.Equal(t, []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, reported)
+}
+
+func TestEnrichDebtsFailureCancelled(t *testing.T) {
+	connector := newTestPortfolio(100)
+	connector.delay = func(int64) time.Duration {
+		return time.Millisecond
+	}
+	trueAccordAPIConnector = connector
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	emitted := 0
+	err := enrichDebts(ctx, connector.debts, 4, func(done, total int) {}, func(EnrichedDebt) {
+		emitted++
+		if emitted == 5 {
+			cancel()
+		}
+	})
+
+	assert.Equal(t, context.Canceled, err)
+	assert.True(t, emitted < 100)
+}
+
+func TestEnrichPaymentPlanSuccessSettlementBalances(t *testing.T) {
+	previousConfig := appConfig
+	defer func() {
+		appConfig = previousConfig
+	}()
+
+	debt := trueaccordapiconnector.Debt{ID: 0, Amount: money.MustParse("150")}
+	paymentPlan := trueaccordapiconnector.PaymentPlan{ID: 0, DebtID: 0, AmountToPay: money.MustParse("100"), InstallmentFrequency: "WEEKLY", InstallmentAmount: money.MustParse("25"), StartDate: "2020-10-01"}
+	payments := []trueaccordapiconnector.Payment{{Amount: money.MustParse("25"), Date: "2020-10-01", PaymentPlanID: 0}}
+
+	appConfig.RemainingPolicy = config.RemainingPolicyPlan
+	res := enrichPaymentPlan(debt, &paymentPlan, payments)
+
+	assert.Equal(t, money.MustParse("150"), res.OriginalDebt)
+	assert.Equal(t, money.MustParse("100"), res.SettlementAmount)
+	assert.Equal(t, money.MustParse("50"), res.DiscountForgiven)
+	assert.Equal(t, money.MustParse("25"), res.PaidTowardPlan)
+	assert.Equal(t, money.MustParse("75"), res.RemainingOnPlan)
+	assert.Equal(t, money.MustParse("125"), res.DebtBalance)
+	assert.Equal(t, money.MustParse("75"), res.RemainingDebt)
+
+	appConfig.RemainingPolicy = config.RemainingPolicyDebt
+	res = enrichPaymentPlan(debt, &paymentPlan, payments)
+
+	assert.Equal(t, money.MustParse("125"), res.RemainingDebt, "The debt policy ignores the settlement discount")
+	assert.Equal(t, money.MustParse("75"), res.RemainingOnPlan)
+
+	noPlan := enrichPaymentPlan(debt, nil, nil)
+	assert.Equal(t, money.MustParse("150"), noPlan.RemainingDebt)
+	assert.Equal(t, money.MustParse("150"), noPlan.SettlementAmount)
+	assert.Equal(t, money.Zero, noPlan.DiscountForgiven)
+}
+
+func TestEnrichPaymentPlanSuccessTimeZones(t *testing.T) {
+	// 8pm on 2020-10-30 in Los Angeles, already 2020-10-31 in UTC
+	enrichmentClock = clock.NewFixedClock(time.Date(2020, 10, 31, 3, 0, 0, 0, time.UTC))
+	defer func() {
+		enrichmentClock = clock.NewFixedClock(testNow)
+	}()
+
+	debt := trueaccordapiconnector.Debt{ID: 0, Amount: money.MustParse("125"), TimeZone: "America/Los_Angeles"}
+	paymentPlan := trueaccordapiconnector.PaymentPlan{ID: 0, DebtID: 0, AmountToPay: money.MustParse("125"), InstallmentFrequency: "WEEKLY", InstallmentAmount: money.MustParse("25"), StartDate: "2020-10-03"}
+	payments := []trueaccordapiconnector.Payment{
+		{Amount: money.MustParse("25"), Date: "2020-10-03", PaymentPlanID: 0},
+		{Amount: money.MustParse("25"), Date: "2020-10-31", PaymentPlanID: 0},
+	}
+
+	res := enrichPaymentPlan(debt, &paymentPlan, payments)
+
+	assert.Equal(t, money.MustParse("25"), res.TotalPaid, "The payment dated tomorrow in Los Angeles isn't counted yet")
+	assert.Equal(t, reconciliation.StatusLate, res.Status)
+	assert.Equal(t, 20, res.DaysPastDue)
+
+	out, err := json.Marshal(res.NextBillingDate)
+	assert.Nil(t, err)
+	assert.Equal(t, `"2020-10-31T00:00:00-07:00"`, string(out))
+
+	paymentPlan.TimeZone = "UTC"
+	res = enrichPaymentPlan(debt, &paymentPlan, payments)
+	assert.Equal(t, money.MustParse("50"), res.TotalPaid, "The plan's time zone overrides the debt's")
+
+	paymentPlan.TimeZone = ""
+	debt.TimeZone = "Mars/Olympus_Mons"
+	assert.Equal(t, time.UTC, location(debt, &paymentPlan), "Unknown time zones fall back to the configured default")
+}
+
+func TestLocationSuccessLogsUnknownTimeZoneOnce(t *testing.T) {
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer func() {
+		log.SetOutput(os.Stderr)
+	}()
+
+	// A name no other test uses, as the time zones are cached for the whole run
+	debt := trueaccordapiconnector.Debt{ID: 0, TimeZone: "Mars/Gale_Crater"}
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, time.UTC, location(debt, nil))
+	}
+
+	assert.Equal(t, 1, strings.Count(logged.String(), "Ignoring unknown time_zone"))
+}
+
+func TestEnrichPaymentPlanSuccessLateFees(t *testing.T) {
+	previousRules := feeRules
+	defer func() {
+		feeRules = previousRules
+	}()
+
+	planID := int64(0)
+	feeRules = &fees.Rules{
+		GraceDays: 5,
+		LateFee:   fees.LateFee{Flat: money.MustParse("10")},
+		Waivers:   []fees.Waiver{{PaymentPlanID: &planID, Installments: []int{4}, Reason: "Goodwill"}},
+	}
+
+	debt := trueaccordapiconnector.Debt{ID: 0, Amount: money.MustParse("100")}
+	paymentPlan := trueaccordapiconnector.PaymentPlan{ID: planID, DebtID: 0, AmountToPay: money.MustParse("100"), InstallmentFrequency: "WEEKLY", InstallmentAmount: money.MustParse("25"), StartDate: "2020-10-01"}
+	payments := []trueaccordapiconnector.Payment{{Amount: money.MustParse("25"), Date: "2020-10-01", PaymentPlanID: planID}}
+
+	res := enrichPaymentPlan(debt, &paymentPlan, payments)
+
+	// Installments 2 to 4 are past their grace periods as of testNow, and the fee on installment 4 is waived
+	assert.Equal(t, money.MustParse("20"), res.LateFees)
+	assert.Equal(t, money.MustParse("10"), res.FeesWaived)
+	assert.Equal(t, money.MustParse("75"), res.RemainingDebt)
+	assert.Equal(t, money.MustParse("95"), res.AmountOwed)
+	assert.Equal(t, 3, len(res.feeAssessment.Fees))
+
+	noPlan := enrichPaymentPlan(debt, nil, nil)
+	assert.Equal(t, money.Zero, noPlan.LateFees)
+	assert.Equal(t, money.MustParse("100"), noPlan.AmountOwed)
+}
+
+func TestEnrichPaymentPlanSuccessAccruedInterest(t *testing.T) {
+	debt := trueaccordapiconnector.Debt{ID: 0, Amount: money.MustParse("1000"), APR: 0.1825, AccrualStartDate: "2020-01-01"}
+
+	// 303 days to testNow at 18.25% ACT/365
+	noPlan := enrichPaymentPlan(debt, nil, nil)
+	assert.Equal(t, money.MustParse("151.50"), noPlan.AccruedInterest)
+	assert.Equal(t, money.MustParse("1151.50"), noPlan.PayoffAmount)
+
+	// Interest stops once the plan starts, 182 days in
+	paymentPlan := trueaccordapiconnector.PaymentPlan{ID: 0, DebtID: 0, AmountToPay: money.MustParse("1000"), InstallmentFrequency: "MONTHLY", InstallmentAmount: money.MustParse("250"), StartDate: "2020-07-01"}
+	res := enrichPaymentPlan(debt, &paymentPlan, nil)
+	assert.Equal(t, money.MustParse("91"), res.AccruedInterest)
+	assert.Equal(t, money.MustParse("1091"), res.PayoffAmount)
+
+	debt.DayCount = interest.Thirty360
+	res = enrichPaymentPlan(debt, &paymentPlan, nil)
+	assert.Equal(t, money.MustParse("91.25"), res.AccruedInterest, "180 days over a 360 day year")
+
+	debt.AccrualStartDate = "01/01/2020"
+	res = enrichPaymentPlan(debt, &paymentPlan, nil)
+	assert.Equal(t, money.Zero, res.AccruedInterest, "Invalid terms accrue nothing")
+	assert.Equal(t, res.AmountOwed, res.PayoffAmount)
+}
+
+func TestEnrichPaymentPlansSuccessAccruedInterestOnBalance(t *testing.T) {
+	debt := trueaccordapiconnector.Debt{ID: 0, Amount: money.MustParse("1000"), APR: 0.1825, AccrualStartDate: "2020-01-01"}
+	paymentPlans := []trueaccordapiconnector.PaymentPlan{
+		{ID: 1, DebtID: 0, AmountToPay: money.MustParse("1000"), InstallmentFrequency: "MONTHLY", InstallmentAmount: money.MustParse("250"), StartDate: "2020-04-01"},
+		{ID: 2, DebtID: 0, AmountToPay: money.MustParse("800"), InstallmentFrequency: "MONTHLY", InstallmentAmount: money.MustParse("200"), StartDate: "2020-07-01"},
+	}
+	payments := []trueaccordapiconnector.Payment{{Amount: money.MustParse("200"), Date: "2020-03-01", PaymentPlanID: 1}}
+
+	// 60 days on 1000.00 then 122 days on 800.00 until the plan starts
+	res := enrichPaymentPlan(debt, &paymentPlans[1], payments)
+	assert.Equal(t, money.MustParse("78.80"), res.AccruedInterest)
+
+	// Interest stops once the superseded plan starts: 60 days on 1000.00 then 31 days on 800.00
+	history := reconciliation.History(paymentPlans, payments, testNow)
+	res = enrichPaymentPlans(debt, history)
+	assert.Equal(t, int64(2), *res.ActivePaymentPlanID)
+	assert.Equal(t, money.MustParse("42.40"), res.AccruedInterest)
+	assert.Equal(t, res.AmountOwed+money.MustParse("42.40"), res.PayoffAmount)
+}
+
+func TestEnrichPaymentPlansSuccessLogsInvalidTermsOnce(t *testing.T) {
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer func() {
+		log.SetOutput(os.Stderr)
+	}()
+
+	debt := trueaccordapiconnector.Debt{ID: 0, Amount: money.MustParse("1000"), APR: 0.1825, AccrualStartDate: "01/01/2020"}
+	paymentPlan := trueaccordapiconnector.PaymentPlan{ID: 0, DebtID: 0, AmountToPay: money.MustParse("1000"), InstallmentFrequency: "MONTHLY", InstallmentAmount: money.MustParse("250"), StartDate: "2020-07-01"}
+
+	res := enrichPaymentPlan(debt, &paymentPlan, nil)
+	assert.Equal(t, money.Zero, res.AccruedInterest)
+	assert.Equal(t, 1, strings.Count(logged.String(), "Failed to accrue interest"))
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"true_accord/shared/config"
+	"true_accord/shared/money"
+	"true_accord/shared/reconciliation"
+	trueaccordapiconnector "true_accord/shared/trueaccordapi"
+)
+
+// LegacyEnrichedDebt ... is an enriched debt in output version 1: remaining_amount is a decimal string and
+// next_payment_due_date is the string "null" when nothing more is due. Only the debt's id and amount are kept,
+// leaving out its time zone and interest terms.
+type LegacyEnrichedDebt struct {
+	ID     int64       `json:"id"`
+	Amount money.Money `json:"amount"`
+
+	HasPaymentPlan  bool   `json:"is_in_payment_plan"`
+	RemainingDebt   string `json:"remaining_amount"`
+	NextBillingDate string `json:"next_payment_due_date"`
+
+	reconciliation.Delinquency
+}
+
+// Legacy ... returns the enriched debt in output version 1
+func (res EnrichedDebt) Legacy() LegacyEnrichedDebt {
+	legacy := LegacyEnrichedDebt{
+		ID:              res.ID,
+		Amount:          res.Amount,
+		HasPaymentPlan:  res.HasPaymentPlan,
+		RemainingDebt:   res.RemainingDebt.String(),
+		NextBillingDate: "null",
+		Delinquency:     res.Delinquency,
+	}
+
+	if res.NextBillingDate != nil {
+		legacy.NextBillingDate = res.NextBillingDate.Format(time.RFC3339)
+	}
+
+	return legacy
+}
+
+// LegacyDebtDetail ... is DebtDetail in output version 1
+type LegacyDebtDetail struct {
+	LegacyEnrichedDebt
+
+	PaymentPlan  *trueaccordapiconnector.PaymentPlan `json:"payment_plan"`
+	Payments     []trueaccordapiconnector.Payment    `json:"payments"`
+	Installments []reconciliation.InstallmentStatus  `json:"installments"`
+}
+
+// presentEnrichedDebt ... returns the enriched debt in the configured output version
+func presentEnrichedDebt(res EnrichedDebt) interface{} {
+	if appConfig.OutputVersion == config.OutputVersionLegacy {
+		return res.Legacy()
+	}
+	return res
+}
+
+// presentDebtDetail ... returns the debt detail in the configured output version
+func presentDebtDetail(detail DebtDetail) interface{} {
+	if appConfig.OutputVersion == config.OutputVersionLegacy {
+		return LegacyDebtDetail{
+			LegacyEnrichedDebt: detail.Legacy(),
+			PaymentPlan:        detail.PaymentPlan,
+			Payments:           detail.Payments,
+			Installments:       detail.Installments,
+		}
+	}
+	return detail
+}
+
+// enrichedDebtSchema ... is the JSON Schema of an enriched debt in output version 2
+const enrichedDebtSchema = `{
+  "$schema": "http://json-schema.org/draft-07/schema#",
+  "$id": "urn:true_accord:enriched_debt:v2",
+  "title": "Enriched debt",
+  "description": "A debt with its payment plan, next payment and delinquency information (output version 2). Amounts are dollars with two decimal places.",
+  "type": "object",
+  "additionalProperties": false,
+  "required": [
+    "id",
+    "amount",
+    "is_in_payment_plan",
+    "remaining_amount",
+    "next_payment_due_date",
+    "days_past_due",
+    "amount_past_due",
+    "missed_installments",
+    "delinquency_status",
+    "payment_plan_id",
+    "payment_plan_count",
+    "total_paid",
+    "debt_balance",
+    "original_debt",
+    "settlement_amount",
+    "discount_forgiven",
+    "paid_toward_plan",
+    "remaining_on_plan",
+    "late_fees",
+    "fees_waived",
+    "amount_owed",
+    "accrued_interest",
+    "payoff_amount"
+  ],
+  "properties": {
+    "id": {
+      "type": "integer"
+    },
+    "amount": {
+      "type": "number",
+      "description": "Debt amount"
+    },
+    "time_zone": {
+      "type": "string",
+      "description": "IANA time zone of the debt's dates, when the API sets one"
+    },
+    "apr": {
+      "type": "number",
+      "minimum": 0,
+      "description": "Annual simple interest rate as a fraction, when the debt accrues interest"
+    },
+    "accrual_start_date": {
+      "type": "string",
+      "format": "date",
+      "description": "Date interest starts accruing, when the debt accrues interest"
+    },
+    "day_count": {
+      "type": "string",
+      "description": "Day count convention interest accrues under, ACT/365 or 30/360 (ACT/365 if missing)"
+    },
+    "is_in_payment_plan": {
+      "type": "boolean"
+    },
+    "remaining_amount": {
+      "type": "number",
+      "minimum": 0,
+      "description": "remaining_on_plan, or debt_balance with the debt remaining policy or without a payment plan"
+    },
+    "next_payment_due_date": {
+      "type": ["string", "null"],
+      "format": "date-time",
+      "description": "Due date of the next installment, or null when nothing more is due"
+    },
+    "days_past_due": {
+      "type": "integer",
+      "minimum": 0
+    },
+    "amount_past_due": {
+      "type": "number",
+      "minimum": 0
+    },
+    "missed_installments": {
+      "type": "integer",
+      "minimum": 0
+    },
+    "delinquency_status": {
+      "type": "string",
+      "enum": ["CURRENT", "LATE", "DEFAULTED", "PAID_OFF", "NO_PAYMENT_PLAN", "FAILED"]
+    },
+    "payment_plan_id": {
+      "type": ["integer", "null"],
+      "description": "Active payment plan the next payment and delinquency are reported for, or null without a payment plan"
+    },
+    "payment_plan_count": {
+      "type": "integer",
+      "minimum": 0,
+      "description": "Number of payment plans in the debt's history, including broken plans"
+    },
+    "total_paid": {
+      "type": "number",
+      "minimum": 0,
+      "description": "Amount paid to date across every payment plan"
+    },
+    "debt_balance": {
+      "type": "number",
+      "minimum": 0,
+      "description": "Debt amount less total_paid"
+    },
+    "original_debt": {
+      "type": "number",
+      "description": "Debt amount before any settlement"
+    },
+    "settlement_amount": {
+      "type": "number",
+      "description": "Amount the active payment plan settles the debt for, or the debt amount without a payment plan"
+    },
+    "discount_forgiven": {
+      "type": "number",
+      "minimum": 0,
+      "description": "Debt amount forgiven by settling for the active payment plan"
+    },
+    "paid_toward_plan": {
+      "type": "number",
+      "minimum": 0,
+      "description": "Amount paid to date toward the active payment plan"
+    },
+    "remaining_on_plan": {
+      "type": "number",
+      "minimum": 0,
+      "description": "Amount left to pay on the active payment plan"
+    },
+    "late_fees": {
+      "type": "number",
+      "minimum": 0,
+      "description": "Late fees accrued on the active payment plan under the fee rules, net of waived fees"
+    },
+    "fees_waived": {
+      "type": "number",
+      "minimum": 0,
+      "description": "Late fees waived on the active payment plan"
+    },
+    "amount_owed": {
+      "type": "number",
+      "minimum": 0,
+      "description": "remaining_amount plus late_fees"
+    },
+    "accrued_interest": {
+      "type": "number",
+      "minimum": 0,
+      "description": "Simple interest accrued under the debt's interest terms on the debt amount less the payments made, until its first payment plan started"
+    },
+    "payoff_amount": {
+      "type": "number",
+      "minimum": 0,
+      "description": "amount_owed plus accrued_interest"
+    }
+  }
+}`
+
+// runSchema ... writes the JSON Schema of the enrich output
+func runSchema(ctx context.Context, args []string) int {
+	if len(args) != 0 {
+		return usageError("schema takes no arguments, got %q", args)
+	}
+
+	if _, err := fmt.Fprintln(stdout, enrichedDebtSchema); err != nil {
+		return failure(err, "Failed to write the schema")
+	}
+	return exitOK
+}
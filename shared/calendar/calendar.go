@@ -0,0 +1,144 @@
+package calendar
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// DateLayout ... is the format of the dates in a holiday file
+const DateLayout = "2006-01-02"
+
+// Roll conventions
+const (
+	// RollNone ... leaves due dates on weekends and holidays unchanged
+	RollNone = "none"
+	// RollFollowing ... moves a due date to the next business day
+	RollFollowing = "following"
+	// RollModifiedFollowing ... moves a due date to the next business day, unless that is in the next month,
+	// in which case it moves to the previous business day
+	RollModifiedFollowing = "modified_following"
+	// RollPreceding ... moves a due date to the previous business day
+	RollPreceding = "preceding"
+)
+
+// Conventions ... lists every roll convention
+var Conventions = []string{RollNone, RollFollowing, RollModifiedFollowing, RollPreceding}
+
+// ErrUnknownConvention ... is returned by Adjust for a convention that isn't one of Conventions
+var ErrUnknownConvention = errors.New("Unknown roll convention")
+
+// Calendar ... is a set of holidays; every day that isn't a holiday, Saturday or Sunday is a business day
+type Calendar struct {
+	holidays map[string]string
+}
+
+// IsConvention ... reports whether convention is one of Conventions
+func IsConvention(convention string) bool {
+	for _, known := range Conventions {
+		if convention == known {
+			return true
+		}
+	}
+	return false
+}
+
+// FederalReserve ... returns the built in calendar of US Federal Reserve holidays
+func FederalReserve() *Calendar {
+	c, err := Parse(strings.NewReader(federalReserveHolidays))
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// Load ... returns the holiday calendar in the file at path, or the Federal Reserve calendar if path is empty
+func Load(path string) (*Calendar, error) {
+	if path == "" {
+		return FederalReserve(), nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return Parse(file)
+}
+
+// Parse ... reads a holiday file: one holiday per line as a YYYY-MM-DD date, optionally followed by its name.
+// Blank lines and lines starting with # are ignored.
+func Parse(r io.Reader) (*Calendar, error) {
+	c := &Calendar{holidays: make(map[string]string)}
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.SplitN(text, " ", 2)
+		if _, err := time.Parse(DateLayout, fields[0]); err != nil {
+			return nil, fmt.Errorf("line %d: expected a YYYY-MM-DD date, got %q", line, fields[0])
+		}
+
+		name := ""
+		if len(fields) == 2 {
+			name = strings.TrimSpace(fields[1])
+		}
+		c.holidays[fields[0]] = name
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Holiday ... returns the name of the holiday on the calendar date of t in its own location, if it is one
+func (c *Calendar) Holiday(t time.Time) (name string, isHoliday bool) {
+	name, isHoliday = c.holidays[t.Format(DateLayout)]
+	return
+}
+
+// IsBusinessDay ... reports whether the calendar date of t in its own location is a business day
+func (c *Calendar) IsBusinessDay(t time.Time) bool {
+	if weekday := t.Weekday(); weekday == time.Saturday || weekday == time.Sunday {
+		return false
+	}
+	_, isHoliday := c.Holiday(t)
+	return !isHoliday
+}
+
+// Adjust ... returns date rolled to a business day by convention, keeping its time of day and location
+func (c *Calendar) Adjust(date time.Time, convention string) (time.Time, error) {
+	switch convention {
+	case RollNone:
+		return date, nil
+	case RollFollowing:
+		return c.roll(date, 1), nil
+	case RollPreceding:
+		return c.roll(date, -1), nil
+	case RollModifiedFollowing:
+		if following := c.roll(date, 1); following.Month() == date.Month() {
+			return following, nil
+		}
+		return c.roll(date, -1), nil
+	default:
+		return date, ErrUnknownConvention
+	}
+}
+
+// roll ... steps date by step days until it is a business day
+func (c *Calendar) roll(date time.Time, step int) time.Time {
+	for !c.IsBusinessDay(date) {
+		date = date.AddDate(0, 0, step)
+	}
+	return date
+}
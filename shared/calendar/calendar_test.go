@@ -0,0 +1,112 @@
+package calendar
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func date(t *testing.T, value string) time.Time {
+	d, err := time.Parse(DateLayout, value)
+	if err != nil {
+		t.Fatalf("Failed to parse test date %s", value)
+	}
+	return d
+}
+
+func adjust(t *testing.T, c *Calendar, value, convention string) string {
+	adjusted, err := c.Adjust(date(t, value), convention)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return adjusted.Format(DateLayout)
+}
+
+func TestFederalReserveSuccess(t *testing.T) {
+	c := FederalReserve()
+
+	name, isHoliday := c.Holiday(date(t, "2020-11-26"))
+	assert.True(t, isHoliday)
+	assert.Equal(t, "Thanksgiving Day", name)
+
+	assert.False(t, c.IsBusinessDay(date(t, "2021-07-05")), "Independence Day on a Sunday is observed on Monday")
+	assert.True(t, c.IsBusinessDay(date(t, "2020-07-03")), "Independence Day on a Saturday isn't observed on Friday")
+	assert.False(t, c.IsBusinessDay(date(t, "2020-10-31")), "Saturday")
+	assert.True(t, c.IsBusinessDay(date(t, "2020-10-30")))
+}
+
+func TestAdjustSuccessConventions(t *testing.T) {
+	c := FederalReserve()
+
+	// Saturday 2020-10-10, followed by Columbus Day on Monday 2020-10-12
+	assert.Equal(t, "2020-10-10", adjust(t, c, "2020-10-10", RollNone))
+	assert.Equal(t, "2020-10-13", adjust(t, c, "2020-10-10", RollFollowing))
+	assert.Equal(t, "2020-10-13", adjust(t, c, "2020-10-10", RollModifiedFollowing))
+	assert.Equal(t, "2020-10-09", adjust(t, c, "2020-10-10", RollPreceding))
+
+	// Saturday 2020-10-31: following would move into November
+	assert.Equal(t, "2020-11-02", adjust(t, c, "2020-10-31", RollFollowing))
+	assert.Equal(t, "2020-10-30", adjust(t, c, "2020-10-31", RollModifiedFollowing))
+
+	assert.Equal(t, "2020-10-30", adjust(t, c, "2020-10-30", RollFollowing), "Business days are unchanged")
+}
+
+func TestAdjustSuccessKeepsLocation(t *testing.T) {
+	losAngeles, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	adjusted, err := FederalReserve().Adjust(time.Date(2020, 10, 31, 0, 0, 0, 0, losAngeles), RollFollowing)
+
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2020, 11, 2, 0, 0, 0, 0, losAngeles), adjusted)
+}
+
+func TestAdjustFailureUnknownConvention(t *testing.T) {
+	_, err := FederalReserve().Adjust(date(t, "2020-10-31"), "nearest")
+	assert.Equal(t, ErrUnknownConvention, err)
+}
+
+func TestParseSuccess(t *testing.T) {
+	c, err := Parse(strings.NewReader("# Company holidays\n\n2020-10-30 Founders Day\n2020-12-24\n"))
+
+	assert.Nil(t, err)
+	assert.False(t, c.IsBusinessDay(date(t, "2020-10-30")))
+	assert.False(t, c.IsBusinessDay(date(t, "2020-12-24")))
+	assert.True(t, c.IsBusinessDay(date(t, "2020-11-26")), "Only the listed holidays are observed")
+}
+
+func TestParseFailureInvalidDate(t *testing.T) {
+	_, err := Parse(strings.NewReader("2020-10-30\n10/31/2020 Halloween\n"))
+	assert.EqualError(t, err, `line 2: expected a YYYY-MM-DD date, got "10/31/2020"`)
+}
+
+func TestLoadSuccess(t *testing.T) {
+	dir, err := ioutil.TempDir("", "calendar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "holidays.txt")
+	if err = ioutil.WriteFile(path, []byte("2020-10-30 Founders Day\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := Load(path)
+	assert.Nil(t, err)
+	assert.False(t, c.IsBusinessDay(date(t, "2020-10-30")))
+
+	c, err = Load("")
+	assert.Nil(t, err)
+	assert.False(t, c.IsBusinessDay(date(t, "2020-11-26")), "The Federal Reserve calendar is the default")
+
+	_, err = Load(filepath.Join(dir, "missing.txt"))
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,34 @@
+package clock
+
+import "time"
+
+// Clock ... is the source of the current time for date calculations
+type Clock interface {
+	Now() time.Time
+}
+
+type realClock struct{}
+
+type fixedClock struct {
+	now time.Time
+}
+
+// NewClock ... returns a Clock backed by the system wall clock
+func NewClock() Clock {
+	return realClock{}
+}
+
+// NewFixedClock ... returns a Clock that always reports now, for reports as of a past date and for tests
+func NewFixedClock(now time.Time) Clock {
+	return fixedClock{now}
+}
+
+// Now ... returns the current system time
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// Now ... returns the fixed time
+func (c fixedClock) Now() time.Time {
+	return c.now
+}
@@ -0,0 +1,24 @@
+package clock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewFixedClockSuccess(t *testing.T) {
+	now := time.Date(2020, 10, 30, 0, 0, 0, 0, time.UTC)
+
+	c := NewFixedClock(now)
+
+	assert.Equal(t, now, c.Now())
+	assert.Equal(t, now, c.Now())
+}
+
+func TestNewClockSuccess(t *testing.T) {
+	before := time.Now()
+	now := NewClock().Now()
+
+	assert.False(t, now.Before(before))
+}
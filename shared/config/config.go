@@ -0,0 +1,723 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"true_accord/shared/calendar"
+	"true_accord/shared/forecast"
+	"true_accord/shared/output"
+	"true_accord/shared/ratelimit"
+	"true_accord/shared/reconciliation"
+	"true_accord/shared/schedule"
+	"true_accord/shared/trueaccordapi"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Output versions
+const (
+	// OutputVersionLegacy ... writes remaining_amount as a string and a missing next_payment_due_date as "null"
+	OutputVersionLegacy = 1
+	// OutputVersionTyped ... writes amounts as numbers and a missing next_payment_due_date as null
+	OutputVersionTyped = 2
+)
+
+// Remaining policies decide which balance is reported as remaining_amount
+const (
+	// RemainingPolicyPlan ... reports what is left to pay on the active payment plan
+	RemainingPolicyPlan = "plan"
+	// RemainingPolicyDebt ... reports the debt amount less everything paid to any payment plan, ignoring settlement discounts
+	RemainingPolicyDebt = "debt"
+)
+
+// RemainingPolicies ... lists every remaining policy
+var RemainingPolicies = []string{RemainingPolicyPlan, RemainingPolicyDebt}
+
+// FileEnv ... names the environment variable holding the path of the configuration file
+const FileEnv = "TRUEACCORD_CONFIG_FILE"
+
+// Config ... is the validated configuration of a run, loaded from defaults, an optional YAML or JSON file,
+// TRUEACCORD_* environment variables and command line flags, in increasing order of precedence
+type Config struct {
+	// APIURL is the base URL of the TrueAccord API
+	APIURL string
+
+	// Request settings
+	Timeout     time.Duration
+	MaxAttempts int
+	PageSize    int
+	Bulk        bool
+	// RateLimits maps an endpoint (one of trueaccordapi.Endpoints) to its "RATE" or "RATE:BURST" requests per second
+	RateLimits map[string]string
+
+	// Credentials authenticate requests to the TrueAccord API; requests are unauthenticated if their Type is empty
+	Credentials trueaccordapi.Credentials
+	// CredentialsFile is a JSON file of the credentials not set anywhere else, or empty
+	CredentialsFile string
+
+	// Enrichment settings
+	Concurrency int
+	// AsOf is the date the portfolio is reported as of, or the zero time to report it as of today
+	AsOf time.Time
+	// Location is the time zone of debts and payment plans that don't set their own time_zone
+	Location *time.Location
+	// HolidayCalendar is the holiday file due dates are rolled around, or empty for the Federal Reserve holidays
+	HolidayCalendar string
+	// RollConvention moves due dates on weekends and holidays to a business day, one of calendar.Conventions
+	RollConvention string
+	// FeeRules is the YAML or JSON file of grace period and late fee rules, or empty to charge no fees
+	FeeRules string
+
+	// Output settings
+	Format string
+	// Output is the file results are written to, or stdout if empty or "-"
+	Output        string
+	OutputVersion int
+	Progress      bool
+	// RemainingPolicy is the balance reported as remaining_amount, one of RemainingPolicies
+	RemainingPolicy string
+
+	// Filters
+	// Statuses keeps only debts with one of these delinquency statuses, or all debts if empty
+	Statuses []string
+	// DebtIDs keeps only these debts, or all debts if empty
+	DebtIDs []int64
+
+	// Forecast settings
+	HorizonDays int
+	Period      string
+	// Haircuts maps a delinquency status to the probability (0 to 1) that its installments are never paid
+	Haircuts map[string]float64
+}
+
+// Default ... returns the configuration used for settings that aren't set anywhere else
+func Default() Config {
+	return Config{
+		Timeout:         trueaccordapi.DefaultTimeout,
+		MaxAttempts:     trueaccordapi.DefaultRetryPolicy.MaxAttempts,
+		Concurrency:     8,
+		Location:        time.UTC,
+		RollConvention:  calendar.RollNone,
+		Format:          output.NDJSON,
+		OutputVersion:   OutputVersionTyped,
+		HorizonDays:     90,
+		Period:          forecast.PeriodWeek,
+		RemainingPolicy: RemainingPolicyPlan,
+	}
+}
+
+// setting ... is one configuration value, named name in the file and as a flag, and env in the environment
+type setting struct {
+	name   string
+	env    string
+	usage  string
+	isBool bool
+	set    func(c *Config, value string) error
+}
+
+var settings = []setting{
+	{
+		name:  "api_url",
+		env:   "TRUEACCORD_API_URL",
+		usage: "Base URL of the TrueAccord API",
+		set: func(c *Config, value string) error {
+			c.APIURL = strings.TrimRight(value, "/")
+			return nil
+		},
+	},
+	{
+		name:  "timeout",
+		env:   "TRUEACCORD_TIMEOUT",
+		usage: "Timeout of each TrueAccord API request attempt",
+		set: func(c *Config, value string) (err error) {
+			c.Timeout, err = time.ParseDuration(value)
+			return
+		},
+	},
+	{
+		name:  "max_attempts",
+		env:   "TRUEACCORD_MAX_ATTEMPTS",
+		usage: "Attempts per TrueAccord API request before giving up (1 disables retries)",
+		set: func(c *Config, value string) (err error) {
+			c.MaxAttempts, err = strconv.Atoi(value)
+			return
+		},
+	},
+	{
+		name:  "page_size",
+		env:   "TRUEACCORD_PAGE_SIZE",
+		usage: "Number of items per TrueAccord API page (0 requests each list in one response)",
+		set: func(c *Config, value string) (err error) {
+			c.PageSize, err = strconv.Atoi(value)
+			return
+		},
+	},
+	{
+		name:   "bulk",
+		env:    "TRUEACCORD_BULK",
+		usage:  "Fetch all payment plans and payments up front instead of per debt",
+		isBool: true,
+		set: func(c *Config, value string) (err error) {
+			c.Bulk, err = strconv.ParseBool(value)
+			return
+		},
+	},
+	rateLimitSetting("debts"),
+	rateLimitSetting("payment_plans"),
+	rateLimitSetting("payments"),
+	{
+		name:  "credentials_file",
+		env:   "TRUEACCORD_CREDENTIALS_FILE",
+		usage: "JSON file of the TrueAccord API credentials not set by other settings",
+		set: func(c *Config, value string) error {
+			c.CredentialsFile = value
+			return nil
+		},
+	},
+	{
+		name:  "auth_type",
+		env:   "TRUEACCORD_AUTH_TYPE",
+		usage: "TrueAccord API authentication: bearer, basic or hmac (default none)",
+		set: func(c *Config, value string) error {
+			c.Credentials.Type = strings.ToLower(value)
+			return nil
+		},
+	},
+	credentialSetting("api_token", "Fixed bearer token", func(c *trueaccordapi.Credentials) *string { return &c.Token }),
+	credentialSetting("api_token_file", "File of the bearer token, re-read when the API answers 401", func(c *trueaccordapi.Credentials) *string { return &c.TokenFile }),
+	credentialSetting("token_url", "OAuth2 client credentials token endpoint of bearer tokens", func(c *trueaccordapi.Credentials) *string { return &c.TokenURL }),
+	credentialSetting("client_id", "OAuth2 client ID", func(c *trueaccordapi.Credentials) *string { return &c.ClientID }),
+	credentialSetting("client_secret", "OAuth2 client secret", func(c *trueaccordapi.Credentials) *string { return &c.ClientSecret }),
+	credentialSetting("api_username", "Basic authentication username", func(c *trueaccordapi.Credentials) *string { return &c.Username }),
+	credentialSetting("api_password", "Basic authentication password", func(c *trueaccordapi.Credentials) *string { return &c.Password }),
+	credentialSetting("hmac_key_id", "HMAC signing key ID", func(c *trueaccordapi.Credentials) *string { return &c.KeyID }),
+	credentialSetting("hmac_secret", "HMAC signing secret", func(c *trueaccordapi.Credentials) *string { return &c.Secret }),
+	{
+		name:  "concurrency",
+		env:   "TRUEACCORD_CONCURRENCY",
+		usage: "Number of debts enriched in parallel",
+		set: func(c *Config, value string) (err error) {
+			c.Concurrency, err = strconv.Atoi(value)
+			return
+		},
+	},
+	{
+		name:  "as_of",
+		env:   "TRUEACCORD_AS_OF",
+		usage: "Report the portfolio as of a past date (YYYY-MM-DD) instead of today",
+		set: func(c *Config, value string) (err error) {
+			if value == "" {
+				c.AsOf = time.Time{}
+				return nil
+			}
+			c.AsOf, err = time.Parse(schedule.DateLayout, value)
+			if err != nil {
+				return errors.New("expected YYYY-MM-DD")
+			}
+			return nil
+		},
+	},
+	{
+		name:  "time_zone",
+		env:   "TRUEACCORD_TIME_ZONE",
+		usage: "IANA time zone (such as America/Los_Angeles) of debts and payment plans without their own time_zone",
+		set: func(c *Config, value string) (err error) {
+			c.Location, err = time.LoadLocation(value)
+			if err != nil {
+				return errors.New("expected an IANA time zone such as America/Los_Angeles")
+			}
+			return nil
+		},
+	},
+	{
+		name:  "holiday_calendar",
+		env:   "TRUEACCORD_HOLIDAY_CALENDAR",
+		usage: "File of YYYY-MM-DD holidays, one per line, due dates are rolled around (default US Federal Reserve holidays)",
+		set: func(c *Config, value string) error {
+			c.HolidayCalendar = value
+			return nil
+		},
+	},
+	{
+		name:  "roll_convention",
+		env:   "TRUEACCORD_ROLL_CONVENTION",
+		usage: "Business day a due date on a weekend or holiday moves to: " + strings.Join(calendar.Conventions, ", "),
+		set: func(c *Config, value string) error {
+			c.RollConvention = strings.ToLower(value)
+			return nil
+		},
+	},
+	{
+		name:  "fee_rules",
+		env:   "TRUEACCORD_FEE_RULES",
+		usage: "YAML or JSON file of grace period and late fee rules (default no fees)",
+		set: func(c *Config, value string) error {
+			c.FeeRules = value
+			return nil
+		},
+	},
+	{
+		name:  "format",
+		env:   "TRUEACCORD_FORMAT",
+		usage: "Output format: " + strings.Join(output.Formats, ", "),
+		set: func(c *Config, value string) error {
+			c.Format = strings.ToLower(value)
+			return nil
+		},
+	},
+	{
+		name:  "output",
+		env:   "TRUEACCORD_OUTPUT",
+		usage: "File the results are written to (default stdout)",
+		set: func(c *Config, value string) error {
+			c.Output = value
+			return nil
+		},
+	},
+	{
+		name:  "output_version",
+		env:   "TRUEACCORD_OUTPUT_VERSION",
+		usage: "Output version: 2 for typed amounts and null dates, 1 for the legacy string fields",
+		set: func(c *Config, value string) (err error) {
+			c.OutputVersion, err = strconv.Atoi(value)
+			return
+		},
+	},
+	{
+		name:  "remaining_policy",
+		env:   "TRUEACCORD_REMAINING_POLICY",
+		usage: "Balance reported as remaining_amount: plan (left to pay on the active payment plan) or debt (debt amount less everything paid)",
+		set: func(c *Config, value string) error {
+			c.RemainingPolicy = strings.ToLower(value)
+			return nil
+		},
+	},
+	{
+		name:   "progress",
+		env:    "TRUEACCORD_PROGRESS",
+		usage:  "Log enrichment progress to stderr",
+		isBool: true,
+		set: func(c *Config, value string) (err error) {
+			c.Progress, err = strconv.ParseBool(value)
+			return
+		},
+	},
+	{
+		name:  "status",
+		env:   "TRUEACCORD_STATUS",
+		usage: "Only report debts with these comma separated delinquency statuses",
+		set: func(c *Config, value string) error {
+			c.Statuses = nil
+			for _, status := range splitList(value) {
+				status = strings.ToUpper(status)
+				if !isStatus(status) {
+					return errors.New("expected one of " + strings.Join(reconciliation.Statuses, ", "))
+				}
+				c.Statuses = append(c.Statuses, status)
+			}
+			return nil
+		},
+	},
+	{
+		name:  "debt_ids",
+		env:   "TRUEACCORD_DEBT_IDS",
+		usage: "Only report the debts with these comma separated IDs",
+		set: func(c *Config, value string) error {
+			c.DebtIDs = nil
+			for _, id := range splitList(value) {
+				debtID, err := strconv.ParseInt(id, 10, 64)
+				if err != nil {
+					return err
+				}
+				c.DebtIDs = append(c.DebtIDs, debtID)
+			}
+			return nil
+		},
+	},
+	{
+		name:  "horizon_days",
+		env:   "TRUEACCORD_HORIZON_DAYS",
+		usage: "Number of days forecast from today",
+		set: func(c *Config, value string) (err error) {
+			c.HorizonDays, err = strconv.Atoi(value)
+			return
+		},
+	},
+	{
+		name:  "period",
+		env:   "TRUEACCORD_PERIOD",
+		usage: "Forecast period: " + strings.Join(forecast.Periods, ", "),
+		set: func(c *Config, value string) error {
+			c.Period = strings.ToLower(value)
+			return nil
+		},
+	},
+	{
+		name:  "haircuts",
+		env:   "TRUEACCORD_HAIRCUTS",
+		usage: "Comma separated STATUS=PROBABILITY default probabilities (0 to 1) the forecast discounts installments by",
+		set: func(c *Config, value string) error {
+			c.Haircuts = make(map[string]float64)
+			for _, haircut := range splitList(value) {
+				parts := strings.SplitN(haircut, "=", 2)
+				status := strings.ToUpper(strings.TrimSpace(parts[0]))
+				if len(parts) != 2 || !isStatus(status) {
+					return fmt.Errorf("expected STATUS=PROBABILITY with a status among %s, got %q", strings.Join(reconciliation.Statuses, ", "), haircut)
+				}
+
+				probability, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+				if err != nil {
+					return err
+				}
+				if probability < 0 || probability > 1 {
+					return fmt.Errorf("expected a probability between 0 and 1 for %s, got %v", status, probability)
+				}
+				c.Haircuts[status] = probability
+			}
+			return nil
+		},
+	},
+}
+
+// rateLimitSetting ... returns the rate limit setting of a TrueAccord API endpoint, e.g. rate_limit_payment_plans
+func rateLimitSetting(endpoint string) setting {
+	name := "rate_limit_" + endpoint
+	return setting{
+		name:  name,
+		env:   "TRUEACCORD_" + strings.ToUpper(name),
+		usage: "Client-side rate limit of the " + endpoint + " endpoint, as RATE or RATE:BURST requests per second (default none)",
+		set: func(c *Config, value string) error {
+			if _, err := ratelimit.Parse(value); err != nil {
+				return err
+			}
+
+			if c.RateLimits == nil {
+				c.RateLimits = make(map[string]string)
+			}
+			c.RateLimits[endpoint] = value
+			return nil
+		},
+	}
+}
+
+// credentialSetting ... returns the setting of the credential field returns, e.g. api_token (TRUEACCORD_API_TOKEN)
+func credentialSetting(name, usage string, field func(c *trueaccordapi.Credentials) *string) setting {
+	return setting{
+		name:  name,
+		env:   "TRUEACCORD_" + strings.ToUpper(name),
+		usage: usage,
+		set: func(c *Config, value string) error {
+			*field(&c.Credentials) = value
+			return nil
+		},
+	}
+}
+
+// splitList ... returns the non-empty comma separated items of value
+func splitList(value string) (items []string) {
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return
+}
+
+func isRemainingPolicy(policy string) bool {
+	for _, known := range RemainingPolicies {
+		if policy == known {
+			return true
+		}
+	}
+	return false
+}
+
+func isStatus(status string) bool {
+	for _, known := range reconciliation.Statuses {
+		if status == known {
+			return true
+		}
+	}
+	return false
+}
+
+// flagName ... returns the command line flag of a setting, e.g. --max-attempts for max_attempts
+func (s setting) flagName() string {
+	return strings.Replace(s.name, "_", "-", -1)
+}
+
+// apply ... sets the setting from source, naming the source in any error
+func (s setting) apply(c *Config, value, source string) error {
+	if err := s.set(c, value); err != nil {
+		return fmt.Errorf("Invalid %s %q from %s: %v", s.name, value, source, cleanError(err))
+	}
+	return nil
+}
+
+// cleanError ... strips the repeated input from strconv and time parse errors
+func cleanError(err error) error {
+	if numErr, ok := err.(*strconv.NumError); ok {
+		return numErr.Err
+	}
+	return err
+}
+
+// flagValue ... records a flag so it can be applied after the file and environment
+type flagValue struct {
+	setting setting
+	pending *[]pendingFlag
+	value   string
+}
+
+type pendingFlag struct {
+	setting setting
+	value   string
+}
+
+func (f *flagValue) String() string {
+	if f == nil {
+		return ""
+	}
+	return f.value
+}
+
+func (f *flagValue) Set(value string) error {
+	f.value = value
+	*f.pending = append(*f.pending, pendingFlag{f.setting, value})
+	return nil
+}
+
+func (f *flagValue) IsBoolFlag() bool {
+	return f.setting.isBool
+}
+
+// newFlagSet ... returns a flag set with a flag per setting, plus --config naming the configuration file.
+// Flags are recorded in pending and applied by Load.
+func newFlagSet(name string, configPath *string, pending *[]pendingFlag) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	fs.StringVar(configPath, "config", "", "Path of a YAML or JSON configuration file (also "+FileEnv+")")
+
+	for _, s := range settings {
+		fs.Var(&flagValue{setting: s, pending: pending}, s.flagName(), fmt.Sprintf("%s (also %s)", s.usage, s.env))
+	}
+
+	return fs
+}
+
+// PrintDefaults ... writes the usage of every flag accepted by Load to w
+func PrintDefaults(w io.Writer) {
+	var configPath string
+	var pending []pendingFlag
+
+	fs := newFlagSet("", &configPath, &pending)
+	fs.SetOutput(w)
+	fs.PrintDefaults()
+}
+
+// Load ... returns the configuration from args (without the program name), the environment read through getenv
+// and the configuration file, along with the arguments left after the flags. The configuration is validated.
+// flag.ErrHelp is returned for -h and --help; flags may be given before and after positional arguments.
+func Load(name string, args []string, getenv func(string) string) (c Config, remaining []string, err error) {
+	var configPath string
+	var pending []pendingFlag
+
+	fs := newFlagSet(name, &configPath, &pending)
+	for {
+		if err = fs.Parse(args); err != nil {
+			return
+		}
+		parsed := len(args) - fs.NArg()
+		if fs.NArg() == 0 || (parsed > 0 && args[parsed-1] == "--") {
+			break
+		}
+
+		// Keep the positional argument and carry on parsing the flags after it
+		remaining = append(remaining, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+	remaining = append(remaining, fs.Args()...)
+
+	c = Default()
+
+	if configPath == "" {
+		configPath = getenv(FileEnv)
+	}
+	if configPath != "" {
+		if err = c.loadFile(configPath); err != nil {
+			return
+		}
+	}
+
+	for _, s := range settings {
+		if value := getenv(s.env); value != "" {
+			if err = s.apply(&c, value, s.env); err != nil {
+				return
+			}
+		}
+	}
+
+	for _, f := range pending {
+		if err = f.setting.apply(&c, f.value, "--"+f.setting.flagName()); err != nil {
+			return
+		}
+	}
+
+	if c.CredentialsFile != "" {
+		if err = c.Credentials.LoadFile(c.CredentialsFile); err != nil {
+			err = fmt.Errorf("Invalid credentials_file %q: %v", c.CredentialsFile, err)
+			return
+		}
+	}
+
+	if err = c.Validate(); err != nil {
+		return
+	}
+
+	return c, remaining, nil
+}
+
+// loadFile ... applies the settings in a YAML or JSON file (JSON is valid YAML)
+func (c *Config) loadFile(path string) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	values := make(map[string]interface{})
+	if err = yaml.Unmarshal(b, &values); err != nil {
+		return fmt.Errorf("Failed to parse configuration file %s: %v", path, err)
+	}
+
+	var unknown []string
+	for key := range values {
+		if findSetting(key) == nil {
+			unknown = append(unknown, key)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("Unknown settings in configuration file %s: %s", path, strings.Join(unknown, ", "))
+	}
+
+	for _, s := range settings {
+		value, ok := values[s.name]
+		if !ok || value == nil {
+			continue
+		}
+		if err = s.apply(c, fileValue(value), path); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// fileValue ... returns a decoded file value in the form it would have in a flag or environment variable
+func fileValue(value interface{}) string {
+	// YAML resolves unquoted dates to timestamps
+	if t, ok := value.(time.Time); ok {
+		return t.Format(schedule.DateLayout)
+	}
+
+	if list, ok := value.([]interface{}); ok {
+		items := make([]string, len(list))
+		for i, item := range list {
+			items[i] = fileValue(item)
+		}
+		return strings.Join(items, ",")
+	}
+
+	// Maps such as haircuts are written as comma separated KEY=VALUE items
+	if dict, ok := value.(map[string]interface{}); ok {
+		items := make([]string, 0, len(dict))
+		for key, item := range dict {
+			items = append(items, key+"="+fileValue(item))
+		}
+		sort.Strings(items)
+		return strings.Join(items, ",")
+	}
+
+	return fmt.Sprint(value)
+}
+
+func findSetting(name string) *setting {
+	for i := range settings {
+		if settings[i].name == name {
+			return &settings[i]
+		}
+	}
+	return nil
+}
+
+// Validate ... returns an error describing the first invalid setting
+func (c Config) Validate() error {
+	if c.APIURL == "" {
+		return errors.New("api_url is required: set TRUEACCORD_API_URL, --api-url or api_url in the configuration file")
+	}
+
+	URL, err := url.Parse(c.APIURL)
+	if err != nil || (URL.Scheme != "http" && URL.Scheme != "https") || URL.Host == "" {
+		return fmt.Errorf("Invalid api_url %q, expected an http or https URL", c.APIURL)
+	}
+
+	if c.Timeout <= 0 {
+		return fmt.Errorf("Invalid timeout %s, expected a positive duration", c.Timeout)
+	}
+	if c.MaxAttempts < 1 {
+		return fmt.Errorf("Invalid max_attempts %d, expected at least 1", c.MaxAttempts)
+	}
+	if c.PageSize < 0 {
+		return fmt.Errorf("Invalid page_size %d, expected 0 or more", c.PageSize)
+	}
+	if c.Concurrency < 1 {
+		return fmt.Errorf("Invalid concurrency %d, expected at least 1", c.Concurrency)
+	}
+
+	for endpoint, spec := range c.RateLimits {
+		if _, err := ratelimit.Parse(spec); err != nil {
+			return fmt.Errorf("Invalid rate_limit_%s %q: %v", endpoint, spec, err)
+		}
+	}
+	if _, err := c.Credentials.Authenticator(); err != nil {
+		return fmt.Errorf("Invalid credentials: %v", err)
+	}
+
+	if c.Location == nil {
+		return errors.New("Invalid time_zone, expected an IANA time zone such as America/Los_Angeles")
+	}
+
+	if !calendar.IsConvention(c.RollConvention) {
+		return fmt.Errorf("Invalid roll_convention %q, expected one of %s", c.RollConvention, strings.Join(calendar.Conventions, ", "))
+	}
+
+	if c.OutputVersion != OutputVersionLegacy && c.OutputVersion != OutputVersionTyped {
+		return fmt.Errorf("Invalid output_version %d, expected %d or %d", c.OutputVersion, OutputVersionLegacy, OutputVersionTyped)
+	}
+
+	if !output.IsFormat(c.Format) {
+		return fmt.Errorf("Invalid format %q, expected one of %s", c.Format, strings.Join(output.Formats, ", "))
+	}
+
+	if !isRemainingPolicy(c.RemainingPolicy) {
+		return fmt.Errorf("Invalid remaining_policy %q, expected one of %s", c.RemainingPolicy, strings.Join(RemainingPolicies, ", "))
+	}
+
+	if c.HorizonDays < 1 {
+		return fmt.Errorf("Invalid horizon_days %d, expected at least 1", c.HorizonDays)
+	}
+	if !forecast.IsPeriod(c.Period) {
+		return fmt.Errorf("Invalid period %q, expected one of %s", c.Period, strings.Join(forecast.Periods, ", "))
+	}
+
+	return nil
+}
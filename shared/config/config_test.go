@@ -0,0 +1,233 @@
+package config
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"true_accord/shared/trueaccordapi"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testEnv ... returns a getenv reading from env instead of the process environment
+func testEnv(env map[string]string) func(string) string {
+	return func(key string) string {
+		return env[key]
+	}
+}
+
+func writeConfigFile(t *testing.T, name, contents string) (path string, cleanup func()) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path = filepath.Join(dir, name)
+	if err = ioutil.WriteFile(path, []byte(contents), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path, func() {
+		os.RemoveAll(dir)
+	}
+}
+
+func TestLoadSuccessDefaults(t *testing.T) {
+	c, remaining, err := Load("true_accord", []string{"enrich"}, testEnv(map[string]string{
+		"TRUEACCORD_API_URL": "http://localhost:3000/",
+	}))
+
+	expected := Default()
+	expected.APIURL = "http://localhost:3000"
+
+	assert.Nil(t, err)
+	assert.Equal(t, expected, c)
+	assert.Equal(t, []string{"enrich"}, remaining)
+}
+
+func TestLoadSuccessPrecedence(t *testing.T) {
+	path, cleanup := writeConfigFile(t, "config.yaml", `
+api_url: http://file.local
+timeout: 5s
+max_attempts: 5
+page_size: 50
+concurrency: 2
+as_of: 2020-10-15
+time_zone: America/Los_Angeles
+holiday_calendar: holidays.txt
+roll_convention: Modified_Following
+fee_rules: fees.yaml
+progress: true
+format: json
+output: debts.json
+debt_ids: [1, 2]
+period: month
+remaining_policy: DEBT
+haircuts:
+  late: 0.25
+  DEFAULTED: 0.9
+`)
+	defer cleanup()
+
+	c, _, err := Load("true_accord", []string{"--config", path, "--concurrency", "16", "--bulk", "--status", "late, defaulted", "--output-version", "1"}, testEnv(map[string]string{
+		"TRUEACCORD_API_URL":      "https://env.local",
+		"TRUEACCORD_CONCURRENCY":  "4",
+		"TRUEACCORD_MAX_ATTEMPTS": "1",
+		"TRUEACCORD_HORIZON_DAYS": "30",
+	}))
+
+	losAngeles, locErr := time.LoadLocation("America/Los_Angeles")
+	if locErr != nil {
+		t.Fatal(locErr)
+	}
+
+	assert.Nil(t, err)
+	assert.Equal(t, Config{
+		APIURL:          "https://env.local",
+		Timeout:         5 * time.Second,
+		MaxAttempts:     1,
+		PageSize:        50,
+		Bulk:            true,
+		Concurrency:     16,
+		AsOf:            time.Date(2020, 10, 15, 0, 0, 0, 0, time.UTC),
+		Location:        losAngeles,
+		HolidayCalendar: "holidays.txt",
+		RollConvention:  "modified_following",
+		FeeRules:        "fees.yaml",
+		Format:          "json",
+		Output:          "debts.json",
+		OutputVersion:   OutputVersionLegacy,
+		Progress:        true,
+		RemainingPolicy: "debt",
+		Statuses:        []string{"LATE", "DEFAULTED"},
+		DebtIDs:         []int64{1, 2},
+		HorizonDays:     30,
+		Period:          "month",
+		Haircuts:        map[string]float64{"LATE": 0.25, "DEFAULTED": 0.9},
+	}, c)
+}
+
+func TestLoadSuccessFlagsAfterArguments(t *testing.T) {
+	c, remaining, err := Load("true_accord", []string{"debt", "42", "--format", "json", "--", "--not-a-flag"}, testEnv(map[string]string{
+		"TRUEACCORD_API_URL": "http://localhost",
+	}))
+
+	assert.Nil(t, err)
+	assert.Equal(t, "json", c.Format)
+	assert.Equal(t, []string{"debt", "42", "--not-a-flag"}, remaining)
+}
+
+func TestLoadFailureHelp(t *testing.T) {
+	_, _, err := Load("true_accord", []string{"--help"}, testEnv(nil))
+
+	assert.Equal(t, flag.ErrHelp, err)
+}
+
+func TestLoadSuccessJSONFileFromEnv(t *testing.T) {
+	path, cleanup := writeConfigFile(t, "config.json", `{"api_url": "http://file.local", "timeout": "10s", "as_of": "2020-10-15"}`)
+	defer cleanup()
+
+	c, _, err := Load("true_accord", nil, testEnv(map[string]string{
+		FileEnv: path,
+	}))
+
+	assert.Nil(t, err)
+	assert.Equal(t, "http://file.local", c.APIURL)
+	assert.Equal(t, 10*time.Second, c.Timeout)
+	assert.Equal(t, time.Date(2020, 10, 15, 0, 0, 0, 0, time.UTC), c.AsOf)
+}
+
+func TestLoadSuccessAPIAccess(t *testing.T) {
+	credentialsPath, cleanupCredentials := writeConfigFile(t, "credentials.json", `{"type": "bearer", "username": "file-user", "password": "file-password"}`)
+	defer cleanupCredentials()
+
+	path, cleanup := writeConfigFile(t, "config.yaml", `
+api_url: http://file.local
+rate_limit_payment_plans: 5:10
+rate_limit_payments: 2
+auth_type: basic
+api_password: config-password
+credentials_file: `+credentialsPath+`
+`)
+	defer cleanup()
+
+	c, _, err := Load("true_accord", []string{"--config", path}, testEnv(map[string]string{
+		"TRUEACCORD_RATE_LIMIT_PAYMENTS": "20",
+	}))
+
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"payment_plans": "5:10", "payments": "20"}, c.RateLimits)
+	assert.Equal(t, credentialsPath, c.CredentialsFile)
+	assert.Equal(t, trueaccordapi.Credentials{Type: "basic", Username: "file-user", Password: "config-password"}, c.Credentials)
+}
+
+func TestLoadFailureUnreadableCredentialsFile(t *testing.T) {
+	_, _, err := Load("true_accord", []string{"--credentials-file", "does-not-exist.json"}, testEnv(map[string]string{
+		"TRUEACCORD_API_URL": "http://localhost",
+	}))
+
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), `Invalid credentials_file "does-not-exist.json"`)
+}
+
+func TestLoadFailureMissingAPIURL(t *testing.T) {
+	_, _, err := Load("true_accord", nil, testEnv(nil))
+
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "api_url is required")
+}
+
+func TestLoadFailureInvalidValues(t *testing.T) {
+	env := testEnv(map[string]string{"TRUEACCORD_API_URL": "http://localhost"})
+
+	for args, expectedErr := range map[string]string{
+		"--concurrency=0":                 "Invalid concurrency 0, expected at least 1",
+		"--concurrency=many":              `Invalid concurrency "many" from --concurrency: invalid syntax`,
+		"--max-attempts=0":                "Invalid max_attempts 0, expected at least 1",
+		"--page-size=-1":                  "Invalid page_size -1, expected 0 or more",
+		"--timeout=0s":                    "Invalid timeout 0s, expected a positive duration",
+		"--as-of=10/15/2020":              `Invalid as_of "10/15/2020" from --as-of: expected YYYY-MM-DD`,
+		"--roll-convention=nearest":       `Invalid roll_convention "nearest", expected one of none, following, modified_following, preceding`,
+		"--time-zone=Pacific":             `Invalid time_zone "Pacific" from --time-zone: expected an IANA time zone such as America/Los_Angeles`,
+		"--api-url=localhost":             `Invalid api_url "localhost", expected an http or https URL`,
+		"--api-url=ftp://remote":          `Invalid api_url "ftp://remote", expected an http or https URL`,
+		"--output-version=3":              "Invalid output_version 3, expected 1 or 2",
+		"--format=xml":                    `Invalid format "xml", expected one of ndjson, json, csv, tsv, table`,
+		"--status=OVERDUE":                `Invalid status "OVERDUE" from --status: expected one of CURRENT, LATE, DEFAULTED, PAID_OFF, NO_PAYMENT_PLAN, FAILED`,
+		"--debt-ids=1,two":                `Invalid debt_ids "1,two" from --debt-ids: invalid syntax`,
+		"--remaining-policy=plan-or-debt": `Invalid remaining_policy "plan-or-debt", expected one of plan, debt`,
+		"--horizon-days=0":                "Invalid horizon_days 0, expected at least 1",
+		"--period=quarter":                `Invalid period "quarter", expected one of week, month`,
+		"--haircuts=LATE":                 `Invalid haircuts "LATE" from --haircuts: expected STATUS=PROBABILITY with a status among CURRENT, LATE, DEFAULTED, PAID_OFF, NO_PAYMENT_PLAN, FAILED, got "LATE"`,
+		"--haircuts=LATE=1.5":             `Invalid haircuts "LATE=1.5" from --haircuts: expected a probability between 0 and 1 for LATE, got 1.5`,
+		"--rate-limit-debts=fast":         `Invalid rate_limit_debts "fast" from --rate-limit-debts: Invalid rate limit "fast", expected RATE or RATE:BURST requests per second`,
+		"--auth-type=basic":               "Invalid credentials: basic credentials need a username and password",
+		"--auth-type=kerberos":            `Invalid credentials: Unknown credentials type "kerberos"`,
+	} {
+		_, _, err := Load("true_accord", []string{args}, env)
+		if assert.NotNil(t, err, args) {
+			assert.Equal(t, expectedErr, err.Error(), args)
+		}
+	}
+}
+
+func TestLoadFailureUnknownFileSetting(t *testing.T) {
+	path, cleanup := writeConfigFile(t, "config.yaml", "api_url: http://file.local\nconcurency: 4\n")
+	defer cleanup()
+
+	_, _, err := Load("true_accord", []string{"--config", path}, testEnv(nil))
+
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "Unknown settings in configuration file")
+	assert.Contains(t, err.Error(), "concurency")
+}
+
+func TestLoadFailureUnreadableFile(t *testing.T) {
+	_, _, err := Load("true_accord", []string{"--config", "does-not-exist.yaml"}, testEnv(nil))
+
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,188 @@
+package fees
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"time"
+
+	"true_accord/shared/money"
+	"true_accord/shared/reconciliation"
+
+	"gopkg.in/yaml.v3"
+)
+
+// basisPoints ... is the precision percentage late fees are applied with
+const basisPoints = 10000
+
+// LateFee ... is charged on each installment still unpaid when its grace period ends: Flat plus Percent (0 to 1)
+// of the installment amount
+type LateFee struct {
+	Flat    money.Money `yaml:"flat" json:"flat"`
+	Percent float64     `yaml:"percent" json:"percent"`
+}
+
+// Caps ... limits the late fees charged on one installment and on one debt; zero means no limit
+type Caps struct {
+	PerInstallment money.Money `yaml:"per_installment" json:"per_installment"`
+	PerDebt        money.Money `yaml:"per_debt" json:"per_debt"`
+}
+
+// Waiver ... waives the late fees of a debt or payment plan, or of only some of its installments.
+// DebtID and PaymentPlanID are matched when set; Installments lists installment numbers, or is empty for all.
+type Waiver struct {
+	DebtID        *int64 `yaml:"debt_id" json:"debt_id"`
+	PaymentPlanID *int64 `yaml:"payment_plan_id" json:"payment_plan_id"`
+	Installments  []int  `yaml:"installments" json:"installments"`
+	Reason        string `yaml:"reason" json:"reason"`
+}
+
+// Rules ... are the grace period and late fee rules applied on top of the installment and payment matching.
+// The zero Rules charge no fees.
+type Rules struct {
+	// GraceDays is the number of days after its due date an installment can be paid before a late fee is charged
+	GraceDays int      `yaml:"grace_days" json:"grace_days"`
+	LateFee   LateFee  `yaml:"late_fee" json:"late_fee"`
+	Caps      Caps     `yaml:"caps" json:"caps"`
+	Waivers   []Waiver `yaml:"waivers" json:"waivers"`
+}
+
+// Fee ... is the late fee charged on one installment
+type Fee struct {
+	InstallmentNumber int `json:"installment_number"`
+	// ChargedOn is the day after the installment's grace period ended
+	ChargedOn time.Time   `json:"charged_on"`
+	Amount    money.Money `json:"amount"`
+	Waived    bool        `json:"waived"`
+	Reason    string      `json:"reason,omitempty"`
+}
+
+// Assessment ... is the late fees charged on a payment plan: Accrued is owed and Waived is forgiven
+type Assessment struct {
+	Fees    []Fee       `json:"fees"`
+	Accrued money.Money `json:"accrued"`
+	Waived  money.Money `json:"waived"`
+}
+
+// Load ... returns the rules in a YAML or JSON file (JSON is valid YAML), or the zero Rules if path is empty.
+// Unknown keys are rejected so a misspelt rule isn't silently ignored.
+func Load(path string) (*Rules, error) {
+	rules := &Rules{}
+	if path == "" {
+		return rules, nil
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(b))
+	decoder.KnownFields(true)
+	if err = decoder.Decode(rules); err != nil {
+		return nil, fmt.Errorf("Failed to parse fee rules file %s: %v", path, err)
+	}
+
+	if err = rules.Validate(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// Validate ... returns an error describing the first rule that is out of range
+func (r *Rules) Validate() error {
+	if r.GraceDays < 0 {
+		return fmt.Errorf("Invalid grace_days %d, expected 0 or more", r.GraceDays)
+	}
+	if r.LateFee.Flat < money.Zero {
+		return fmt.Errorf("Invalid late_fee.flat %s, expected 0 or more", r.LateFee.Flat)
+	}
+	if r.LateFee.Percent < 0 || r.LateFee.Percent > 1 {
+		return fmt.Errorf("Invalid late_fee.percent %v, expected between 0 and 1", r.LateFee.Percent)
+	}
+	if r.Caps.PerInstallment < money.Zero || r.Caps.PerDebt < money.Zero {
+		return fmt.Errorf("Invalid caps %s per installment and %s per debt, expected 0 or more", r.Caps.PerInstallment, r.Caps.PerDebt)
+	}
+
+	for i, waiver := range r.Waivers {
+		if waiver.DebtID == nil && waiver.PaymentPlanID == nil {
+			return fmt.Errorf("Invalid waivers[%d], expected a debt_id or payment_plan_id", i)
+		}
+	}
+	return nil
+}
+
+// Assess ... returns the late fees charged as of asOf on the installments of a payment plan of a debt.
+// An installment is charged once, on the day after its grace period ends, if it wasn't paid in full by then;
+// paying it later doesn't remove the fee. Dates are compared as calendar dates in their own locations.
+func (r *Rules) Assess(debtID, paymentPlanID int64, installments []reconciliation.InstallmentStatus, asOf time.Time) Assessment {
+	assessment := Assessment{Fees: []Fee{}}
+
+	for _, installment := range installments {
+		graceEnd := installment.DueDate.AddDate(0, 0, r.GraceDays)
+		if reconciliation.DaysBetween(graceEnd, asOf) <= 0 {
+			continue
+		}
+		if installment.PaidOn != nil && reconciliation.DaysBetween(graceEnd, *installment.PaidOn) <= 0 {
+			continue
+		}
+
+		fee := Fee{
+			InstallmentNumber: installment.Number,
+			ChargedOn:         graceEnd.AddDate(0, 0, 1),
+			Amount:            r.lateFee(installment.AmountDue),
+		}
+		if fee.Amount <= money.Zero {
+			continue
+		}
+
+		if waiver := r.waiver(debtID, paymentPlanID, installment.Number); waiver != nil {
+			fee.Waived = true
+			fee.Reason = waiver.Reason
+			assessment.Waived += fee.Amount
+		} else {
+			if r.Caps.PerDebt > money.Zero {
+				fee.Amount = money.Min(fee.Amount, r.Caps.PerDebt-assessment.Accrued)
+				if fee.Amount <= money.Zero {
+					continue
+				}
+			}
+			assessment.Accrued += fee.Amount
+		}
+
+		assessment.Fees = append(assessment.Fees, fee)
+	}
+
+	return assessment
+}
+
+// lateFee ... returns the late fee on an installment of amountDue, limited to the per installment cap
+func (r *Rules) lateFee(amountDue money.Money) money.Money {
+	fee := r.LateFee.Flat + amountDue.MulRatio(int64(math.Round(r.LateFee.Percent*basisPoints)), basisPoints)
+	if r.Caps.PerInstallment > money.Zero {
+		fee = money.Min(fee, r.Caps.PerInstallment)
+	}
+	return fee
+}
+
+// waiver ... returns the first waiver of the fee on an installment, or nil if it isn't waived
+func (r *Rules) waiver(debtID, paymentPlanID int64, installmentNumber int) *Waiver {
+	for i, waiver := range r.Waivers {
+		if waiver.DebtID != nil && *waiver.DebtID != debtID {
+			continue
+		}
+		if waiver.PaymentPlanID != nil && *waiver.PaymentPlanID != paymentPlanID {
+			continue
+		}
+		if len(waiver.Installments) == 0 {
+			return &r.Waivers[i]
+		}
+		for _, number := range waiver.Installments {
+			if number == installmentNumber {
+				return &r.Waivers[i]
+			}
+		}
+	}
+	return nil
+}
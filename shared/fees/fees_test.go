@@ -0,0 +1,192 @@
+package fees
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"true_accord/shared/money"
+	"true_accord/shared/reconciliation"
+	"true_accord/shared/schedule"
+	"true_accord/shared/trueaccordapi"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func date(t *testing.T, value string) time.Time {
+	d, err := time.Parse(schedule.DateLayout, value)
+	if err != nil {
+		t.Fatalf("Failed to parse test date %s", value)
+	}
+	return d
+}
+
+func int64Pointer(i int64) *int64 {
+	return &i
+}
+
+// testInstallments ... returns four weekly installments of 25.00 due from 2020-09-28 with payments applied as of asOf
+func testInstallments(t *testing.T, payments []trueaccordapi.Payment, asOf time.Time) []reconciliation.InstallmentStatus {
+	testPaymentPlan := trueaccordapi.PaymentPlan{AmountToPay: money.MustParse("100"), InstallmentFrequency: schedule.Weekly, InstallmentAmount: money.MustParse("25"), StartDate: "2020-09-28"}
+
+	installments, err := schedule.Generate(&testPaymentPlan)
+	if err != nil {
+		t.Fatalf("Failed to generate test installments")
+	}
+	return reconciliation.Reconcile(installments, payments, asOf).Installments
+}
+
+func writeRulesFile(t *testing.T, name, contents string) (path string, cleanup func()) {
+	dir, err := ioutil.TempDir("", "fees")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path = filepath.Join(dir, name)
+	if err = ioutil.WriteFile(path, []byte(contents), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path, func() {
+		os.RemoveAll(dir)
+	}
+}
+
+func TestAssessSuccessGracePeriod(t *testing.T) {
+	rules := &Rules{GraceDays: 5, LateFee: LateFee{Flat: money.MustParse("10")}}
+	payments := []trueaccordapi.Payment{
+		{Amount: money.MustParse("25"), Date: "2020-10-03"}, // 5 days late, within the grace period
+		{Amount: money.MustParse("25"), Date: "2020-10-12"}, // 7 days late, charged even though it was paid
+	}
+	asOf := date(t, "2020-10-17")
+
+	assessment := rules.Assess(1, 2, testInstallments(t, payments, asOf), asOf)
+
+	// Installment 3, due 2020-10-12 and unpaid, is still within its grace period
+	assert.Equal(t, []Fee{
+		{InstallmentNumber: 2, ChargedOn: date(t, "2020-10-11"), Amount: money.MustParse("10")},
+	}, assessment.Fees)
+	assert.Equal(t, money.MustParse("10"), assessment.Accrued)
+}
+
+func TestAssessSuccessFlatAndPercentWithCaps(t *testing.T) {
+	asOf := date(t, "2020-10-30")
+	installments := testInstallments(t, nil, asOf)
+
+	rules := &Rules{LateFee: LateFee{Flat: money.MustParse("5"), Percent: 0.1}}
+	assert.Equal(t, money.MustParse("30"), rules.Assess(1, 2, installments, asOf).Accrued, "5.00 + 2.50 on each of four installments")
+
+	rules.Caps.PerInstallment = money.MustParse("6")
+	assert.Equal(t, money.MustParse("24"), rules.Assess(1, 2, installments, asOf).Accrued)
+
+	rules.Caps.PerDebt = money.MustParse("15")
+	assessment := rules.Assess(1, 2, installments, asOf)
+	assert.Equal(t, money.MustParse("15"), assessment.Accrued)
+	assert.Equal(t, 3, len(assessment.Fees))
+	assert.Equal(t, money.MustParse("3"), assessment.Fees[2].Amount, "The fee reaching the cap is reduced")
+}
+
+func TestAssessSuccessWaivers(t *testing.T) {
+	asOf := date(t, "2020-10-30")
+	installments := testInstallments(t, nil, asOf)
+
+	rules := &Rules{
+		LateFee: LateFee{Flat: money.MustParse("10")},
+		Waivers: []Waiver{
+			{DebtID: int64Pointer(0), Installments: []int{1, 2}, Reason: "Hardship"},
+			{PaymentPlanID: int64Pointer(7)},
+		},
+	}
+
+	assessment := rules.Assess(0, 2, installments, asOf)
+	assert.Equal(t, money.MustParse("20"), assessment.Accrued)
+	assert.Equal(t, money.MustParse("20"), assessment.Waived)
+	assert.Equal(t, Fee{InstallmentNumber: 1, ChargedOn: date(t, "2020-09-29"), Amount: money.MustParse("10"), Waived: true, Reason: "Hardship"}, assessment.Fees[0])
+
+	assessment = rules.Assess(1, 7, installments, asOf)
+	assert.Equal(t, money.Zero, assessment.Accrued)
+	assert.Equal(t, money.MustParse("40"), assessment.Waived)
+
+	assert.Equal(t, money.MustParse("40"), rules.Assess(1, 2, installments, asOf).Accrued)
+}
+
+func TestAssessSuccessZeroRules(t *testing.T) {
+	asOf := date(t, "2020-10-30")
+	assessment := (&Rules{}).Assess(1, 2, testInstallments(t, nil, asOf), asOf)
+
+	assert.Equal(t, Assessment{Fees: []Fee{}}, assessment)
+}
+
+func TestLoadSuccess(t *testing.T) {
+	path, cleanup := writeRulesFile(t, "fees.yaml", `
+grace_days: 10
+late_fee:
+  flat: 15
+  percent: 0.05
+caps:
+  per_installment: 20.00
+  per_debt: 100
+waivers:
+  - debt_id: 0
+    reason: Hardship
+  - payment_plan_id: 7
+    installments: [1, 2]
+`)
+	defer cleanup()
+
+	rules, err := Load(path)
+
+	assert.Nil(t, err)
+	assert.Equal(t, &Rules{
+		GraceDays: 10,
+		LateFee:   LateFee{Flat: money.MustParse("15"), Percent: 0.05},
+		Caps:      Caps{PerInstallment: money.MustParse("20"), PerDebt: money.MustParse("100")},
+		Waivers: []Waiver{
+			{DebtID: int64Pointer(0), Reason: "Hardship"},
+			{PaymentPlanID: int64Pointer(7), Installments: []int{1, 2}},
+		},
+	}, rules)
+}
+
+func TestLoadSuccessJSON(t *testing.T) {
+	path, cleanup := writeRulesFile(t, "fees.json", `{"grace_days": 3, "late_fee": {"flat": "7.50"}}`)
+	defer cleanup()
+
+	rules, err := Load(path)
+
+	assert.Nil(t, err)
+	assert.Equal(t, &Rules{GraceDays: 3, LateFee: LateFee{Flat: money.MustParse("7.50")}}, rules)
+
+	rules, err = Load("")
+	assert.Nil(t, err)
+	assert.Equal(t, &Rules{}, rules, "No file charges no fees")
+}
+
+func TestLoadFailureInvalidRules(t *testing.T) {
+	testCases := map[string]string{
+		"grace_days: -1\n":                 "Invalid grace_days -1, expected 0 or more",
+		"late_fee:\n  percent: 5\n":        "Invalid late_fee.percent 5, expected between 0 and 1",
+		"caps:\n  per_debt: -10\n":         "Invalid caps 0.00 per installment and -10.00 per debt, expected 0 or more",
+		"waivers:\n  - reason: Goodwill\n": "Invalid waivers[0], expected a debt_id or payment_plan_id",
+	}
+
+	for contents, expected := range testCases {
+		path, cleanup := writeRulesFile(t, "fees.yaml", contents)
+		_, err := Load(path)
+		cleanup()
+
+		assert.EqualError(t, err, expected, contents)
+	}
+}
+
+func TestLoadFailureUnknownRule(t *testing.T) {
+	path, cleanup := writeRulesFile(t, "fees.yaml", "grace_period: 5\n")
+	defer cleanup()
+
+	_, err := Load(path)
+
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "field grace_period not found")
+}
@@ -0,0 +1,129 @@
+package forecast
+
+import (
+	"errors"
+	"math"
+	"time"
+
+	"true_accord/shared/money"
+	"true_accord/shared/reconciliation"
+)
+
+// Forecast periods
+const (
+	// PeriodWeek ... groups collections into weeks starting on Monday
+	PeriodWeek = "week"
+	// PeriodMonth ... groups collections into calendar months
+	PeriodMonth = "month"
+)
+
+// Periods ... lists every forecast period
+var Periods = []string{PeriodWeek, PeriodMonth}
+
+// ErrUnknownPeriod ... is returned by New for a period that isn't one of Periods
+var ErrUnknownPeriod = errors.New("Unknown forecast period")
+
+// basisPoints ... is the precision haircuts are applied with
+const basisPoints = 10000
+
+// Bucket ... is the collections expected in one period
+type Bucket struct {
+	PeriodStart  time.Time   `json:"period_start"`
+	PeriodEnd    time.Time   `json:"period_end"`
+	Installments int         `json:"installments"`
+	Scheduled    money.Money `json:"scheduled"`
+	Expected     money.Money `json:"expected"`
+}
+
+// Forecast ... accumulates the unpaid installments due within a horizon into periods
+type Forecast struct {
+	from, to time.Time
+	haircuts map[string]int64
+	buckets  []Bucket
+}
+
+// IsPeriod ... reports whether period is one of Periods
+func IsPeriod(period string) bool {
+	for _, known := range Periods {
+		if period == known {
+			return true
+		}
+	}
+	return false
+}
+
+// New ... returns an empty forecast of the horizonDays days starting on the date of from, grouped by period.
+// haircuts maps a delinquency status to the probability (0 to 1) that its installments are never paid.
+func New(from time.Time, horizonDays int, period string, haircuts map[string]float64) (*Forecast, error) {
+	if !IsPeriod(period) {
+		return nil, ErrUnknownPeriod
+	}
+
+	year, month, day := from.Date()
+	f := &Forecast{
+		from:     time.Date(year, month, day, 0, 0, 0, 0, time.UTC),
+		haircuts: make(map[string]int64),
+	}
+	f.to = f.from.AddDate(0, 0, horizonDays)
+
+	for status, probability := range haircuts {
+		f.haircuts[status] = int64(math.Round(probability * basisPoints))
+	}
+
+	for start := periodStart(f.from, period); start.Before(f.to); start = nextPeriod(start, period) {
+		f.buckets = append(f.buckets, Bucket{
+			PeriodStart: start,
+			PeriodEnd:   nextPeriod(start, period).AddDate(0, 0, -1),
+		})
+	}
+
+	return f, nil
+}
+
+// Add ... adds what is left to pay on the installments due within the horizon of a payment plan with a delinquency status.
+// Installments are bucketed by the calendar date of their due date in its own time zone.
+func (f *Forecast) Add(installments []reconciliation.InstallmentStatus, status string) {
+	for _, installment := range installments {
+		unpaid := installment.AmountDue - installment.AmountPaid
+		dueDate := reconciliation.UTCDate(installment.DueDate)
+		if unpaid <= money.Zero || dueDate.Before(f.from) || !dueDate.Before(f.to) {
+			continue
+		}
+
+		bucket := f.bucket(dueDate)
+		bucket.Installments++
+		bucket.Scheduled += unpaid
+		bucket.Expected += unpaid.MulRatio(basisPoints-f.haircuts[status], basisPoints)
+	}
+}
+
+// Buckets ... returns the forecast periods in date order, including periods with nothing due
+func (f *Forecast) Buckets() []Bucket {
+	return f.buckets
+}
+
+func (f *Forecast) bucket(date time.Time) *Bucket {
+	for i := range f.buckets {
+		if !date.After(f.buckets[i].PeriodEnd) {
+			return &f.buckets[i]
+		}
+	}
+	return &f.buckets[len(f.buckets)-1]
+}
+
+// periodStart ... returns the first day of the period containing date
+func periodStart(date time.Time, period string) time.Time {
+	if period == PeriodMonth {
+		return time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+
+	// Weeks start on Monday
+	return date.AddDate(0, 0, -(int(date.Weekday())+6)%7)
+}
+
+func nextPeriod(start time.Time, period string) time.Time {
+	if period == PeriodMonth {
+		return start.AddDate(0, 1, 0)
+	}
+	return start.AddDate(0, 0, 7)
+}
@@ -0,0 +1,75 @@
+package forecast
+
+import (
+	"testing"
+	"time"
+
+	"true_accord/shared/money"
+	"true_accord/shared/reconciliation"
+	"true_accord/shared/schedule"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func date(month time.Month, day int) time.Time {
+	return time.Date(2020, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func testInstallments() []reconciliation.InstallmentStatus {
+	installment := func(number int, dueDate time.Time, paid string) reconciliation.InstallmentStatus {
+		return reconciliation.InstallmentStatus{
+			Installment: schedule.Installment{Number: number, DueDate: dueDate, AmountDue: money.MustParse("25")},
+			AmountPaid:  money.MustParse(paid),
+		}
+	}
+
+	return []reconciliation.InstallmentStatus{
+		installment(1, date(time.October, 6), "0"),
+		installment(2, date(time.October, 8), "10"),
+		installment(3, date(time.October, 15), "0"),
+		installment(4, date(time.October, 22), "25"),
+		installment(5, date(time.November, 5), "0"),
+		installment(6, date(time.November, 6), "0"),
+	}
+}
+
+func TestForecastSuccessWeekly(t *testing.T) {
+	f, err := New(time.Date(2020, 10, 7, 15, 0, 0, 0, time.UTC), 30, PeriodWeek, map[string]float64{reconciliation.StatusLate: 0.25})
+	assert.Nil(t, err)
+
+	f.Add(testInstallments(), reconciliation.StatusLate)
+	buckets := f.Buckets()
+
+	assert.Equal(t, 5, len(buckets))
+	assert.Equal(t, Bucket{
+		PeriodStart:  date(time.October, 5),
+		PeriodEnd:    date(time.October, 11),
+		Installments: 1,
+		Scheduled:    money.MustParse("15"),
+		Expected:     money.MustParse("11.25"),
+	}, buckets[0], "The installment due before today and what was already paid are left out")
+	assert.Equal(t, money.MustParse("18.75"), buckets[1].Expected)
+	assert.Equal(t, 0, buckets[2].Installments, "Paid installments are left out")
+	assert.Equal(t, 0, buckets[3].Installments)
+	assert.Equal(t, 1, buckets[4].Installments, "The installment due at the end of the horizon is left out")
+}
+
+func TestForecastSuccessMonthly(t *testing.T) {
+	f, err := New(date(time.October, 7), 30, PeriodMonth, nil)
+	assert.Nil(t, err)
+
+	f.Add(testInstallments(), reconciliation.StatusCurrent)
+	buckets := f.Buckets()
+
+	assert.Equal(t, 2, len(buckets))
+	assert.Equal(t, date(time.October, 31), buckets[0].PeriodEnd)
+	assert.Equal(t, money.MustParse("40"), buckets[0].Scheduled)
+	assert.Equal(t, money.MustParse("40"), buckets[0].Expected)
+	assert.Equal(t, money.MustParse("25"), buckets[1].Scheduled)
+}
+
+func TestForecastFailureUnknownPeriod(t *testing.T) {
+	_, err := New(date(time.October, 7), 30, "quarter", nil)
+
+	assert.Equal(t, ErrUnknownPeriod, err)
+}
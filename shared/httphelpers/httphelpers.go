@@ -2,14 +2,25 @@ package httphelpers
 
 import (
 	"fmt"
+	"strings"
+	"sync"
 
 	log "github.com/sirupsen/logrus"
 )
 
+// redacted ... replaces registered secrets in logged errors
+const redacted = "[REDACTED]"
+
+var (
+	secretsMu sync.RWMutex
+	secrets   = make(map[string]struct{})
+)
+
 type APIError struct {
 	ErrorMessage         error
 	ClientErrorMessage   string
 	InternalErrorMessage string
+	Attempts             int
 }
 
 func NewAPIError(err error, clientMessage string) *APIError {
@@ -24,14 +35,49 @@ func (e *APIError) SetInternalErrorMessage(msg string) *APIError {
 	return e
 }
 
+// SetAttempts ... records how many times the request was attempted before failing
+func (e *APIError) SetAttempts(attempts int) *APIError {
+	e.Attempts = attempts
+	return e
+}
+
 func (e *APIError) String() string {
-	return fmt.Sprintf("%s | %s", e.InternalErrorMessage, e.ErrorMessage)
+	return Redact(fmt.Sprintf("%s | %s", e.InternalErrorMessage, e.ErrorMessage))
 }
 
 func (e *APIError) LogError() {
+	message := ""
+	if e.ErrorMessage != nil {
+		message = e.ErrorMessage.Error()
+	}
+
 	log.WithFields(log.Fields{
-		"Message": e.ErrorMessage,
-		"ClientError": e.ClientErrorMessage,
-		"InternalErrorMessage": e.InternalErrorMessage,
+		"Message":              Redact(message),
+		"ClientError":          Redact(e.ClientErrorMessage),
+		"InternalErrorMessage": Redact(e.InternalErrorMessage),
+		"Attempts":             e.Attempts,
 	}).Error()
-}
\ No newline at end of file
+}
+
+// RegisterSecrets ... adds credential values that must be redacted wherever an APIError is logged
+func RegisterSecrets(values ...string) {
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+
+	for _, value := range values {
+		if value != "" {
+			secrets[value] = struct{}{}
+		}
+	}
+}
+
+// Redact ... returns s with every registered secret replaced by [REDACTED]
+func Redact(s string) string {
+	secretsMu.RLock()
+	defer secretsMu.RUnlock()
+
+	for secret := range secrets {
+		s = strings.Replace(s, secret, redacted, -1)
+	}
+	return s
+}
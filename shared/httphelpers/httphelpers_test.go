@@ -1,9 +1,12 @@
 package httphelpers
 
 import (
+	"bytes"
 	"errors"
+	"os"
 	"testing"
 
+	log "github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -11,7 +14,7 @@ func TestNewAPIErrorSuccess(t *testing.T) {
 	err := errors.New("This is a test error")
 	clientErrorMessage := ""
 
-	successAPIError := &APIError{err, clientErrorMessage, ""}
+	successAPIError := &APIError{ErrorMessage: err, ClientErrorMessage: clientErrorMessage}
 
 	apiError := NewAPIError(err, clientErrorMessage)
 	assert.Equal(t, successAPIError, apiError)
@@ -22,8 +25,31 @@ func TestSetInternalErrorMessageSuccess(t *testing.T) {
 	clientErrorMessage := "Client error message test"
 	internalErrorMessage := "This is an internal message test"
 
-	successAPIError := &APIError{err, clientErrorMessage, ""}
+	successAPIError := &APIError{ErrorMessage: err, ClientErrorMessage: clientErrorMessage}
 	successAPIError.SetInternalErrorMessage(internalErrorMessage)
 
 	assert.Equal(t, successAPIError.InternalErrorMessage, internalErrorMessage)
 }
+
+func TestSetAttemptsSuccess(t *testing.T) {
+	apiError := NewAPIError(errors.New("This is a test error"), "").SetAttempts(3)
+
+	assert.Equal(t, 3, apiError.Attempts)
+}
+
+func TestLogErrorRedactsSecrets(t *testing.T) {
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer func() {
+		log.SetOutput(os.Stderr)
+	}()
+
+	RegisterSecrets("s3cr3t-token", "")
+
+	apiError := NewAPIError(errors.New("Unauthorized token s3cr3t-token"), "Failed to GET debts")
+	apiError.LogError()
+
+	assert.NotContains(t, logged.String(), "s3cr3t-token")
+	assert.Contains(t, logged.String(), "[REDACTED]")
+	assert.NotContains(t, apiError.String(), "s3cr3t-token")
+}
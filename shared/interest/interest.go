@@ -0,0 +1,148 @@
+package interest
+
+import (
+	"errors"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"true_accord/shared/money"
+)
+
+// Day count conventions
+const (
+	// ActualOver365 ... counts the actual calendar days elapsed over a 365 day year
+	ActualOver365 = "ACT/365"
+	// Thirty360 ... counts every month as 30 days over a 360 day year (US 30/360)
+	Thirty360 = "30/360"
+)
+
+// DefaultDayCount ... is the day count convention of interest terms that don't name one
+const DefaultDayCount = ActualOver365
+
+// DayCounts ... lists every day count convention
+var DayCounts = []string{ActualOver365, Thirty360}
+
+// ErrUnknownDayCount ... is returned for a day count convention that isn't one of DayCounts
+var ErrUnknownDayCount = errors.New("Unknown day count convention")
+
+// ErrInvalidAPR ... is returned for a negative or non-finite APR
+var ErrInvalidAPR = errors.New("Invalid APR, expected 0 or more")
+
+// IsDayCount ... reports whether dayCount is one of DayCounts, ignoring case
+func IsDayCount(dayCount string) bool {
+	for _, known := range DayCounts {
+		if strings.ToUpper(dayCount) == known {
+			return true
+		}
+	}
+	return false
+}
+
+// Days ... returns the days from the calendar date of start to the calendar date of end under dayCount, and the
+// days in a year under dayCount. Dates are taken in their own locations.
+func Days(start, end time.Time, dayCount string) (days, daysInYear int64, err error) {
+	switch strings.ToUpper(dayCount) {
+	case ActualOver365:
+		return int64(utcDate(end).Sub(utcDate(start)).Hours() / 24), 365, nil
+	case Thirty360:
+		y1, m1, d1 := start.Date()
+		y2, m2, d2 := end.Date()
+		if d1 == 31 {
+			d1 = 30
+		}
+		if d2 == 31 && d1 == 30 {
+			d2 = 30
+		}
+		days = 360*int64(y2-y1) + 30*int64(m2-m1) + int64(d2-d1)
+		return days, 360, nil
+	default:
+		return 0, 0, ErrUnknownDayCount
+	}
+}
+
+// Payment ... is an amount paid on a date, reducing the principal interest accrues on from that date
+type Payment struct {
+	Date   time.Time
+	Amount money.Money
+}
+
+// Accrue ... returns the simple interest on principal at apr (the annual rate as a fraction, 0.18 for 18%) from
+// start to end under dayCount, rounded to the nearest cent with halves away from zero. Nothing accrues unless
+// end is after start.
+func Accrue(principal money.Money, apr float64, start, end time.Time, dayCount string) (money.Money, error) {
+	return AccrueOnBalance(principal, nil, apr, start, end, dayCount)
+}
+
+// AccrueOnBalance ... returns the simple interest like Accrue, on principal less the payments made so far: each
+// payment reduces the balance from its date, and the balance never goes below zero. Payments dated on or after
+// end are ignored. The interest is rounded once, after adding up every period between payments.
+func AccrueOnBalance(principal money.Money, payments []Payment, apr float64, start, end time.Time, dayCount string) (money.Money, error) {
+	_, daysInYear, err := Days(start, end, dayCount)
+	if err != nil {
+		return money.Zero, err
+	}
+
+	// Format the shortest decimal representation first so 0.1825 is used as written, not as 0.18249999...
+	rate, ok := new(big.Rat).SetString(strconv.FormatFloat(apr, 'f', -1, 64))
+	if !ok || rate.Sign() < 0 {
+		return money.Zero, ErrInvalidAPR
+	}
+	if !end.After(start) {
+		return money.Zero, nil
+	}
+
+	ordered := append([]Payment(nil), payments...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].Date.Before(ordered[j].Date)
+	})
+
+	// Add up the balance in cents times the days it was outstanding
+	centDays := new(big.Int)
+	accrue := func(balance money.Money, from, to time.Time) {
+		if days, _, _ := Days(from, to, dayCount); days > 0 {
+			centDays.Add(centDays, new(big.Int).Mul(big.NewInt(balance.Cents()), big.NewInt(days)))
+		}
+	}
+
+	balance, from := principal, start
+	for _, payment := range ordered {
+		if !payment.Date.Before(end) {
+			break
+		}
+		if payment.Date.After(from) {
+			accrue(balance, from, payment.Date)
+			from = payment.Date
+		}
+		balance = money.Max(balance-payment.Amount, money.Zero)
+	}
+	accrue(balance, from, end)
+
+	accrued := new(big.Rat).SetInt(centDays)
+	accrued.Mul(accrued, rate)
+	accrued.Quo(accrued, new(big.Rat).SetInt64(daysInYear))
+
+	return money.FromCents(roundHalfAwayFromZero(accrued)), nil
+}
+
+// roundHalfAwayFromZero ... returns r rounded to an integer, rounding halves away from zero
+func roundHalfAwayFromZero(r *big.Rat) int64 {
+	quotient, remainder := new(big.Int).QuoRem(r.Num(), r.Denom(), new(big.Int))
+
+	// Round up when the remainder is at least half the denominator
+	if twice := new(big.Int).Mul(new(big.Int).Abs(remainder), big.NewInt(2)); twice.Cmp(r.Denom()) >= 0 {
+		if r.Sign() < 0 {
+			quotient.Sub(quotient, big.NewInt(1))
+		} else {
+			quotient.Add(quotient, big.NewInt(1))
+		}
+	}
+	return quotient.Int64()
+}
+
+func utcDate(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,107 @@
+package interest
+
+import (
+	"testing"
+	"time"
+
+	"true_accord/shared/money"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func date(t *testing.T, value string) time.Time {
+	d, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		t.Fatalf("Failed to parse test date %s", value)
+	}
+	return d
+}
+
+func TestDaysSuccessActualOver365(t *testing.T) {
+	days, daysInYear, err := Days(date(t, "2020-01-31"), date(t, "2020-03-31"), ActualOver365)
+
+	assert.Nil(t, err)
+	assert.Equal(t, int64(60), days, "2020 is a leap year")
+	assert.Equal(t, int64(365), daysInYear)
+}
+
+func TestDaysSuccessThirty360(t *testing.T) {
+	testCases := map[[2]string]int64{
+		{"2020-01-31", "2020-03-31"}: 60,
+		{"2020-02-28", "2020-03-31"}: 33,
+		{"2020-01-15", "2021-01-15"}: 360,
+	}
+
+	for dates, expected := range testCases {
+		days, daysInYear, err := Days(date(t, dates[0]), date(t, dates[1]), "30/360")
+
+		assert.Nil(t, err)
+		assert.Equal(t, expected, days, dates)
+		assert.Equal(t, int64(360), daysInYear)
+	}
+}
+
+func TestDaysSuccessLocations(t *testing.T) {
+	losAngeles, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Across the end of daylight saving time on 2020-11-01
+	days, _, err := Days(time.Date(2020, 10, 31, 0, 0, 0, 0, losAngeles), time.Date(2020, 11, 2, 0, 0, 0, 0, losAngeles), "act/365")
+
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), days)
+}
+
+func TestAccrueSuccess(t *testing.T) {
+	accrued, err := Accrue(money.MustParse("1000"), 0.18, date(t, "2020-01-01"), date(t, "2020-07-01"), ActualOver365)
+	assert.Nil(t, err)
+	assert.Equal(t, money.MustParse("89.75"), accrued, "1000.00 * 0.18 * 182 / 365 = 89.753...")
+
+	accrued, err = Accrue(money.MustParse("1000"), 0.18, date(t, "2020-01-31"), date(t, "2020-03-31"), Thirty360)
+	assert.Nil(t, err)
+	assert.Equal(t, money.MustParse("30"), accrued)
+
+	accrued, err = Accrue(money.MustParse("1"), 0.365, date(t, "2020-01-01"), date(t, "2020-01-06"), ActualOver365)
+	assert.Nil(t, err)
+	assert.Equal(t, money.MustParse("0.01"), accrued, "Half a cent rounds away from zero")
+}
+
+func TestAccrueSuccessNothingBeforeStart(t *testing.T) {
+	accrued, err := Accrue(money.MustParse("1000"), 0.18, date(t, "2020-07-01"), date(t, "2020-01-01"), ActualOver365)
+
+	assert.Nil(t, err)
+	assert.Equal(t, money.Zero, accrued)
+}
+
+func TestAccrueOnBalanceSuccess(t *testing.T) {
+	payments := []Payment{{Date: date(t, "2020-03-01"), Amount: money.MustParse("200")}}
+
+	accrued, err := AccrueOnBalance(money.MustParse("1000"), payments, 0.1825, date(t, "2020-01-01"), date(t, "2020-04-01"), ActualOver365)
+	assert.Nil(t, err)
+	assert.Equal(t, money.MustParse("42.40"), accrued, "(1000.00 * 60 + 800.00 * 31) * 0.1825 / 365")
+
+	// Out of order, paid before start, overpaid and paid after end
+	payments = []Payment{
+		{Date: date(t, "2020-05-01"), Amount: money.MustParse("500")},
+		{Date: date(t, "2020-03-21"), Amount: money.MustParse("1000")},
+		{Date: date(t, "2019-12-01"), Amount: money.MustParse("100")},
+		{Date: date(t, "2020-03-01"), Amount: money.MustParse("200")},
+	}
+
+	accrued, err = AccrueOnBalance(money.MustParse("1000"), payments, 0.1825, date(t, "2020-01-01"), date(t, "2020-04-01"), ActualOver365)
+	assert.Nil(t, err)
+	assert.Equal(t, money.MustParse("34"), accrued, "(900.00 * 60 + 700.00 * 20) * 0.1825 / 365")
+}
+
+func TestAccrueFailureInvalidTerms(t *testing.T) {
+	_, err := Accrue(money.MustParse("1000"), 0.18, date(t, "2020-01-01"), date(t, "2020-07-01"), "ACT/360")
+	assert.Equal(t, ErrUnknownDayCount, err)
+
+	_, err = Accrue(money.MustParse("1000"), -0.18, date(t, "2020-01-01"), date(t, "2020-07-01"), ActualOver365)
+	assert.Equal(t, ErrInvalidAPR, err)
+
+	assert.True(t, IsDayCount("act/365"))
+	assert.False(t, IsDayCount(""))
+}
@@ -0,0 +1,230 @@
+package money
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Money ... is an exact monetary amount stored as integer minor units (cents).
+//
+// Decimal input with more than two fractional digits (e.g. the API's 1230.085) is rounded to the
+// nearest cent with halves rounded away from zero (1230.085 -> 1230.09, -0.005 -> -0.01). Rounding
+// only happens when a value enters the type (Parse, FromFloat, UnmarshalJSON, MulRatio); adding and
+// subtracting Money values is exact.
+type Money int64
+
+const (
+	minorUnits     = 100
+	fractionDigits = 2
+)
+
+// Zero ... is the zero amount
+const Zero Money = 0
+
+// FromCents ... returns the amount for a number of minor units
+func FromCents(cents int64) Money {
+	return Money(cents)
+}
+
+// FromFloat ... returns the amount closest to f, rounding halves away from zero
+func FromFloat(f float64) (Money, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return Zero, errors.New("Invalid money amount: " + strconv.FormatFloat(f, 'g', -1, 64))
+	}
+
+	// Format the shortest decimal representation first so 1.005 rounds as written, not as 1.00499999...
+	return Parse(strconv.FormatFloat(f, 'f', -1, 64))
+}
+
+// Parse ... returns the amount for a decimal string such as "51.25", "-3" or "1230.085"
+func Parse(s string) (Money, error) {
+	invalid := errors.New("Invalid money amount: " + s)
+
+	value := strings.TrimSpace(s)
+	negative := false
+	if strings.HasPrefix(value, "-") {
+		negative = true
+		value = value[1:]
+	} else if strings.HasPrefix(value, "+") {
+		value = value[1:]
+	}
+
+	// JSON numbers may use exponents; only plain decimals are handled exactly
+	if strings.ContainsAny(value, "eE") {
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return Zero, invalid
+		}
+		return FromFloat(f)
+	}
+
+	whole, fraction := value, ""
+	if i := strings.Index(value, "."); i >= 0 {
+		whole, fraction = value[:i], value[i+1:]
+	}
+
+	if whole == "" && fraction == "" {
+		return Zero, invalid
+	}
+
+	if whole == "" {
+		whole = "0"
+	}
+
+	for _, r := range whole + fraction {
+		if r < '0' || r > '9' {
+			return Zero, invalid
+		}
+	}
+
+	roundUp := false
+	if len(fraction) > fractionDigits {
+		roundUp = fraction[fractionDigits] >= '5'
+		fraction = fraction[:fractionDigits]
+	}
+
+	for len(fraction) < fractionDigits {
+		fraction += "0"
+	}
+
+	cents, err := strconv.ParseInt(whole+fraction, 10, 64)
+	if err != nil {
+		return Zero, invalid
+	}
+
+	if roundUp {
+		cents++
+	}
+
+	if negative {
+		cents = -cents
+	}
+
+	return Money(cents), nil
+}
+
+// MustParse ... is Parse for constant amounts; it panics on invalid input
+func MustParse(s string) Money {
+	m, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+// Cents ... returns the amount in minor units
+func (m Money) Cents() int64 {
+	return int64(m)
+}
+
+// Float64 ... returns the amount as a float, for display and ratio calculations only
+func (m Money) Float64() float64 {
+	return float64(m) / minorUnits
+}
+
+// IsZero ... returns whether the amount is exactly zero
+func (m Money) IsZero() bool {
+	return m == Zero
+}
+
+// MulRatio ... returns m * numerator / denominator, rounding halves away from zero
+func (m Money) MulRatio(numerator, denominator int64) Money {
+	if denominator == 0 {
+		return Zero
+	}
+
+	product := int64(m) * numerator
+	quotient, remainder := product/denominator, product%denominator
+	if remainder < 0 {
+		remainder = -remainder
+	}
+
+	if 2*remainder >= abs(denominator) {
+		if (product < 0) != (denominator < 0) {
+			quotient--
+		} else {
+			quotient++
+		}
+	}
+
+	return Money(quotient)
+}
+
+// Min ... returns the smaller of two amounts
+func Min(a, b Money) Money {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// Max ... returns the larger of two amounts
+func Max(a, b Money) Money {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// String ... returns the amount as a fixed two-decimal string such as "51.25"
+func (m Money) String() string {
+	cents := int64(m)
+	sign := ""
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+
+	return fmt.Sprintf("%s%d.%02d", sign, cents/minorUnits, cents%minorUnits)
+}
+
+// MarshalJSON ... encodes the amount as a JSON number with two decimals
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON ... decodes a JSON number (or numeric string) into exact minor units
+func (m *Money) UnmarshalJSON(b []byte) error {
+	raw := string(b)
+	if raw == "null" {
+		return nil
+	}
+
+	if unquoted, err := strconv.Unquote(raw); err == nil {
+		raw = unquoted
+	}
+
+	parsed, err := Parse(raw)
+	if err != nil {
+		return err
+	}
+
+	*m = parsed
+	return nil
+}
+
+// UnmarshalYAML ... decodes a YAML number (or numeric string) into exact minor units
+func (m *Money) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var raw string
+	if err := unmarshal(&raw); err != nil {
+		return err
+	}
+
+	parsed, err := Parse(raw)
+	if err != nil {
+		return err
+	}
+
+	*m = parsed
+	return nil
+}
+
+func abs(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,105 @@
+package money
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func TestParseSuccess(t *testing.T) {
+	testCases := map[string]int64{
+		"51.25":    5125,
+		"102.5":    10250,
+		"100":      10000,
+		".5":       50,
+		"0":        0,
+		"-3.10":    -310,
+		"1230.085": 123009,
+		"1.0085":   101,
+		"1.0049":   100,
+		"-0.005":   -1,
+		"1.2e2":    12000,
+	}
+
+	for input, cents := range testCases {
+		res, err := Parse(input)
+		assert.Nil(t, err, input)
+		assert.Equal(t, FromCents(cents), res, input)
+	}
+}
+
+func TestParseFailureInvalidInput(t *testing.T) {
+	for _, input := range []string{"", "-", ".", "1.2.3", "abc", "12a", "99999999999999999999"} {
+		_, err := Parse(input)
+		assert.NotNil(t, err, input)
+	}
+}
+
+func TestFromFloatSuccessRoundsAsWritten(t *testing.T) {
+	res, err := FromFloat(1.005)
+	assert.Nil(t, err)
+	assert.Equal(t, FromCents(101), res)
+}
+
+func TestStringSuccess(t *testing.T) {
+	assert.Equal(t, "51.25", FromCents(5125).String())
+	assert.Equal(t, "0.05", FromCents(5).String())
+	assert.Equal(t, "-0.05", FromCents(-5).String())
+	assert.Equal(t, "100.00", FromCents(10000).String())
+}
+
+func TestMulRatioSuccess(t *testing.T) {
+	assert.Equal(t, FromCents(3333), FromCents(10000).MulRatio(1, 3))
+	assert.Equal(t, FromCents(6667), FromCents(10000).MulRatio(2, 3))
+	assert.Equal(t, FromCents(-6667), FromCents(-10000).MulRatio(2, 3))
+	assert.Equal(t, FromCents(1), FromCents(1).MulRatio(1, 2))
+	assert.Equal(t, Zero, FromCents(100).MulRatio(1, 0))
+}
+
+func TestJSONRoundTripSuccess(t *testing.T) {
+	var payload struct {
+		Amount   Money `json:"amount"`
+		Quoted   Money `json:"quoted"`
+		Optional Money `json:"optional"`
+	}
+
+	err := json.Unmarshal([]byte(`{"amount": 1230.085, "quoted": "4.5", "optional": null}`), &payload)
+	assert.Nil(t, err)
+	assert.Equal(t, FromCents(123009), payload.Amount)
+	assert.Equal(t, FromCents(450), payload.Quoted)
+	assert.Equal(t, Zero, payload.Optional)
+
+	out, err := json.Marshal(payload)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"amount":1230.09,"quoted":4.50,"optional":0.00}`, string(out))
+}
+
+func TestUnmarshalJSONFailureInvalidAmount(t *testing.T) {
+	var m Money
+	err := json.Unmarshal([]byte(`"String_instead_of_float_field"`), &m)
+	assert.NotNil(t, err)
+}
+
+func TestUnmarshalYAMLSuccess(t *testing.T) {
+	var payload struct {
+		Amount Money `yaml:"amount"`
+		Quoted Money `yaml:"quoted"`
+	}
+
+	err := yaml.Unmarshal([]byte("amount: 1230.085\nquoted: \"4.5\"\n"), &payload)
+	assert.Nil(t, err)
+	assert.Equal(t, FromCents(123009), payload.Amount)
+	assert.Equal(t, FromCents(450), payload.Quoted)
+
+	assert.NotNil(t, yaml.Unmarshal([]byte("amount: fifteen\n"), &payload))
+}
+
+func TestAdditionIsExact(t *testing.T) {
+	total := Zero
+	for i := 0; i < 10; i++ {
+		total += MustParse("0.10")
+	}
+	assert.Equal(t, MustParse("1.00"), total)
+}
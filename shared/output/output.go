@@ -0,0 +1,368 @@
+package output
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Output formats
+const (
+	NDJSON = "ndjson"
+	JSON   = "json"
+	CSV    = "csv"
+	TSV    = "tsv"
+	Table  = "table"
+)
+
+// Formats ... are the accepted output formats
+var Formats = []string{NDJSON, JSON, CSV, TSV, Table}
+
+// ErrUnknownFormat ... is returned for a format not in Formats
+var ErrUnknownFormat = errors.New("Unknown output format")
+
+// Writer ... writes a list of records. CSV, TSV and table columns are the JSON fields of the first record, with
+// embedded structs and maps flattened, in struct field order. Close must be called to finish the output.
+type Writer interface {
+	Write(record interface{}) error
+	Close() error
+}
+
+// IsFormat ... returns whether format is one of Formats
+func IsFormat(format string) bool {
+	for _, known := range Formats {
+		if format == known {
+			return true
+		}
+	}
+	return false
+}
+
+// NewWriter ... returns a Writer of format to w
+func NewWriter(w io.Writer, format string) (Writer, error) {
+	switch format {
+	case NDJSON:
+		return &ndjsonWriter{w: w}, nil
+	case JSON:
+		return &jsonWriter{w: w}, nil
+	case CSV:
+		cw := csv.NewWriter(w)
+		return &rowWriter{write: cw.Write, flush: csvFlush(cw)}, nil
+	case TSV:
+		return &rowWriter{write: tsvWrite(w)}, nil
+	case Table:
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		return &rowWriter{write: tableWrite(tw), flush: tw.Flush, upperHeader: true}, nil
+	}
+
+	return nil, ErrUnknownFormat
+}
+
+// WriteDocument ... writes a single record: indented for json, and as a one-row list for the other formats
+func WriteDocument(w io.Writer, format string, record interface{}) error {
+	if format == JSON {
+		out, err := json.MarshalIndent(record, "", "  ")
+		if err != nil {
+			return err
+		}
+
+		_, err = fmt.Fprintln(w, string(out))
+		return err
+	}
+
+	writer, err := NewWriter(w, format)
+	if err != nil {
+		return err
+	}
+
+	if err = writer.Write(record); err != nil {
+		return err
+	}
+	return writer.Close()
+}
+
+// Open ... returns the file at path for writing, or stdout for "" and "-". Closing stdout is a no-op.
+func Open(path string) (io.WriteCloser, error) {
+	if path == "" || path == "-" {
+		return nopCloser{os.Stdout}, nil
+	}
+
+	return os.Create(path)
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+// ndjsonWriter ... writes one JSON object per line
+type ndjsonWriter struct {
+	w io.Writer
+}
+
+func (n *ndjsonWriter) Write(record interface{}) error {
+	out, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(n.w, string(out))
+	return err
+}
+
+func (n *ndjsonWriter) Close() error {
+	return nil
+}
+
+// jsonWriter ... writes one indented JSON array, streaming the records as they are written
+type jsonWriter struct {
+	w       io.Writer
+	written int
+}
+
+func (j *jsonWriter) Write(record interface{}) error {
+	out, err := json.MarshalIndent(record, "  ", "  ")
+	if err != nil {
+		return err
+	}
+
+	separator := ",\n  "
+	if j.written == 0 {
+		separator = "[\n  "
+	}
+	j.written++
+
+	_, err = fmt.Fprint(j.w, separator+string(out))
+	return err
+}
+
+func (j *jsonWriter) Close() error {
+	closing := "\n]\n"
+	if j.written == 0 {
+		closing = "[]\n"
+	}
+
+	_, err := fmt.Fprint(j.w, closing)
+	return err
+}
+
+// rowWriter ... writes a header row followed by a row per record
+type rowWriter struct {
+	write       func(row []string) error
+	flush       func() error
+	upperHeader bool
+	header      []string
+}
+
+func (r *rowWriter) Write(record interface{}) error {
+	header, row := Flatten(record)
+
+	if r.header == nil {
+		r.header = header
+		if r.upperHeader {
+			upper := make([]string, len(header))
+			for i, column := range header {
+				upper[i] = strings.ToUpper(column)
+			}
+			header = upper
+		}
+
+		if err := r.write(header); err != nil {
+			return err
+		}
+	} else if !reflect.DeepEqual(r.header, header) {
+		return fmt.Errorf("Record columns %v don't match the header %v", header, r.header)
+	}
+
+	return r.write(row)
+}
+
+func (r *rowWriter) Close() error {
+	if r.flush == nil {
+		return nil
+	}
+	return r.flush()
+}
+
+func csvFlush(cw *csv.Writer) func() error {
+	return func() error {
+		cw.Flush()
+		return cw.Error()
+	}
+}
+
+// tsvWrite ... writes tab separated rows, replacing tabs and newlines inside values with spaces
+func tsvWrite(w io.Writer) func(row []string) error {
+	replacer := strings.NewReplacer("\t", " ", "\r\n", " ", "\n", " ", "\r", " ")
+
+	return func(row []string) error {
+		cleaned := make([]string, len(row))
+		for i, value := range row {
+			cleaned[i] = replacer.Replace(value)
+		}
+
+		_, err := fmt.Fprintln(w, strings.Join(cleaned, "\t"))
+		return err
+	}
+}
+
+// tableWrite ... writes aligned rows to a tabwriter, which is flushed on Close
+func tableWrite(tw *tabwriter.Writer) func(row []string) error {
+	replacer := strings.NewReplacer("\t", " ", "\n", " ")
+
+	return func(row []string) error {
+		cleaned := make([]string, len(row))
+		for i, value := range row {
+			cleaned[i] = replacer.Replace(value)
+		}
+
+		_, err := fmt.Fprintln(tw, strings.Join(cleaned, "\t"))
+		return err
+	}
+}
+
+var (
+	timeType      = reflect.TypeOf(time.Time{})
+	stringerType  = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
+	marshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+// Flatten ... returns the columns and values of a record: its JSON fields in struct field order, with embedded
+// structs inlined, nested structs and maps prefixed with their field name ("by_status.LATE"), and slices as JSON
+func Flatten(record interface{}) (header []string, row []string) {
+	flatten("", reflect.ValueOf(record), &header, &row)
+	return
+}
+
+func flatten(name string, v reflect.Value, header, row *[]string) {
+	for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			if v.Kind() == reflect.Ptr && isNested(v.Type().Elem()) {
+				// Keep the columns of a missing nested struct, with empty values
+				flatten(name, reflect.New(v.Type().Elem()).Elem(), header, nil)
+				if row != nil {
+					*row = append(*row, make([]string, len(*header)-len(*row))...)
+				}
+				return
+			}
+			appendColumn(name, "", header, row)
+			return
+		}
+		v = v.Elem()
+	}
+
+	if !v.IsValid() {
+		appendColumn(name, "", header, row)
+		return
+	}
+
+	switch {
+	case isNested(v.Type()) && v.Kind() == reflect.Struct:
+		flattenStruct(name, v, header, row)
+	case v.Kind() == reflect.Map:
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+		})
+		for _, key := range keys {
+			flatten(join(name, fmt.Sprint(key.Interface())), v.MapIndex(key), header, row)
+		}
+	default:
+		appendColumn(name, scalar(v), header, row)
+	}
+}
+
+// isNested ... returns whether values of t are flattened into several columns
+func isNested(t reflect.Type) bool {
+	if t == timeType || t.Implements(stringerType) || t.Implements(marshalerType) {
+		return false
+	}
+	return t.Kind() == reflect.Struct
+}
+
+func flattenStruct(name string, v reflect.Value, header, row *[]string) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+
+		tag := strings.Split(field.Tag.Get("json"), ",")[0]
+		if tag == "-" {
+			continue
+		}
+
+		if field.Anonymous && tag == "" {
+			flatten(name, v.Field(i), header, row)
+			continue
+		}
+
+		if tag == "" {
+			tag = field.Name
+		}
+		flatten(join(name, tag), v.Field(i), header, row)
+	}
+}
+
+// scalar ... returns the cell value of a value that is not flattened further
+func scalar(v reflect.Value) string {
+	if v.Type() == timeType {
+		t := v.Interface().(time.Time)
+		if t.IsZero() {
+			return ""
+		}
+		return t.Format(time.RFC3339)
+	}
+
+	if v.Type().Implements(stringerType) {
+		return v.Interface().(fmt.Stringer).String()
+	}
+
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return ""
+		}
+		out, err := json.Marshal(v.Interface())
+		if err != nil {
+			return ""
+		}
+		return string(out)
+	}
+
+	if v.Type().Implements(marshalerType) {
+		out, err := json.Marshal(v.Interface())
+		if err != nil {
+			return ""
+		}
+		return strings.Trim(string(out), `"`)
+	}
+
+	return fmt.Sprint(v.Interface())
+}
+
+func appendColumn(name, value string, header, row *[]string) {
+	*header = append(*header, name)
+	if row != nil {
+		*row = append(*row, value)
+	}
+}
+
+func join(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "." + name
+}
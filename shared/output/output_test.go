@@ -0,0 +1,151 @@
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"true_accord/shared/money"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testStatus struct {
+	Status string `json:"status"`
+}
+
+type testRecord struct {
+	ID     int64       `json:"id"`
+	Amount money.Money `json:"amount"`
+	Note   string      `json:"note"`
+	Due    *time.Time  `json:"due"`
+	testStatus
+	Counts  map[string]int `json:"counts"`
+	Tags    []string       `json:"tags"`
+	Nested  *testStatus    `json:"nested"`
+	private string
+	Skipped string `json:"-"`
+}
+
+func testRecords() []testRecord {
+	due := time.Date(2020, 10, 30, 0, 0, 0, 0, time.UTC)
+	return []testRecord{
+		{ID: 1, Amount: money.MustParse("10.5"), Note: "first, with comma", Due: &due, testStatus: testStatus{"LATE"}, Counts: map[string]int{"b": 2, "a": 1}, Tags: []string{"x"}, Nested: &testStatus{"CURRENT"}},
+		{ID: 2, Amount: money.MustParse("3"), Note: "tab\there", testStatus: testStatus{"CURRENT"}, Counts: map[string]int{"a": 0, "b": 0}},
+	}
+}
+
+func writeAll(t *testing.T, format string) string {
+	var b bytes.Buffer
+	writer, err := NewWriter(&b, format)
+	assert.Nil(t, err)
+
+	for _, record := range testRecords() {
+		assert.Nil(t, writer.Write(record))
+	}
+	assert.Nil(t, writer.Close())
+
+	return b.String()
+}
+
+func TestFlattenSuccess(t *testing.T) {
+	header, row := Flatten(testRecords()[0])
+
+	assert.Equal(t, []string{"id", "amount", "note", "due", "status", "counts.a", "counts.b", "tags", "nested.status"}, header)
+	assert.Equal(t, []string{"1", "10.50", "first, with comma", "2020-10-30T00:00:00Z", "LATE", "1", "2", `["x"]`, "CURRENT"}, row)
+
+	header, row = Flatten(&testRecords()[1])
+	assert.Equal(t, 9, len(header), "Missing nested structs keep their columns")
+	assert.Equal(t, []string{"2", "3.00", "tab\there", "", "CURRENT", "0", "0", "", ""}, row)
+}
+
+func TestNewWriterSuccessNDJSON(t *testing.T) {
+	out := writeAll(t, NDJSON)
+
+	lines := bytes.Split(bytes.TrimSpace([]byte(out)), []byte("\n"))
+	assert.Equal(t, 2, len(lines))
+
+	var record testRecord
+	assert.Nil(t, json.Unmarshal(lines[1], &record))
+	assert.Equal(t, int64(2), record.ID)
+}
+
+func TestNewWriterSuccessJSON(t *testing.T) {
+	var records []testRecord
+	assert.Nil(t, json.Unmarshal([]byte(writeAll(t, JSON)), &records))
+	assert.Equal(t, testRecords()[0].Amount, records[0].Amount)
+	assert.Equal(t, 2, len(records))
+
+	var b bytes.Buffer
+	writer, _ := NewWriter(&b, JSON)
+	assert.Nil(t, writer.Close())
+	assert.Equal(t, "[]\n", b.String())
+}
+
+func TestNewWriterSuccessCSV(t *testing.T) {
+	assert.Equal(t, `id,amount,note,due,status,counts.a,counts.b,tags,nested.status
+1,10.50,"first, with comma",2020-10-30T00:00:00Z,LATE,1,2,"[""x""]",CURRENT
+2,3.00,tab	here,,CURRENT,0,0,,
+`, writeAll(t, CSV))
+}
+
+func TestNewWriterSuccessTSV(t *testing.T) {
+	assert.Equal(t, "id\tamount\tnote\tdue\tstatus\tcounts.a\tcounts.b\ttags\tnested.status\n"+
+		"1\t10.50\tfirst, with comma\t2020-10-30T00:00:00Z\tLATE\t1\t2\t[\"x\"]\tCURRENT\n"+
+		"2\t3.00\ttab here\t\tCURRENT\t0\t0\t\t\n", writeAll(t, TSV))
+}
+
+func TestNewWriterSuccessTable(t *testing.T) {
+	assert.Equal(t, ""+
+		"ID  AMOUNT  NOTE               DUE                   STATUS   COUNTS.A  COUNTS.B  TAGS   NESTED.STATUS\n"+
+		"1   10.50   first, with comma  2020-10-30T00:00:00Z  LATE     1         2         [\"x\"]  CURRENT\n"+
+		"2   3.00    tab here                                 CURRENT  0         0                \n", writeAll(t, Table))
+}
+
+func TestNewWriterFailureMismatchedColumns(t *testing.T) {
+	var b bytes.Buffer
+	writer, _ := NewWriter(&b, CSV)
+
+	assert.Nil(t, writer.Write(testStatus{"LATE"}))
+	assert.NotNil(t, writer.Write(testRecords()[0]))
+}
+
+func TestNewWriterFailureUnknownFormat(t *testing.T) {
+	_, err := NewWriter(&bytes.Buffer{}, "xml")
+
+	assert.Equal(t, ErrUnknownFormat, err)
+	assert.False(t, IsFormat("xml"))
+	assert.True(t, IsFormat(Table))
+}
+
+func TestWriteDocumentSuccess(t *testing.T) {
+	var b bytes.Buffer
+	assert.Nil(t, WriteDocument(&b, JSON, testStatus{"LATE"}))
+	assert.Equal(t, "{\n  \"status\": \"LATE\"\n}\n", b.String())
+
+	b.Reset()
+	assert.Nil(t, WriteDocument(&b, CSV, testStatus{"LATE"}))
+	assert.Equal(t, "status\nLATE\n", b.String())
+}
+
+func TestOpenSuccessFile(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "output")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "debts.csv")
+
+	w, err := Open(path)
+	assert.Nil(t, err)
+	assert.Nil(t, WriteDocument(w, CSV, testStatus{"LATE"}))
+	assert.Nil(t, w.Close())
+
+	b, _ := ioutil.ReadFile(path)
+	assert.Equal(t, "status\nLATE\n", string(b))
+
+	stdout, err := Open("-")
+	assert.Nil(t, err)
+	assert.Nil(t, stdout.Close())
+}
@@ -0,0 +1,139 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"true_accord/shared/clock"
+)
+
+// Limiter ... is a token bucket that allows rate requests per second on average with bursts of up to burst
+// requests. It is safe for use by multiple goroutines; waiters are served in the order they call Wait.
+type Limiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+
+	clock clock.Clock
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// NewLimiter ... returns a full token bucket refilled at rate tokens per second, holding at most burst tokens
+func NewLimiter(rate float64, burst int) *Limiter {
+	return NewLimiterWithClock(rate, burst, clock.NewClock(), sleepContext)
+}
+
+// NewLimiterWithClock ... returns a Limiter that reads the time from c and waits with sleep, for tests
+func NewLimiterWithClock(rate float64, burst int, c clock.Clock, sleep func(ctx context.Context, d time.Duration) error) *Limiter {
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &Limiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   c.Now(),
+		clock:  c,
+		sleep:  sleep,
+	}
+}
+
+// Wait ... blocks until a request may be made or ctx is cancelled
+func (l *Limiter) Wait(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	delay := l.reserve()
+	if delay <= 0 {
+		return nil
+	}
+
+	if err := l.sleep(ctx, delay); err != nil {
+		l.cancelReservation()
+		return err
+	}
+
+	return nil
+}
+
+// reserve ... takes a token (possibly going into debt) and returns how long to wait until it is available
+func (l *Limiter) reserve() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.clock.Now()
+	if elapsed := now.Sub(l.last); elapsed > 0 {
+		l.tokens += elapsed.Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+	}
+	l.last = now
+
+	l.tokens--
+	if l.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
+
+// cancelReservation ... returns the token of a Wait that was cancelled
+func (l *Limiter) cancelReservation() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.tokens++
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+}
+
+// Parse ... returns a Limiter for a "RATE" or "RATE:BURST" spec such as "5" or "5:20", in requests per second.
+// The burst defaults to the rate rounded up.
+func Parse(spec string) (*Limiter, error) {
+	invalid := errors.New("Invalid rate limit " + strconv.Quote(spec) + ", expected RATE or RATE:BURST requests per second")
+
+	parts := strings.SplitN(strings.TrimSpace(spec), ":", 2)
+
+	rate, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil || math.IsNaN(rate) || math.IsInf(rate, 0) || rate <= 0 {
+		return nil, invalid
+	}
+
+	burst := int(rate)
+	if float64(burst) < rate {
+		burst++
+	}
+
+	if len(parts) == 2 {
+		burst, err = strconv.Atoi(parts[1])
+		if err != nil || burst < 1 {
+			return nil, invalid
+		}
+	}
+
+	return NewLimiter(rate, burst), nil
+}
+
+// sleepContext ... waits for d or until ctx is cancelled, whichever comes first
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
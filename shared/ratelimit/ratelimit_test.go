@@ -0,0 +1,140 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeClock ... is a clock that only moves when a waiter sleeps
+type fakeClock struct {
+	mu    sync.Mutex
+	now   time.Time
+	slept []time.Duration
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Sleep(ctx context.Context, d time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.slept = append(c.slept, d)
+	return nil
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2020, 10, 30, 12, 0, 0, 0, time.UTC)}
+}
+
+func TestWaitSuccessBurstThenRate(t *testing.T) {
+	c := newFakeClock()
+	limiter := NewLimiterWithClock(2, 3, c, c.Sleep)
+
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, limiter.Wait(context.Background()))
+	}
+	assert.Empty(t, c.slept, "The burst should not wait")
+
+	assert.Nil(t, limiter.Wait(context.Background()))
+	assert.Nil(t, limiter.Wait(context.Background()))
+	assert.Equal(t, []time.Duration{500 * time.Millisecond, time.Second}, c.slept)
+}
+
+func TestWaitSuccessRefillsOverTime(t *testing.T) {
+	c := newFakeClock()
+	limiter := NewLimiterWithClock(1, 2, c, c.Sleep)
+
+	assert.Nil(t, limiter.Wait(context.Background()))
+	assert.Nil(t, limiter.Wait(context.Background()))
+
+	// Refill is capped at the burst size
+	c.Advance(time.Minute)
+	assert.Nil(t, limiter.Wait(context.Background()))
+	assert.Nil(t, limiter.Wait(context.Background()))
+	assert.Empty(t, c.slept)
+
+	assert.Nil(t, limiter.Wait(context.Background()))
+	assert.Equal(t, []time.Duration{time.Second}, c.slept)
+}
+
+func TestWaitSuccessSharedAcrossGoroutines(t *testing.T) {
+	c := newFakeClock()
+	limiter := NewLimiterWithClock(10, 10, c, c.Sleep)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 30; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			limiter.Wait(context.Background())
+		}()
+	}
+	wg.Wait()
+
+	// 10 requests fit in the burst; the other 20 are spread over the following 2 seconds
+	assert.Equal(t, 20, len(c.slept))
+	longest := time.Duration(0)
+	for _, d := range c.slept {
+		if d > longest {
+			longest = d
+		}
+	}
+	assert.Equal(t, 2*time.Second, longest)
+}
+
+func TestWaitFailureCancelledReturnsToken(t *testing.T) {
+	c := newFakeClock()
+	cancelled := func(ctx context.Context, d time.Duration) error {
+		return context.Canceled
+	}
+	limiter := NewLimiterWithClock(1, 1, c, cancelled)
+
+	assert.Nil(t, limiter.Wait(context.Background()))
+	assert.Equal(t, context.Canceled, limiter.Wait(context.Background()))
+
+	c.Advance(time.Second)
+	assert.Nil(t, limiter.Wait(context.Background()), "The cancelled wait should not hold on to its token")
+}
+
+func TestWaitFailureContextAlreadyCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	assert.Equal(t, context.Canceled, NewLimiter(1, 1).Wait(ctx))
+}
+
+func TestParseSuccess(t *testing.T) {
+	limiter, err := Parse("5")
+	assert.Nil(t, err)
+	assert.Equal(t, float64(5), limiter.rate)
+	assert.Equal(t, float64(5), limiter.burst)
+
+	limiter, err = Parse("0.5:3")
+	assert.Nil(t, err)
+	assert.Equal(t, 0.5, limiter.rate)
+	assert.Equal(t, float64(3), limiter.burst)
+
+	limiter, err = Parse("2.5")
+	assert.Nil(t, err)
+	assert.Equal(t, float64(3), limiter.burst)
+}
+
+func TestParseFailureInvalidSpec(t *testing.T) {
+	for _, spec := range []string{"", "fast", "0", "-1", "5:", "5:0", "5:x", "NaN", "Inf", "+Inf", "-Inf", "nan:5"} {
+		_, err := Parse(spec)
+		assert.NotNil(t, err, spec)
+	}
+}
@@ -0,0 +1,102 @@
+package reconciliation
+
+import (
+	"time"
+
+	"true_accord/shared/schedule"
+	"true_accord/shared/trueaccordapi"
+)
+
+// PlanPayments ... is one payment plan in the history of a debt with the payments attributed to it
+type PlanPayments struct {
+	PaymentPlan trueaccordapi.PaymentPlan `json:"payment_plan"`
+	Active      bool                      `json:"active"`
+	Payments    []trueaccordapi.Payment   `json:"payments"`
+}
+
+// History ... orders the payment plans of a debt by start date, marks the plan active as of asOf and attributes
+// each payment to the plan in effect on its date, so a payment recorded against a broken plan after the next
+// plan started counts toward the next plan.
+//
+// The active plan is the latest plan started on or before asOf, or the earliest plan if none has started yet.
+// Payments dated before every plan, or with a date that isn't YYYY-MM-DD, stay with the plan they were recorded against.
+// Dates are calendar dates in the location of asOf.
+func History(paymentPlans []trueaccordapi.PaymentPlan, payments []trueaccordapi.Payment, asOf time.Time) []PlanPayments {
+	ordered := append([]trueaccordapi.PaymentPlan(nil), paymentPlans...)
+	trueaccordapi.SortPaymentPlans(ordered)
+
+	history := make([]PlanPayments, len(ordered))
+	startDates := make([]time.Time, len(ordered))
+	indexByID := make(map[int64]int)
+
+	for i, paymentPlan := range ordered {
+		history[i] = PlanPayments{PaymentPlan: paymentPlan, Payments: []trueaccordapi.Payment{}}
+		if _, found := indexByID[paymentPlan.ID]; !found {
+			indexByID[paymentPlan.ID] = i
+		}
+
+		// Unparseable start dates are left zero and are never in effect
+		if startDate, err := schedule.ParseDate(paymentPlan.StartDate, asOf.Location()); err == nil {
+			startDates[i] = startDate
+		}
+	}
+
+	if len(history) == 0 {
+		return history
+	}
+
+	history[activeIndex(startDates, calendarDate(asOf))].Active = true
+
+	for _, payment := range payments {
+		i, found := indexByID[payment.PaymentPlanID]
+
+		if paymentDate, err := schedule.ParseDate(payment.Date, asOf.Location()); err == nil {
+			if inEffect := planInEffect(startDates, paymentDate); inEffect >= 0 {
+				i, found = inEffect, true
+			}
+		}
+
+		if !found {
+			i = 0
+		}
+		history[i].Payments = append(history[i].Payments, payment)
+	}
+
+	return history
+}
+
+// Active ... returns the active plan of a history, or nil if the debt has no payment plan
+func Active(history []PlanPayments) *PlanPayments {
+	for i := range history {
+		if history[i].Active {
+			return &history[i]
+		}
+	}
+	return nil
+}
+
+// activeIndex ... returns the index of the plan active on date given the plans' start dates in order
+func activeIndex(startDates []time.Time, date time.Time) int {
+	if i := planInEffect(startDates, date); i >= 0 {
+		return i
+	}
+
+	// No plan has started: the earliest upcoming plan is active
+	for i, startDate := range startDates {
+		if !startDate.IsZero() {
+			return i
+		}
+	}
+	return 0
+}
+
+// planInEffect ... returns the index of the latest plan started on or before date, or -1 if none has
+func planInEffect(startDates []time.Time, date time.Time) int {
+	inEffect := -1
+	for i, startDate := range startDates {
+		if !startDate.IsZero() && !startDate.After(date) {
+			inEffect = i
+		}
+	}
+	return inEffect
+}
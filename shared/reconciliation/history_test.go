@@ -0,0 +1,53 @@
+package reconciliation
+
+import (
+	"testing"
+
+	"true_accord/shared/money"
+	"true_accord/shared/trueaccordapi"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testPlanHistory ... returns a plan broken in October and the plan that replaced it on 2020-11-01, out of order
+func testPlanHistory() []trueaccordapi.PaymentPlan {
+	return []trueaccordapi.PaymentPlan{
+		{ID: 8, DebtID: 1, AmountToPay: money.MustParse("80"), InstallmentFrequency: "WEEKLY", InstallmentAmount: money.MustParse("20"), StartDate: "2020-11-01"},
+		{ID: 3, DebtID: 1, AmountToPay: money.MustParse("100"), InstallmentFrequency: "WEEKLY", InstallmentAmount: money.MustParse("25"), StartDate: "2020-10-01"},
+	}
+}
+
+func TestHistorySuccessAttribution(t *testing.T) {
+	testPayments := []trueaccordapi.Payment{
+		{Amount: money.MustParse("25"), Date: "2020-10-01", PaymentPlanID: 3},
+		{Amount: money.MustParse("20"), Date: "2020-11-01", PaymentPlanID: 3},
+		{Amount: money.MustParse("5"), Date: "2020-09-20", PaymentPlanID: 8},
+		{Amount: money.MustParse("20"), Date: "11/08/2020", PaymentPlanID: 8},
+	}
+
+	history := History(testPlanHistory(), testPayments, date(t, "2020-11-05"))
+
+	assert.Equal(t, 2, len(history))
+	assert.Equal(t, int64(3), history[0].PaymentPlan.ID, "Plans are ordered by start_date")
+	assert.False(t, history[0].Active)
+	assert.True(t, history[1].Active)
+	assert.Equal(t, int64(8), Active(history).PaymentPlan.ID)
+
+	assert.Equal(t, []trueaccordapi.Payment{testPayments[0]}, history[0].Payments)
+	assert.Equal(t, []trueaccordapi.Payment{
+		testPayments[1], // recorded against the broken plan after the new plan started
+		testPayments[2], // dated before every plan, so left with its own plan
+		testPayments[3], // unparseable date, so left with its own plan
+	}, history[1].Payments)
+}
+
+func TestHistorySuccessActivePlan(t *testing.T) {
+	assert.Equal(t, int64(3), Active(History(testPlanHistory(), nil, date(t, "2020-10-31"))).PaymentPlan.ID)
+	assert.Equal(t, int64(3), Active(History(testPlanHistory(), nil, date(t, "2020-09-01"))).PaymentPlan.ID, "Before any plan starts the earliest is active")
+
+	unparseable := append(testPlanHistory(), trueaccordapi.PaymentPlan{ID: 9, StartDate: "12/01/2020"})
+	assert.Equal(t, int64(8), Active(History(unparseable, nil, date(t, "2020-12-05"))).PaymentPlan.ID)
+
+	assert.Empty(t, History(nil, nil, date(t, "2020-10-31")))
+	assert.Nil(t, Active(nil))
+}
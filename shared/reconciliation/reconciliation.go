@@ -0,0 +1,185 @@
+package reconciliation
+
+import (
+	"sort"
+	"time"
+
+	"true_accord/shared/money"
+	"true_accord/shared/schedule"
+	"true_accord/shared/trueaccordapi"
+)
+
+// Delinquency statuses of a payment plan
+const (
+	StatusCurrent       = "CURRENT"
+	StatusLate          = "LATE"
+	StatusDefaulted     = "DEFAULTED"
+	StatusPaidOff       = "PAID_OFF"
+	StatusNoPaymentPlan = "NO_PAYMENT_PLAN"
+	// StatusFailed ... marks a debt whose payment plan couldn't be scheduled or reconciled
+	StatusFailed = "FAILED"
+)
+
+// Statuses ... lists every delinquency status
+var Statuses = []string{StatusCurrent, StatusLate, StatusDefaulted, StatusPaidOff, StatusNoPaymentPlan, StatusFailed}
+
+// DefaultedAfterDays ... is the number of days past due after which a late plan is considered defaulted
+const DefaultedAfterDays = 90
+
+// Delinquency ... is the delinquency summary of a payment plan as of a date
+type Delinquency struct {
+	DaysPastDue        int         `json:"days_past_due"`
+	AmountPastDue      money.Money `json:"amount_past_due"`
+	MissedInstallments int         `json:"missed_installments"`
+	Status             string      `json:"delinquency_status"`
+}
+
+// Allocation ... is the portion of a payment applied to an installment
+type Allocation struct {
+	PaymentIndex      int         `json:"payment_index"`
+	InstallmentNumber int         `json:"installment_number"`
+	Amount            money.Money `json:"amount"`
+}
+
+// InstallmentStatus ... is an installment with the payments applied to it
+type InstallmentStatus struct {
+	schedule.Installment
+
+	AmountPaid money.Money `json:"amount_paid"`
+	PaidOn     *time.Time  `json:"paid_on"`
+}
+
+// Result ... is the outcome of matching payments against a payment plan schedule
+type Result struct {
+	Delinquency
+
+	TotalPaid    money.Money         `json:"total_paid"`
+	Installments []InstallmentStatus `json:"installments"`
+	Allocations  []Allocation        `json:"allocations"`
+	// SkippedPayments ... are the indexes of payments whose date couldn't be parsed, left out of the reconciliation
+	SkippedPayments []int `json:"skipped_payments,omitempty"`
+}
+
+// NoPaymentPlan ... returns the delinquency reported for a debt without a payment plan
+func NoPaymentPlan() Delinquency {
+	return Delinquency{Status: StatusNoPaymentPlan}
+}
+
+// Failed ... returns the delinquency reported for a debt whose payment plan couldn't be scheduled or reconciled
+func Failed() Delinquency {
+	return Delinquency{Status: StatusFailed}
+}
+
+// Reconcile ... applies payments made on or before asOf to installments in due date order (oldest first)
+// and reports what is past due as of that date. Payments dated after asOf are ignored.
+// Payment dates are calendar dates in the location of asOf, which should match the installments' location.
+// Payments with an unparseable date are skipped and reported in SkippedPayments.
+func Reconcile(installments []schedule.Installment, payments []trueaccordapi.Payment, asOf time.Time) (res Result) {
+	asOfDate := calendarDate(asOf)
+
+	type datedPayment struct {
+		index  int
+		date   time.Time
+		amount money.Money
+	}
+
+	var applicable []datedPayment
+	for i, payment := range payments {
+		paymentDate, err := schedule.ParseDate(payment.Date, asOf.Location())
+		if err != nil {
+			res.SkippedPayments = append(res.SkippedPayments, i)
+			continue
+		}
+
+		if paymentDate.After(asOfDate) {
+			continue
+		}
+
+		applicable = append(applicable, datedPayment{i, paymentDate, payment.Amount})
+		res.TotalPaid += payment.Amount
+	}
+
+	sort.SliceStable(applicable, func(i, j int) bool {
+		return applicable[i].date.Before(applicable[j].date)
+	})
+
+	res.Installments = make([]InstallmentStatus, len(installments))
+	for i, installment := range installments {
+		res.Installments[i] = InstallmentStatus{Installment: installment}
+	}
+
+	current := 0
+	for _, payment := range applicable {
+		remaining := payment.amount
+
+		for remaining > money.Zero && current < len(res.Installments) {
+			installment := &res.Installments[current]
+			applied := money.Min(remaining, installment.AmountDue-installment.AmountPaid)
+
+			installment.AmountPaid += applied
+			remaining -= applied
+			res.Allocations = append(res.Allocations, Allocation{payment.index, installment.Number, applied})
+
+			if installment.AmountPaid == installment.AmountDue {
+				paidOn := payment.date
+				installment.PaidOn = &paidOn
+				current++
+			}
+		}
+	}
+
+	var oldestPastDue time.Time
+	for _, installment := range res.Installments {
+		if !installment.DueDate.Before(asOfDate) || installment.AmountPaid == installment.AmountDue {
+			continue
+		}
+
+		if oldestPastDue.IsZero() {
+			oldestPastDue = installment.DueDate
+		}
+
+		res.MissedInstallments++
+		res.AmountPastDue += installment.AmountDue - installment.AmountPaid
+	}
+
+	if !oldestPastDue.IsZero() {
+		res.DaysPastDue = DaysBetween(oldestPastDue, asOfDate)
+	}
+
+	res.Status = status(res)
+	return res
+}
+
+func status(res Result) string {
+	if len(res.Installments) > 0 && res.TotalPaid >= res.Installments[len(res.Installments)-1].CumulativeAmountDue {
+		return StatusPaidOff
+	}
+
+	if res.AmountPastDue.IsZero() {
+		return StatusCurrent
+	}
+
+	if res.DaysPastDue >= DefaultedAfterDays {
+		return StatusDefaulted
+	}
+
+	return StatusLate
+}
+
+// calendarDate ... returns midnight of the calendar date of t in its own location, matching parsed API dates
+func calendarDate(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+}
+
+// DaysBetween ... returns the number of calendar days from the date of a to the date of b, each in its own location.
+// Unlike dividing the elapsed hours by 24 it isn't thrown off by daylight saving time changes.
+func DaysBetween(a, b time.Time) int {
+	return int(UTCDate(b).Sub(UTCDate(a)).Hours() / 24)
+}
+
+// UTCDate ... returns the calendar date of t in its own location as midnight UTC, so dates in different zones compare by day
+func UTCDate(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,135 @@
+package reconciliation
+
+import (
+	"testing"
+	"time"
+
+	"true_accord/shared/money"
+	"true_accord/shared/schedule"
+	"true_accord/shared/trueaccordapi"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func date(t *testing.T, value string) time.Time {
+	d, err := time.Parse(schedule.DateLayout, value)
+	if err != nil {
+		t.Fatalf("Failed to parse test date %s", value)
+	}
+	return d
+}
+
+// testInstallments ... returns four weekly installments of 25.00 starting 2020-09-28
+func testInstallments(t *testing.T) []schedule.Installment {
+	testPaymentPlan := trueaccordapi.PaymentPlan{AmountToPay: money.MustParse("100"), InstallmentFrequency: schedule.Weekly, InstallmentAmount: money.MustParse("25"), StartDate: "2020-09-28"}
+
+	installments, err := schedule.Generate(&testPaymentPlan)
+	if err != nil {
+		t.Fatalf("Failed to generate test installments")
+	}
+	return installments
+}
+
+func TestReconcileSuccessCurrent(t *testing.T) {
+	testPayments := []trueaccordapi.Payment{
+		{Amount: money.MustParse("25"), Date: "2020-09-28"},
+		{Amount: money.MustParse("25"), Date: "2020-10-05"},
+	}
+
+	res := Reconcile(testInstallments(t), testPayments, date(t, "2020-10-08"))
+
+	assert.Equal(t, Delinquency{Status: StatusCurrent}, res.Delinquency)
+	assert.Equal(t, money.MustParse("50"), res.TotalPaid)
+	assert.Equal(t, date(t, "2020-10-05"), *res.Installments[1].PaidOn)
+	assert.Nil(t, res.Installments[2].PaidOn)
+}
+
+func TestReconcileSuccessDueTodayIsNotPastDue(t *testing.T) {
+	testPayments := []trueaccordapi.Payment{{Amount: money.MustParse("25"), Date: "2020-09-28"}}
+
+	res := Reconcile(testInstallments(t), testPayments, date(t, "2020-10-05").Add(20*time.Hour))
+
+	assert.Equal(t, StatusCurrent, res.Status)
+}
+
+func TestReconcileSuccessPaymentDatesInLocation(t *testing.T) {
+	losAngeles, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testPaymentPlan := trueaccordapi.PaymentPlan{AmountToPay: money.MustParse("100"), InstallmentFrequency: schedule.Weekly, InstallmentAmount: money.MustParse("25"), StartDate: "2020-09-28"}
+	installments, err := schedule.GenerateIn(&testPaymentPlan, losAngeles)
+	if err != nil {
+		t.Fatalf("Failed to generate test installments")
+	}
+	testPayments := []trueaccordapi.Payment{{Amount: money.MustParse("25"), Date: "2020-09-28"}, {Amount: money.MustParse("25"), Date: "2020-10-13"}}
+
+	// Still 2020-10-12 in Los Angeles: the second payment hasn't been made and the installment due today isn't past due
+	res := Reconcile(installments, testPayments, time.Date(2020, 10, 13, 2, 0, 0, 0, time.UTC).In(losAngeles))
+
+	assert.Equal(t, money.MustParse("25"), res.TotalPaid)
+	assert.Equal(t, 7, res.DaysPastDue)
+	assert.Equal(t, 1, res.MissedInstallments)
+}
+
+func TestDaysBetweenSuccessAcrossDaylightSavingTime(t *testing.T) {
+	losAngeles, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, 1, DaysBetween(time.Date(2020, 10, 31, 0, 0, 0, 0, losAngeles), time.Date(2020, 11, 1, 23, 0, 0, 0, losAngeles)))
+	assert.Equal(t, 7, DaysBetween(time.Date(2020, 11, 1, 0, 0, 0, 0, losAngeles), time.Date(2020, 11, 8, 0, 0, 0, 0, losAngeles)))
+}
+
+func TestReconcileSuccessLate(t *testing.T) {
+	testPayments := []trueaccordapi.Payment{
+		{Amount: money.MustParse("30"), Date: "2020-09-28"},
+		{Amount: money.MustParse("100"), Date: "2020-12-01"},
+	}
+
+	res := Reconcile(testInstallments(t), testPayments, date(t, "2020-10-15"))
+
+	assert.Equal(t, Delinquency{DaysPastDue: 10, AmountPastDue: money.MustParse("45"), MissedInstallments: 2, Status: StatusLate}, res.Delinquency)
+	assert.Equal(t, money.MustParse("5"), res.Installments[1].AmountPaid)
+	assert.Equal(t, []Allocation{
+		{PaymentIndex: 0, InstallmentNumber: 1, Amount: money.MustParse("25")},
+		{PaymentIndex: 0, InstallmentNumber: 2, Amount: money.MustParse("5")},
+	}, res.Allocations)
+}
+
+func TestReconcileSuccessDefaulted(t *testing.T) {
+	res := Reconcile(testInstallments(t), nil, date(t, "2021-01-01"))
+
+	assert.Equal(t, Delinquency{DaysPastDue: 95, AmountPastDue: money.MustParse("100"), MissedInstallments: 4, Status: StatusDefaulted}, res.Delinquency)
+}
+
+func TestReconcileSuccessPaidOffOutOfOrderPayments(t *testing.T) {
+	testPayments := []trueaccordapi.Payment{
+		{Amount: money.MustParse("60"), Date: "2020-10-10"},
+		{Amount: money.MustParse("40"), Date: "2020-09-28"},
+	}
+
+	res := Reconcile(testInstallments(t), testPayments, date(t, "2020-10-11"))
+
+	assert.Equal(t, Delinquency{Status: StatusPaidOff}, res.Delinquency)
+	assert.Equal(t, 1, res.Allocations[0].PaymentIndex)
+	assert.Equal(t, date(t, "2020-09-28"), *res.Installments[0].PaidOn)
+	assert.Equal(t, date(t, "2020-10-10"), *res.Installments[3].PaidOn)
+}
+
+func TestReconcileSuccessSkipsInvalidPaymentDate(t *testing.T) {
+	testPayments := []trueaccordapi.Payment{
+		{Amount: money.MustParse("25"), Date: "2020-09-28"},
+		{Amount: money.MustParse("25"), Date: "10/05/2020"},
+		{Amount: money.MustParse("25"), Date: "2020-10-05"},
+	}
+
+	res := Reconcile(testInstallments(t), testPayments, date(t, "2020-10-11"))
+
+	assert.Equal(t, []int{1}, res.SkippedPayments)
+	assert.Equal(t, Delinquency{Status: StatusCurrent}, res.Delinquency)
+	assert.Equal(t, money.MustParse("50"), res.TotalPaid)
+	assert.Equal(t, 2, res.Allocations[1].PaymentIndex)
+	assert.Equal(t, date(t, "2020-10-05"), *res.Installments[1].PaidOn)
+}
@@ -0,0 +1,123 @@
+package schedule
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Frequency ... computes installment due dates for a payment plan installment_frequency
+type Frequency interface {
+	// DueDate returns the due date of the installment at index n (0-based) of a plan starting on start
+	DueDate(start time.Time, n int) time.Time
+}
+
+// Installment frequencies understood by Lookup without registration
+const (
+	Daily       = "DAILY"
+	Weekly      = "WEEKLY"
+	BiWeekly    = "BI_WEEKLY"
+	SemiMonthly = "SEMI_MONTHLY"
+	Monthly     = "MONTHLY"
+)
+
+// ErrUnhandledFrequency ... is returned by Lookup for installment frequencies with no schedule
+var ErrUnhandledFrequency = errors.New("Unhandled payment interval")
+
+// customDaysPattern matches custom every-N-days frequencies such as EVERY_10_DAYS
+var customDaysPattern = regexp.MustCompile(`^EVERY_([0-9]+)_DAYS$`)
+
+var (
+	frequenciesMu sync.RWMutex
+	frequencies   = map[string]Frequency{
+		Daily:       EveryNDays(1),
+		Weekly:      EveryNDays(7),
+		BiWeekly:    EveryNDays(14),
+		SemiMonthly: semiMonthly{},
+		Monthly:     monthly{},
+	}
+)
+
+// Register ... adds (or replaces) the schedule used for an installment frequency name
+func Register(name string, frequency Frequency) {
+	frequenciesMu.Lock()
+	defer frequenciesMu.Unlock()
+
+	frequencies[strings.ToUpper(name)] = frequency
+}
+
+// Lookup ... returns the schedule for an installment frequency name, including custom EVERY_<N>_DAYS names
+func Lookup(name string) (Frequency, error) {
+	name = strings.ToUpper(strings.TrimSpace(name))
+
+	frequenciesMu.RLock()
+	frequency, ok := frequencies[name]
+	frequenciesMu.RUnlock()
+	if ok {
+		return frequency, nil
+	}
+
+	if match := customDaysPattern.FindStringSubmatch(name); match != nil {
+		days, err := strconv.Atoi(match[1])
+		if err == nil && days > 0 {
+			return EveryNDays(days), nil
+		}
+	}
+
+	return nil, ErrUnhandledFrequency
+}
+
+// EveryNDays ... is a fixed interval of calendar days between installments
+type EveryNDays int
+
+// DueDate ... returns start plus n intervals
+func (d EveryNDays) DueDate(start time.Time, n int) time.Time {
+	return start.AddDate(0, 0, int(d)*n)
+}
+
+// monthly ... is due on the start date's day of month, clamped to the last day of shorter months
+type monthly struct{}
+
+// DueDate ... returns the start day of month n months after start
+func (monthly) DueDate(start time.Time, n int) time.Time {
+	year, month, day := start.Date()
+	return clampedDate(year, month+time.Month(n), day, start)
+}
+
+// semiMonthly ... is due on the 1st and 15th of every month, beginning with the first of those on or after start
+type semiMonthly struct{}
+
+// DueDate ... returns the nth 1st/15th due date on or after start
+func (semiMonthly) DueDate(start time.Time, n int) time.Time {
+	year, month, day := start.Date()
+
+	// Number the half-month slots so slot 0 is the 1st of the start month and slot 1 the 15th
+	firstSlot := 0
+	if day > 15 {
+		firstSlot = 2
+	} else if day > 1 {
+		firstSlot = 1
+	}
+
+	slot := firstSlot + n
+	dueDay := 1
+	if slot%2 != 0 {
+		dueDay = 15
+	}
+
+	return time.Date(year, month+time.Month(slot/2), dueDay, start.Hour(), start.Minute(), start.Second(), start.Nanosecond(), start.Location())
+}
+
+// clampedDate ... returns the given date, using the last day of the month when day is past the end of it
+func clampedDate(year int, month time.Month, day int, clock time.Time) time.Time {
+	firstOfMonth := time.Date(year, month, 1, clock.Hour(), clock.Minute(), clock.Second(), clock.Nanosecond(), clock.Location())
+	lastDay := firstOfMonth.AddDate(0, 1, -1).Day()
+	if day > lastDay {
+		day = lastDay
+	}
+
+	return firstOfMonth.AddDate(0, 0, day-1)
+}
@@ -0,0 +1,86 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func date(t *testing.T, value string) time.Time {
+	d, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		t.Fatalf("Failed to parse test date %s", value)
+	}
+	return d
+}
+
+func dueDates(t *testing.T, frequencyName, start string, count int) []string {
+	frequency, err := Lookup(frequencyName)
+	if err != nil {
+		t.Fatalf("Failed to look up frequency %s", frequencyName)
+	}
+
+	var res []string
+	for n := 0; n < count; n++ {
+		res = append(res, frequency.DueDate(date(t, start), n).Format("2006-01-02"))
+	}
+	return res
+}
+
+func TestLookupSuccessWeekly(t *testing.T) {
+	assert.Equal(t, []string{"2020-09-28", "2020-10-05", "2020-10-12"}, dueDates(t, Weekly, "2020-09-28", 3))
+	assert.Equal(t, []string{"2020-09-28", "2020-10-12", "2020-10-26"}, dueDates(t, BiWeekly, "2020-09-28", 3))
+	assert.Equal(t, []string{"2020-12-31", "2021-01-01"}, dueDates(t, Daily, "2020-12-31", 2))
+}
+
+func TestLookupSuccessCustomDays(t *testing.T) {
+	assert.Equal(t, []string{"2020-02-25", "2020-03-06", "2020-03-16"}, dueDates(t, "EVERY_10_DAYS", "2020-02-25", 3))
+	assert.Equal(t, []string{"2020-01-01", "2020-01-04"}, dueDates(t, "every_3_days", "2020-01-01", 2))
+}
+
+func TestLookupFailureUnhandledFrequency(t *testing.T) {
+	for _, name := range []string{"", "YEARLY", "EVERY_0_DAYS", "EVERY_X_DAYS"} {
+		_, err := Lookup(name)
+		assert.Equal(t, ErrUnhandledFrequency, err, name)
+	}
+}
+
+func TestMonthlySuccessClampsToMonthEnd(t *testing.T) {
+	assert.Equal(t,
+		[]string{"2021-01-31", "2021-02-28", "2021-03-31", "2021-04-30", "2021-05-31"},
+		dueDates(t, Monthly, "2021-01-31", 5))
+}
+
+func TestMonthlySuccessLeapYear(t *testing.T) {
+	assert.Equal(t,
+		[]string{"2020-01-30", "2020-02-29", "2020-03-30"},
+		dueDates(t, Monthly, "2020-01-30", 3))
+
+	leapDayDueDates := dueDates(t, Monthly, "2020-02-29", 13)
+	assert.Equal(t, "2020-03-29", leapDayDueDates[1])
+	assert.Equal(t, "2021-02-28", leapDayDueDates[12])
+}
+
+func TestMonthlySuccessYearBoundary(t *testing.T) {
+	assert.Equal(t, []string{"2020-11-15", "2020-12-15", "2021-01-15"}, dueDates(t, Monthly, "2020-11-15", 3))
+}
+
+func TestSemiMonthlySuccess(t *testing.T) {
+	assert.Equal(t, []string{"2020-10-01", "2020-10-15", "2020-11-01"}, dueDates(t, SemiMonthly, "2020-10-01", 3))
+	assert.Equal(t, []string{"2020-10-15", "2020-11-01", "2020-11-15"}, dueDates(t, SemiMonthly, "2020-10-10", 3))
+	assert.Equal(t, []string{"2020-12-01", "2020-12-15", "2021-01-01"}, dueDates(t, SemiMonthly, "2020-11-20", 3))
+	assert.Equal(t, []string{"2020-02-15", "2020-03-01"}, dueDates(t, SemiMonthly, "2020-02-15", 2))
+}
+
+func TestRegisterSuccess(t *testing.T) {
+	Register("quarterly", quarterly{})
+
+	assert.Equal(t, []string{"2020-11-30", "2021-02-28", "2021-05-30"}, dueDates(t, "QUARTERLY", "2020-11-30", 3))
+}
+
+type quarterly struct{}
+
+func (quarterly) DueDate(start time.Time, n int) time.Time {
+	return monthly{}.DueDate(start, 3*n)
+}
@@ -0,0 +1,93 @@
+package schedule
+
+import (
+	"errors"
+	"time"
+
+	"true_accord/shared/money"
+	"true_accord/shared/trueaccordapi"
+)
+
+// DateLayout ... is the date format used by the TrueAccord API for start_date and payment dates
+const DateLayout = "2006-01-02"
+
+// maxInstallments guards against plans whose installment_amount is tiny relative to amount_to_pay
+const maxInstallments = 100000
+
+// Payment plan validation errors returned by Generate
+var (
+	ErrNoPaymentPlan       = errors.New("No payment plan provided")
+	ErrNoAmountToPay       = errors.New("No payment plan amount to pay")
+	ErrNoInstallmentAmount = errors.New("No installment_amount found")
+	ErrTooManyInstallments = errors.New("Payment plan exceeds the maximum number of installments")
+)
+
+// Installment ... is a single scheduled installment of a payment plan
+type Installment struct {
+	Number              int         `json:"installment_number"`
+	DueDate             time.Time   `json:"due_date"`
+	AmountDue           money.Money `json:"amount_due"`
+	CumulativeAmountDue money.Money `json:"cumulative_amount_due"`
+}
+
+// ParseDate ... returns midnight in loc of a YYYY-MM-DD calendar date from the API
+func ParseDate(value string, loc *time.Location) (time.Time, error) {
+	return time.ParseInLocation(DateLayout, value, loc)
+}
+
+// Generate ... returns every installment of a payment plan in due date order, due at midnight UTC.
+// The final installment is shortened so the cumulative amount due equals amount_to_pay exactly.
+func Generate(paymentPlan *trueaccordapi.PaymentPlan) (installments []Installment, err error) {
+	return GenerateIn(paymentPlan, time.UTC)
+}
+
+// GenerateIn ... returns every installment of a payment plan in due date order, due at midnight in loc
+func GenerateIn(paymentPlan *trueaccordapi.PaymentPlan, loc *time.Location) (installments []Installment, err error) {
+	if paymentPlan == nil {
+		err = ErrNoPaymentPlan
+		return
+	}
+
+	startDate, err := ParseDate(paymentPlan.StartDate, loc)
+	if err != nil {
+		return
+	}
+
+	if paymentPlan.AmountToPay <= money.Zero {
+		err = ErrNoAmountToPay
+		return
+	}
+
+	if paymentPlan.InstallmentAmount <= money.Zero {
+		err = ErrNoInstallmentAmount
+		return
+	}
+
+	frequency, err := Lookup(paymentPlan.InstallmentFrequency)
+	if err != nil {
+		return
+	}
+
+	count := (paymentPlan.AmountToPay + paymentPlan.InstallmentAmount - 1) / paymentPlan.InstallmentAmount
+	if count > maxInstallments {
+		err = ErrTooManyInstallments
+		return
+	}
+
+	installments = make([]Installment, 0, int(count))
+	cumulativeAmountDue := money.Zero
+
+	for n := 0; cumulativeAmountDue < paymentPlan.AmountToPay; n++ {
+		amountDue := money.Min(paymentPlan.InstallmentAmount, paymentPlan.AmountToPay-cumulativeAmountDue)
+		cumulativeAmountDue += amountDue
+
+		installments = append(installments, Installment{
+			Number:              n + 1,
+			DueDate:             frequency.DueDate(startDate, n),
+			AmountDue:           amountDue,
+			CumulativeAmountDue: cumulativeAmountDue,
+		})
+	}
+
+	return installments, nil
+}
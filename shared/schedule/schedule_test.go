@@ -0,0 +1,84 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"true_accord/shared/money"
+	"true_accord/shared/trueaccordapi"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateSuccessEvenInstallments(t *testing.T) {
+	testPaymentPlan := trueaccordapi.PaymentPlan{AmountToPay: money.MustParse("102.5"), InstallmentFrequency: Weekly, InstallmentAmount: money.MustParse("51.25"), StartDate: "2020-09-28"}
+
+	installments, err := Generate(&testPaymentPlan)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []Installment{
+		{1, date(t, "2020-09-28"), money.MustParse("51.25"), money.MustParse("51.25")},
+		{2, date(t, "2020-10-05"), money.MustParse("51.25"), money.MustParse("102.50")},
+	}, installments)
+}
+
+func TestGenerateSuccessShortenedFinalInstallment(t *testing.T) {
+	testPaymentPlan := trueaccordapi.PaymentPlan{AmountToPay: money.MustParse("110"), InstallmentFrequency: BiWeekly, InstallmentAmount: money.MustParse("25"), StartDate: "2020-09-28"}
+
+	installments, err := Generate(&testPaymentPlan)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 5, len(installments))
+
+	final := installments[len(installments)-1]
+	assert.Equal(t, 5, final.Number)
+	assert.Equal(t, date(t, "2020-11-23"), final.DueDate)
+	assert.Equal(t, money.MustParse("10"), final.AmountDue)
+	assert.Equal(t, testPaymentPlan.AmountToPay, final.CumulativeAmountDue)
+}
+
+func TestGenerateSuccessSubCentInstallmentAmount(t *testing.T) {
+	// From db.json: 1230.085 is held as 1230.09, so the fourth installment makes up the remainder
+	testPaymentPlan := trueaccordapi.PaymentPlan{AmountToPay: money.MustParse("4312.67"), InstallmentFrequency: Weekly, InstallmentAmount: money.MustParse("1230.085"), StartDate: "2020-10-28"}
+
+	installments, err := Generate(&testPaymentPlan)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(installments))
+	assert.Equal(t, money.MustParse("622.40"), installments[3].AmountDue)
+	assert.Equal(t, money.MustParse("4312.67"), installments[3].CumulativeAmountDue)
+}
+
+func TestGenerateInSuccessDueAtMidnightInLocation(t *testing.T) {
+	losAngeles, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testPaymentPlan := trueaccordapi.PaymentPlan{AmountToPay: money.MustParse("50"), InstallmentFrequency: Weekly, InstallmentAmount: money.MustParse("25"), StartDate: "2020-10-28"}
+
+	installments, err := GenerateIn(&testPaymentPlan, losAngeles)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "2020-10-28T00:00:00-07:00", installments[0].DueDate.Format(time.RFC3339))
+	assert.Equal(t, "2020-11-04T00:00:00-08:00", installments[1].DueDate.Format(time.RFC3339), "Due dates stay at midnight across daylight saving time")
+}
+
+func TestGenerateFailureInvalidPaymentPlan(t *testing.T) {
+	_, err := Generate(nil)
+	assert.Equal(t, ErrNoPaymentPlan, err)
+
+	_, err = Generate(&trueaccordapi.PaymentPlan{AmountToPay: money.Zero, InstallmentFrequency: Weekly, InstallmentAmount: money.MustParse("10"), StartDate: "2020-10-28"})
+	assert.Equal(t, ErrNoAmountToPay, err)
+
+	_, err = Generate(&trueaccordapi.PaymentPlan{AmountToPay: money.MustParse("10"), InstallmentFrequency: Weekly, InstallmentAmount: money.Zero, StartDate: "2020-10-28"})
+	assert.Equal(t, ErrNoInstallmentAmount, err)
+
+	_, err = Generate(&trueaccordapi.PaymentPlan{AmountToPay: money.MustParse("10"), InstallmentFrequency: "YEARLY", InstallmentAmount: money.MustParse("10"), StartDate: "2020-10-28"})
+	assert.Equal(t, ErrUnhandledFrequency, err)
+
+	_, err = Generate(&trueaccordapi.PaymentPlan{AmountToPay: money.MustParse("10"), InstallmentFrequency: Weekly, InstallmentAmount: money.MustParse("10"), StartDate: "10/28/2020"})
+	assert.NotNil(t, err)
+
+	_, err = Generate(&trueaccordapi.PaymentPlan{AmountToPay: money.MustParse("10000"), InstallmentFrequency: Daily, InstallmentAmount: money.MustParse("0.01"), StartDate: "2020-10-28"})
+	assert.Equal(t, ErrTooManyInstallments, err)
+}
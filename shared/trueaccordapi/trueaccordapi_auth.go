@@ -0,0 +1,371 @@
+package trueaccordapi
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"true_accord/shared/httphelpers"
+)
+
+// Authenticator ... adds credentials to requests sent to the TrueAccord API
+type Authenticator interface {
+	// Authenticate adds credentials to an outgoing request with the given body
+	Authenticate(req *http.Request, body []byte) error
+	// Refresh replaces the credentials after the API rejected the request they authenticated with a 401. It
+	// returns false when the credentials can't be refreshed, in which case the 401 is returned to the caller.
+	Refresh(ctx context.Context, rejected *http.Request) (refreshed bool, err error)
+	// Secrets returns the credential values that must never be logged
+	Secrets() []string
+}
+
+// WithAuthenticator ... authenticates every request with authenticator and refreshes its credentials once per
+// request on a 401. The authenticator's secrets are redacted from APIError logging.
+func WithAuthenticator(authenticator Authenticator) Option {
+	return func(ta *trueAccordAPIConnector) {
+		ta.authenticator = authenticator
+		httphelpers.RegisterSecrets(authenticator.Secrets()...)
+	}
+}
+
+// TokenSource ... returns bearer tokens for the TrueAccord API
+type TokenSource interface {
+	Token(ctx context.Context) (token string, err error)
+}
+
+// staticToken ... is a token that never changes
+type staticToken string
+
+// Token ... returns the static token
+func (t staticToken) Token(ctx context.Context) (string, error) {
+	return string(t), nil
+}
+
+// tokenFile ... reads the token from a file that is rotated outside of this process
+type tokenFile string
+
+// Token ... returns the current contents of the token file
+func (path tokenFile) Token(ctx context.Context) (string, error) {
+	b, err := ioutil.ReadFile(string(path))
+	if err != nil {
+		return "", err
+	}
+
+	token := strings.TrimSpace(string(b))
+	if token == "" {
+		return "", errors.New("Token file " + string(path) + " is empty")
+	}
+	return token, nil
+}
+
+// clientCredentials ... requests tokens from an OAuth2 token endpoint with the client credentials grant
+type clientCredentials struct {
+	tokenURL     string
+	clientID     string
+	clientSecret string
+	client       *http.Client
+}
+
+// Token ... requests a new access token from the token endpoint
+func (c clientCredentials) Token(ctx context.Context) (string, error) {
+	form := url.Values{"grant_type": []string{"client_credentials"}}
+
+	req, err := http.NewRequest("POST", c.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(c.clientID, c.clientSecret)
+
+	resp, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	// The response body is left out of the error because it may echo credentials
+	if resp.StatusCode != 200 {
+		return "", fmt.Errorf("Token request failed with status %d", resp.StatusCode)
+	}
+
+	var tokenResponse struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err = json.Unmarshal(b, &tokenResponse); err != nil || tokenResponse.AccessToken == "" {
+		return "", errors.New("Token response has no access_token")
+	}
+
+	return tokenResponse.AccessToken, nil
+}
+
+// BearerAuthenticator ... sends "Authorization: Bearer <token>" and fetches a new token from its source on 401
+type BearerAuthenticator struct {
+	mu        sync.RWMutex
+	source    TokenSource
+	token     string
+	refresh   bool
+	extraKeys []string
+
+	// refreshMu lets one refresh fetch a token at a time, so requests rejected together share the token fetched
+	// by the first of them
+	refreshMu sync.Mutex
+}
+
+// NewBearerAuthenticator ... returns a bearer authenticator using a fixed token
+func NewBearerAuthenticator(token string) *BearerAuthenticator {
+	return &BearerAuthenticator{source: staticToken(token), token: token}
+}
+
+// NewTokenFileAuthenticator ... returns a bearer authenticator that reads its token from path, and re-reads it on 401
+func NewTokenFileAuthenticator(path string) *BearerAuthenticator {
+	return &BearerAuthenticator{source: tokenFile(path), refresh: true}
+}
+
+// NewClientCredentialsAuthenticator ... returns a bearer authenticator that requests tokens from an OAuth2
+// token endpoint with the client credentials grant, and requests a new one on 401
+func NewClientCredentialsAuthenticator(tokenURL, clientID, clientSecret string) *BearerAuthenticator {
+	source := clientCredentials{tokenURL, clientID, clientSecret, &http.Client{Timeout: DefaultTimeout}}
+	return &BearerAuthenticator{source: source, refresh: true, extraKeys: []string{clientSecret}}
+}
+
+// Authenticate ... adds the bearer token, fetching the first one if needed
+func (a *BearerAuthenticator) Authenticate(req *http.Request, body []byte) error {
+	a.mu.RLock()
+	token := a.token
+	a.mu.RUnlock()
+
+	if token == "" {
+		if _, err := a.Refresh(req.Context(), nil); err != nil {
+			return err
+		}
+
+		a.mu.RLock()
+		token = a.token
+		a.mu.RUnlock()
+	}
+
+	req.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+
+// Refresh ... fetches a new token from the token source, or fetches the first one when rejected is nil. A request
+// rejected with a token that has since been replaced is retried with the current token without fetching another,
+// so requests rejected together share one refresh. It returns false when the source gives back the token that was
+// rejected, as retrying can't succeed.
+func (a *BearerAuthenticator) Refresh(ctx context.Context, rejected *http.Request) (bool, error) {
+	a.mu.RLock()
+	hasToken := a.token != ""
+	a.mu.RUnlock()
+
+	if !a.refresh && hasToken {
+		return false, nil
+	}
+
+	var rejectedToken string
+	if rejected != nil {
+		rejectedToken = strings.TrimPrefix(rejected.Header.Get("Authorization"), "Bearer ")
+	}
+
+	a.refreshMu.Lock()
+	defer a.refreshMu.Unlock()
+
+	a.mu.RLock()
+	current := a.token
+	a.mu.RUnlock()
+
+	if current != rejectedToken {
+		return true, nil
+	}
+
+	token, err := a.source.Token(ctx)
+	if err != nil {
+		return false, err
+	}
+	if token == current {
+		return false, nil
+	}
+
+	a.mu.Lock()
+	a.token = token
+	a.mu.Unlock()
+
+	httphelpers.RegisterSecrets(token)
+	return true, nil
+}
+
+// Secrets ... returns the current token and any client secret
+func (a *BearerAuthenticator) Secrets() []string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	return append([]string{a.token}, a.extraKeys...)
+}
+
+// BasicAuthenticator ... sends HTTP basic auth credentials
+type BasicAuthenticator struct {
+	Username string
+	Password string
+}
+
+// Authenticate ... adds the basic auth header
+func (a *BasicAuthenticator) Authenticate(req *http.Request, body []byte) error {
+	req.SetBasicAuth(a.Username, a.Password)
+	return nil
+}
+
+// Refresh ... is a no-op; basic auth credentials can't be refreshed
+func (a *BasicAuthenticator) Refresh(ctx context.Context, rejected *http.Request) (bool, error) {
+	return false, nil
+}
+
+// Secrets ... returns the password and the encoded credentials sent in the Authorization header
+func (a *BasicAuthenticator) Secrets() []string {
+	return []string{a.Password, base64.StdEncoding.EncodeToString([]byte(a.Username + ":" + a.Password))}
+}
+
+// HMACAuthenticator ... signs requests with HMAC-SHA256 over the method, path and query, timestamp and body hash:
+//
+//	Authorization: HMAC-SHA256 keyId=<KeyID>,timestamp=<unix seconds>,signature=<hex signature>
+type HMACAuthenticator struct {
+	KeyID  string
+	Secret string
+
+	// now is replaced in tests
+	now func() time.Time
+}
+
+// NewHMACAuthenticator ... returns an authenticator signing requests with the given key
+func NewHMACAuthenticator(keyID, secret string) *HMACAuthenticator {
+	return &HMACAuthenticator{KeyID: keyID, Secret: secret, now: time.Now}
+}
+
+// Authenticate ... signs the request
+func (a *HMACAuthenticator) Authenticate(req *http.Request, body []byte) error {
+	timestamp := strconv.FormatInt(a.now().Unix(), 10)
+
+	req.Header.Set("Authorization", fmt.Sprintf("HMAC-SHA256 keyId=%s,timestamp=%s,signature=%s",
+		a.KeyID, timestamp, a.signature(req.Method, req.URL.RequestURI(), timestamp, body)))
+	return nil
+}
+
+// signature ... returns the hex HMAC-SHA256 of the canonical request
+func (a *HMACAuthenticator) signature(method, requestURI, timestamp string, body []byte) string {
+	bodyHash := sha256.Sum256(body)
+	canonical := strings.Join([]string{method, requestURI, timestamp, hex.EncodeToString(bodyHash[:])}, "\n")
+
+	mac := hmac.New(sha256.New, []byte(a.Secret))
+	mac.Write([]byte(canonical))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Refresh ... is a no-op; signing keys can't be refreshed
+func (a *HMACAuthenticator) Refresh(ctx context.Context, rejected *http.Request) (bool, error) {
+	return false, nil
+}
+
+// Secrets ... returns the signing secret
+func (a *HMACAuthenticator) Secrets() []string {
+	return []string{a.Secret}
+}
+
+// Credentials ... configures an Authenticator. The config package fills them from its settings, and any left
+// empty from the JSON file named by credentials_file.
+type Credentials struct {
+	// Type is one of bearer, basic or hmac
+	Type string `json:"type"`
+
+	// bearer: a fixed token, a token file re-read on 401, or an OAuth2 client credentials token endpoint
+	Token        string `json:"token"`
+	TokenFile    string `json:"token_file"`
+	TokenURL     string `json:"token_url"`
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+
+	// basic
+	Username string `json:"username"`
+	Password string `json:"password"`
+
+	// hmac
+	KeyID  string `json:"key_id"`
+	Secret string `json:"hmac_secret"`
+}
+
+// LoadFile ... sets the credentials that are still empty from the JSON file at path
+func (c *Credentials) LoadFile(path string) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var file Credentials
+	if err = json.Unmarshal(b, &file); err != nil {
+		return errors.New("Failed to parse credentials file " + path)
+	}
+
+	for field, value := range map[*string]string{
+		&c.Type:         file.Type,
+		&c.Token:        file.Token,
+		&c.TokenFile:    file.TokenFile,
+		&c.TokenURL:     file.TokenURL,
+		&c.ClientID:     file.ClientID,
+		&c.ClientSecret: file.ClientSecret,
+		&c.Username:     file.Username,
+		&c.Password:     file.Password,
+		&c.KeyID:        file.KeyID,
+		&c.Secret:       file.Secret,
+	} {
+		if *field == "" {
+			*field = value
+		}
+	}
+
+	return nil
+}
+
+// Authenticator ... returns the authenticator described by the credentials, or nil if Type is empty
+func (c Credentials) Authenticator() (Authenticator, error) {
+	switch strings.ToLower(c.Type) {
+	case "":
+		return nil, nil
+	case "bearer":
+		if c.Token != "" {
+			return NewBearerAuthenticator(c.Token), nil
+		}
+		if c.TokenFile != "" {
+			return NewTokenFileAuthenticator(c.TokenFile), nil
+		}
+		if c.TokenURL != "" && c.ClientID != "" && c.ClientSecret != "" {
+			return NewClientCredentialsAuthenticator(c.TokenURL, c.ClientID, c.ClientSecret), nil
+		}
+		return nil, errors.New("bearer credentials need a token, a token file or a token URL with client ID and secret")
+	case "basic":
+		if c.Username == "" || c.Password == "" {
+			return nil, errors.New("basic credentials need a username and password")
+		}
+		return &BasicAuthenticator{c.Username, c.Password}, nil
+	case "hmac":
+		if c.KeyID == "" || c.Secret == "" {
+			return nil, errors.New("hmac credentials need a key ID and secret")
+		}
+		return NewHMACAuthenticator(c.KeyID, c.Secret), nil
+	}
+
+	return nil, errors.New("Unknown credentials type " + strconv.Quote(c.Type))
+}
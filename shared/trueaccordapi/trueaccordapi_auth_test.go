@@ -0,0 +1,339 @@
+package trueaccordapi
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+)
+
+// authorizedResponder ... answers 200 when the Authorization header matches, and 401 echoing the header otherwise
+func authorizedResponder(authorization string, seen *[]string) httpmock.Responder {
+	return func(req *http.Request) (*http.Response, error) {
+		*seen = append(*seen, req.Header.Get("Authorization"))
+		if req.Header.Get("Authorization") != authorization {
+			return httpmock.NewStringResponse(401, "invalid credentials "+req.Header.Get("Authorization")), nil
+		}
+		return httpmock.NewStringResponse(200, `[]`), nil
+	}
+}
+
+func writeTempFile(t *testing.T, dir, name, contents string) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(contents), 0600); err != nil {
+		t.Fatalf("Failed to write %s", path)
+	}
+	return path
+}
+
+func TestGetDebtsSuccessBearerToken(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	var seen []string
+	httpmock.RegisterResponder("GET", fmt.Sprintf("%s/%s", testAPIURL, getDebts), authorizedResponder("Bearer abc123", &seen))
+
+	connector := NewTrueAccordAPIConnector(WithBaseURL(testAPIURL), WithAuthenticator(NewBearerAuthenticator("abc123")))
+
+	_, err := connector.GetDebts(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"Bearer abc123"}, seen)
+}
+
+func TestGetDebtsSuccessRefreshesTokenOn401(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	dir, _ := ioutil.TempDir("", "trueaccordapi")
+	defer os.RemoveAll(dir)
+	tokenPath := writeTempFile(t, dir, "token", "expired-token\n")
+
+	var seen []string
+	httpmock.RegisterResponder("GET", fmt.Sprintf("%s/%s", testAPIURL, getDebts), authorizedResponder("Bearer fresh-token", &seen))
+
+	connector := NewTrueAccordAPIConnector(WithBaseURL(testAPIURL), WithRetryPolicy(RetryPolicy{MaxAttempts: 1}), WithAuthenticator(NewTokenFileAuthenticator(tokenPath)))
+
+	// The token is rotated after the first request is sent
+	_, err := connector.GetDebts(context.Background())
+	assert.NotNil(t, err)
+
+	writeTempFile(t, dir, "token", "fresh-token")
+
+	seen = nil
+	_, err = connector.GetDebts(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"Bearer expired-token", "Bearer fresh-token"}, seen)
+}
+
+func TestGetDebtsSuccessClientCredentials(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	tokens := 0
+	httpmock.RegisterResponder("POST", "http://auth.local/token", func(req *http.Request) (*http.Response, error) {
+		clientID, clientSecret, _ := req.BasicAuth()
+		if clientID != "client" || clientSecret != "client-secret" {
+			return httpmock.NewStringResponse(401, ""), nil
+		}
+		tokens++
+		return httpmock.NewStringResponse(200, fmt.Sprintf(`{"access_token": "token-%d"}`, tokens)), nil
+	})
+
+	var seen []string
+	httpmock.RegisterResponder("GET", fmt.Sprintf("%s/%s", testAPIURL, getDebts), authorizedResponder("Bearer token-1", &seen))
+
+	authenticator := NewClientCredentialsAuthenticator("http://auth.local/token", "client", "client-secret")
+	connector := NewTrueAccordAPIConnector(WithBaseURL(testAPIURL), WithAuthenticator(authenticator))
+
+	_, err := connector.GetDebts(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 1, tokens, "The token is fetched on first use")
+	assert.Contains(t, authenticator.Secrets(), "client-secret")
+	assert.Contains(t, authenticator.Secrets(), "token-1")
+}
+
+func TestGetDebtsFailureStaticTokenRejected(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	var seen []string
+	httpmock.RegisterResponder("GET", fmt.Sprintf("%s/%s", testAPIURL, getDebts), authorizedResponder("Bearer other", &seen))
+
+	connector := NewTrueAccordAPIConnector(WithBaseURL(testAPIURL), WithAuthenticator(NewBearerAuthenticator("leaked-static-token")))
+
+	_, err := connector.GetDebts(context.Background())
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, len(seen), "A static token can't be refreshed, so the 401 is not retried")
+	assert.NotContains(t, err.String(), "leaked-static-token", "Secrets echoed by the API must be redacted")
+}
+
+func TestGetDebtsFailureUnchangedTokenFileNotRetried(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	dir, _ := ioutil.TempDir("", "trueaccordapi")
+	defer os.RemoveAll(dir)
+	tokenPath := writeTempFile(t, dir, "token", "expired-token\n")
+
+	var seen []string
+	httpmock.RegisterResponder("GET", fmt.Sprintf("%s/%s", testAPIURL, getDebts), authorizedResponder("Bearer fresh-token", &seen))
+
+	connector := NewTrueAccordAPIConnector(WithBaseURL(testAPIURL), WithAuthenticator(NewTokenFileAuthenticator(tokenPath)))
+
+	_, err := connector.GetDebts(context.Background())
+	assert.NotNil(t, err)
+	assert.Equal(t, []string{"Bearer expired-token"}, seen, "Re-reading the same token can't succeed, so the 401 is not retried")
+}
+
+func TestGetDebtsFailureRefreshIsNotAnAttempt(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	tokens := 0
+	httpmock.RegisterResponder("POST", "http://auth.local/token", func(req *http.Request) (*http.Response, error) {
+		tokens++
+		return httpmock.NewStringResponse(200, fmt.Sprintf(`{"access_token": "token-%d"}`, tokens)), nil
+	})
+	debtsURL := fmt.Sprintf("%s/%s", testAPIURL, getDebts)
+	httpmock.RegisterResponder("GET", debtsURL, sequenceResponder(
+		httpmock.NewStringResponder(401, ""),
+		httpmock.NewStringResponder(503, "unavailable"),
+	))
+
+	authenticator := NewClientCredentialsAuthenticator("http://auth.local/token", "client", "client-secret")
+	connector := NewTrueAccordAPIConnector(WithBaseURL(testAPIURL), WithRetryPolicy(RetryPolicy{MaxAttempts: 2}), WithAuthenticator(authenticator), func(ta *trueAccordAPIConnector) {
+		ta.sleep = func(context.Context, time.Duration) error {
+			return nil
+		}
+	})
+
+	_, err := connector.GetDebts(context.Background())
+	assert.NotNil(t, err)
+	assert.Equal(t, 2, err.Attempts, "The request resent with a new token isn't a retry attempt")
+	assert.Equal(t, 3, httpmock.GetCallCountInfo()["GET "+debtsURL])
+	assert.Equal(t, 2, tokens)
+}
+
+// countingTokenSource ... returns token-1, token-2 and so on, counting the tokens fetched
+type countingTokenSource struct {
+	mu      sync.Mutex
+	fetched int
+}
+
+// Token ... returns the next token
+func (s *countingTokenSource) Token(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.fetched++
+	return fmt.Sprintf("token-%d", s.fetched), nil
+}
+
+// signedRequest ... returns a request authenticated by authenticator
+func signedRequest(t *testing.T, authenticator Authenticator) *http.Request {
+	req, _ := http.NewRequest("GET", testAPIURL, nil)
+	if err := authenticator.Authenticate(req, nil); err != nil {
+		t.Fatal(err)
+	}
+	return req
+}
+
+func TestBearerAuthenticatorSuccessConcurrentRefreshes(t *testing.T) {
+	source := &countingTokenSource{}
+	authenticator := &BearerAuthenticator{source: source, token: "token-0", refresh: true}
+
+	// Every request was signed with token-0 before any of them was rejected
+	rejected := make([]*http.Request, 10)
+	for i := range rejected {
+		rejected[i] = signedRequest(t, authenticator)
+	}
+
+	var wg sync.WaitGroup
+	results := make(chan bool, len(rejected))
+	for _, req := range rejected {
+		wg.Add(1)
+		go func(req *http.Request) {
+			defer wg.Done()
+			refreshed, err := authenticator.Refresh(context.Background(), req)
+			assert.Nil(t, err)
+			results <- refreshed
+		}(req)
+	}
+	wg.Wait()
+	close(results)
+
+	for refreshed := range results {
+		assert.True(t, refreshed)
+	}
+	assert.Equal(t, 1, source.fetched, "The requests share the first refreshed token")
+	assert.Contains(t, authenticator.Secrets(), "token-1")
+}
+
+func TestBearerAuthenticatorSuccessRejectedAfterAnotherRefresh(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "trueaccordapi")
+	defer os.RemoveAll(dir)
+	tokenPath := writeTempFile(t, dir, "token", "token-0")
+
+	authenticator := NewTokenFileAuthenticator(tokenPath)
+	first := signedRequest(t, authenticator)
+	second := signedRequest(t, authenticator)
+
+	// The second request's 401 refreshes the token before the first request's 401 arrives
+	writeTempFile(t, dir, "token", "token-1")
+	refreshed, err := authenticator.Refresh(context.Background(), second)
+	assert.Nil(t, err)
+	assert.True(t, refreshed)
+
+	refreshed, err = authenticator.Refresh(context.Background(), first)
+	assert.Nil(t, err)
+	assert.True(t, refreshed, "The first request is retried with the token the second one fetched")
+	assert.Equal(t, "Bearer token-1", signedRequest(t, authenticator).Header.Get("Authorization"))
+
+	source := &countingTokenSource{}
+	authenticator = &BearerAuthenticator{source: source, token: "token-0", refresh: true}
+	first = signedRequest(t, authenticator)
+
+	_, err = authenticator.Refresh(context.Background(), signedRequest(t, authenticator))
+	assert.Nil(t, err)
+	refreshed, err = authenticator.Refresh(context.Background(), first)
+	assert.Nil(t, err)
+	assert.True(t, refreshed)
+	assert.Equal(t, 1, source.fetched, "A token already replaced isn't refreshed again")
+}
+
+func TestGetDebtsSuccessBasicAuth(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	var seen []string
+	httpmock.RegisterResponder("GET", fmt.Sprintf("%s/%s", testAPIURL, getDebts), authorizedResponder("Basic dXNlcjpwYXNz", &seen))
+
+	connector := NewTrueAccordAPIConnector(WithBaseURL(testAPIURL), WithAuthenticator(&BasicAuthenticator{Username: "user", Password: "pass"}))
+
+	_, err := connector.GetDebts(context.Background())
+	assert.Nil(t, err)
+}
+
+func TestGetDebtsFailureBasicAuthRedacted(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	var seen []string
+	httpmock.RegisterResponder("GET", fmt.Sprintf("%s/%s", testAPIURL, getDebts), authorizedResponder("Basic other", &seen))
+
+	connector := NewTrueAccordAPIConnector(WithBaseURL(testAPIURL), WithAuthenticator(&BasicAuthenticator{Username: "basic-user", Password: "basic-pass"}))
+
+	_, err := connector.GetDebts(context.Background())
+	assert.NotNil(t, err)
+	assert.Contains(t, seen[0], "YmFzaWMtdXNlcjpiYXNpYy1wYXNz")
+	assert.NotContains(t, err.String(), "YmFzaWMtdXNlcjpiYXNpYy1wYXNz", "The encoded credentials echoed by the API must be redacted")
+}
+
+func TestHMACAuthenticatorSuccess(t *testing.T) {
+	authenticator := NewHMACAuthenticator("key-1", "hmac-secret")
+	authenticator.now = func() time.Time {
+		return time.Unix(1604000000, 0)
+	}
+
+	req, _ := http.NewRequest("GET", "http://localhost/payments?payment_plan_id=1", nil)
+	err := authenticator.Authenticate(req, nil)
+
+	assert.Nil(t, err)
+	assert.Equal(t,
+		"HMAC-SHA256 keyId=key-1,timestamp=1604000000,signature="+authenticator.signature("GET", "/payments?payment_plan_id=1", "1604000000", nil),
+		req.Header.Get("Authorization"))
+	assert.NotEqual(t,
+		authenticator.signature("GET", "/payments?payment_plan_id=1", "1604000000", nil),
+		authenticator.signature("GET", "/payments?payment_plan_id=2", "1604000000", nil))
+	assert.Equal(t, 64, len(authenticator.signature("GET", "/debts", "1604000000", []byte("{}"))))
+}
+
+func TestCredentialsLoadFileSuccess(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "trueaccordapi")
+	defer os.RemoveAll(dir)
+	credentialsPath := writeTempFile(t, dir, "credentials.json", `{"type": "basic", "username": "user", "password": "from-file"}`)
+
+	credentials := Credentials{Password: "from-config"}
+	err := credentials.LoadFile(credentialsPath)
+	assert.Nil(t, err)
+
+	authenticator, err := credentials.Authenticator()
+	assert.Nil(t, err)
+	assert.Equal(t, &BasicAuthenticator{Username: "user", Password: "from-config"}, authenticator)
+}
+
+func TestCredentialsLoadFileFailure(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "trueaccordapi")
+	defer os.RemoveAll(dir)
+	credentialsPath := writeTempFile(t, dir, "credentials.json", `type: basic`)
+
+	var credentials Credentials
+	assert.NotNil(t, credentials.LoadFile(credentialsPath))
+	assert.NotNil(t, credentials.LoadFile(dir+"/missing.json"))
+}
+
+func TestCredentialsAuthenticatorSuccessNotConfigured(t *testing.T) {
+	authenticator, err := Credentials{}.Authenticator()
+	assert.Nil(t, err)
+	assert.Nil(t, authenticator)
+}
+
+func TestCredentialsAuthenticatorFailureIncomplete(t *testing.T) {
+	for _, credentials := range []Credentials{
+		{Type: "bearer"},
+		{Type: "basic", Username: "user"},
+		{Type: "hmac", KeyID: "key-1"},
+		{Type: "kerberos"},
+	} {
+		_, err := credentials.Authenticator()
+		assert.NotNil(t, err, credentials.Type)
+	}
+}
@@ -2,30 +2,57 @@ package trueaccordapi
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"math/rand"
 	"net/http"
 	"net/url"
-	"os"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 
 	"true_accord/shared/httphelpers"
+	"true_accord/shared/money"
+	"true_accord/shared/ratelimit"
 
 	log "github.com/sirupsen/logrus"
 )
 
+// dateLayout ... is the format of start_date and payment dates (schedule.DateLayout, which imports this package)
+const dateLayout = "2006-01-02"
+
 // TrueAccordAPIConnector ... is an interface of appapi methods called
 type TrueAccordAPIConnector interface {
-	GetDebts() (debts []Debt, err *httphelpers.APIError)
-	GetPaymentPlan(debtID int64) (paymentPlan *PaymentPlan, err *httphelpers.APIError)
-	GetPayments(paymentPlanID int64) (payments []Payment, err *httphelpers.APIError)
+	GetDebts(ctx context.Context) (debts []Debt, err *httphelpers.APIError)
+	GetDebtByID(ctx context.Context, debtID int64) (debt *Debt, err *httphelpers.APIError)
+	StreamDebts(ctx context.Context, handlePage func(debts []Debt) error) (err *httphelpers.APIError)
+	GetPaymentPlans(ctx context.Context, debtID int64) (paymentPlans []PaymentPlan, err *httphelpers.APIError)
+	GetPaymentPlanByID(ctx context.Context, paymentPlanID int64) (paymentPlan *PaymentPlan, err *httphelpers.APIError)
+	GetPayments(ctx context.Context, paymentPlanID int64) (payments []Payment, err *httphelpers.APIError)
+	GetAllPaymentPlans(ctx context.Context) (paymentPlans []PaymentPlan, err *httphelpers.APIError)
+	GetAllPayments(ctx context.Context) (payments []Payment, err *httphelpers.APIError)
 }
 
-type trueAccordAPIConnector struct{}
+type trueAccordAPIConnector struct {
+	baseURL     string
+	client      *http.Client
+	pageSize    int
+	retryPolicy RetryPolicy
+	rateLimits  map[string]*ratelimit.Limiter
+
+	authenticator Authenticator
+
+	// sleep and random are replaced in tests to make backoff deterministic
+	sleep  func(ctx context.Context, d time.Duration) error
+	random func(n int64) int64
+}
 
-var trueAccordAPIURL = os.Getenv("TRUEACCORD_API_URL")
+// DefaultTimeout ... is the per-attempt timeout of connectors created without WithHTTPClient or WithTimeout
+const DefaultTimeout = 30 * time.Second
 
 const (
 	getDebts        = "debts"
@@ -35,169 +62,496 @@ const (
 
 // Debt ... is the debt response model returned from TrueAccord API
 type Debt struct {
-	ID     int64   `json:"id"`
-	Amount float64 `json:"amount"`
+	ID     int64       `json:"id"`
+	Amount money.Money `json:"amount"`
+	// TimeZone is the IANA time zone of the debt's dates, or empty for the configured default
+	TimeZone string `json:"time_zone,omitempty"`
+
+	// Optional simple interest terms: APR is the annual rate as a fraction (0.18 for 18%), accruing from
+	// AccrualStartDate (YYYY-MM-DD) under the DayCount convention (ACT/365 if empty). Zero APR accrues nothing.
+	APR              float64 `json:"apr,omitempty"`
+	AccrualStartDate string  `json:"accrual_start_date,omitempty"`
+	DayCount         string  `json:"day_count,omitempty"`
 }
 
 // PaymentPlan ... is the payment plan response model returned from TrueAccord API
 type PaymentPlan struct {
-	ID                   int64   `json:"id"`
-	DebtID               int64   `json:"debt_id"`
-	AmountToPay          float64 `json:"amount_to_pay"`
-	InstallmentFrequency string  `json:"installment_frequency"`
-	InstallmentAmount    float64 `json:"installment_amount"`
-	StartDate            string  `json:"start_date"`
+	ID                   int64       `json:"id"`
+	DebtID               int64       `json:"debt_id"`
+	AmountToPay          money.Money `json:"amount_to_pay"`
+	InstallmentFrequency string      `json:"installment_frequency"`
+	InstallmentAmount    money.Money `json:"installment_amount"`
+	StartDate            string      `json:"start_date"`
+	// TimeZone is the IANA time zone of the plan's dates, or empty for its debt's time zone
+	TimeZone string `json:"time_zone,omitempty"`
 }
 
 // Payment ... is the customer payment response model returned from TrueAccord API
 type Payment struct {
-	Amount        float64 `json:"amount"`
-	Date          string  `json:"date"`
-	PaymentPlanID int64   `json:"payment_plan_id"`
+	Amount        money.Money `json:"amount"`
+	Date          string      `json:"date"`
+	PaymentPlanID int64       `json:"payment_plan_id"`
+}
+
+// Option ... configures a TrueAccordAPIConnector
+type Option func(ta *trueAccordAPIConnector)
+
+// WithBaseURL ... sends requests to the TrueAccord API at baseURL, e.g. http://my-json-server.typicode.com/pink-cupcakes/TrueAccord
+func WithBaseURL(baseURL string) Option {
+	return func(ta *trueAccordAPIConnector) {
+		ta.baseURL = strings.TrimRight(baseURL, "/")
+	}
+}
+
+// WithPageSize ... makes list requests page through results pageSize items at a time with _page/_limit.
+// Link headers (rel="next") are followed when the API sends them, which also covers cursor pagination.
+// A page size of 0 (the default) requests each list in one response.
+func WithPageSize(pageSize int) Option {
+	return func(ta *trueAccordAPIConnector) {
+		ta.pageSize = pageSize
+	}
+}
+
+// WithHTTPClient ... makes the connector send every request through client, which is shared across goroutines
+func WithHTTPClient(client *http.Client) Option {
+	return func(ta *trueAccordAPIConnector) {
+		ta.client = client
+	}
+}
+
+// WithTimeout ... limits how long each request attempt (including reading the response body) may take
+func WithTimeout(timeout time.Duration) Option {
+	return func(ta *trueAccordAPIConnector) {
+		client := *ta.client
+		client.Timeout = timeout
+		ta.client = &client
+	}
+}
+
+// NewHTTPClient ... returns an HTTP client with a pooled transport keeping up to maxIdleConnsPerHost idle
+// connections to the API, for connectors used by that many goroutines at once
+func NewHTTPClient(maxIdleConnsPerHost int, timeout time.Duration) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = maxIdleConnsPerHost
+	transport.MaxIdleConnsPerHost = maxIdleConnsPerHost
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   timeout,
+	}
 }
 
 // NewTrueAccordAPIConnector ... returns an interface of TrueAccordAPIConnector
-func NewTrueAccordAPIConnector() TrueAccordAPIConnector {
-	return &trueAccordAPIConnector{}
+func NewTrueAccordAPIConnector(options ...Option) TrueAccordAPIConnector {
+	ta := &trueAccordAPIConnector{
+		client:      &http.Client{Timeout: DefaultTimeout},
+		retryPolicy: DefaultRetryPolicy,
+		sleep:       sleepContext,
+		random:      rand.Int63n,
+	}
+	for _, option := range options {
+		option(ta)
+	}
+
+	return ta
 }
 
 // GetDebts ... returns all the debts from TrueAccord API
-func (ta *trueAccordAPIConnector) GetDebts() (debts []Debt, err *httphelpers.APIError) {
-	resp, requestErr := ta.makeRequest(getDebts, "GET", nil, nil)
+func (ta *trueAccordAPIConnector) GetDebts(ctx context.Context) (debts []Debt, err *httphelpers.APIError) {
+	debts = []Debt{}
+	err = ta.StreamDebts(ctx, func(page []Debt) error {
+		debts = append(debts, page...)
+		return nil
+	})
 	if err != nil {
-		return
+		return nil, err
 	}
 
-	defer resp.Body.Close()
+	return
+}
 
-	b, requestErr := ioutil.ReadAll(resp.Body)
-	if requestErr != nil {
-		clientErr := "Failed to GET debts"
-		err = httphelpers.NewAPIError(requestErr, clientErr).SetInternalErrorMessage("Failed to read response body from GET debts")
-		return
+// GetDebtByID ... returns the debt with the given ID from TrueAccord API, or nil if there is none
+func (ta *trueAccordAPIConnector) GetDebtByID(ctx context.Context, debtID int64) (debt *Debt, err *httphelpers.APIError) {
+	params := url.Values{"id": []string{strconv.Itoa(int(debtID))}}
+
+	err = ta.eachPage(ctx, getDebts, params, "debts", func(b []byte) *httphelpers.APIError {
+		var page []Debt
+		if err := unmarshalPage(b, &page, "debts"); err != nil {
+			return err
+		}
+
+		for i := range page {
+			if page[i].ID == debtID && debt == nil {
+				debt = &page[i]
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	if resp.StatusCode != 200 {
-		requestErr = errors.New("Failed to GET debts, non-200 response: " + string(b))
-		clientErr := "Failed to GET debts"
-		err = httphelpers.NewAPIError(requestErr, clientErr)
+	return
+}
+
+// StreamDebts ... passes the debts from TrueAccord API to handlePage one page at a time.
+// Paging stops at the first error returned by handlePage.
+func (ta *trueAccordAPIConnector) StreamDebts(ctx context.Context, handlePage func(debts []Debt) error) (err *httphelpers.APIError) {
+	return ta.eachPage(ctx, getDebts, nil, "debts", func(b []byte) *httphelpers.APIError {
+		var debts []Debt
+		if err := unmarshalPage(b, &debts, "debts"); err != nil {
+			return err
+		}
+
+		if handleErr := handlePage(debts); handleErr != nil {
+			return httphelpers.NewAPIError(handleErr, "Failed to GET debts").SetInternalErrorMessage("Failed to handle page of GET debts result")
+		}
+		return nil
+	})
+}
+
+// GetPaymentPlans ... returns every payment plan of a given debt from TrueAccord API, ordered by start_date
+func (ta *trueAccordAPIConnector) GetPaymentPlans(ctx context.Context, debtID int64) (paymentPlans []PaymentPlan, err *httphelpers.APIError) {
+	params := url.Values{"debt_id": []string{strconv.Itoa(int(debtID))}}
+
+	paymentPlans, err = ta.getPaymentPlans(ctx, params)
+	if err != nil {
 		return
 	}
 
-	requestErr = json.Unmarshal(b, &debts)
-	if requestErr != nil {
-		clientErr := "Failed to GET debts"
-		err = httphelpers.NewAPIError(requestErr, clientErr)
-		err.SetInternalErrorMessage("Failed to unmarshal GET debts result")
-		return
+	SortPaymentPlans(paymentPlans)
+	return paymentPlans, nil
+}
+
+// GetPaymentPlanByID ... returns the payment plan with the given ID from TrueAccord API, or nil if there is none
+func (ta *trueAccordAPIConnector) GetPaymentPlanByID(ctx context.Context, paymentPlanID int64) (paymentPlan *PaymentPlan, err *httphelpers.APIError) {
+	params := url.Values{"id": []string{strconv.Itoa(int(paymentPlanID))}}
+
+	paymentPlans, err := ta.getPaymentPlans(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range paymentPlans {
+		if paymentPlans[i].ID == paymentPlanID {
+			return &paymentPlans[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// GetPayments ... returns the payment activities for a given payment plan from TrueAccord API
+func (ta *trueAccordAPIConnector) GetPayments(ctx context.Context, paymentPlanID int64) (payments []Payment, err *httphelpers.APIError) {
+	params := url.Values{"payment_plan_id": []string{strconv.Itoa(int(paymentPlanID))}}
+	return ta.getPayments(ctx, params)
+}
+
+// GetAllPaymentPlans ... returns the payment plans of every debt from TrueAccord API
+func (ta *trueAccordAPIConnector) GetAllPaymentPlans(ctx context.Context) (paymentPlans []PaymentPlan, err *httphelpers.APIError) {
+	return ta.getPaymentPlans(ctx, nil)
+}
+
+// GetAllPayments ... returns the payment activities of every payment plan from TrueAccord API
+func (ta *trueAccordAPIConnector) GetAllPayments(ctx context.Context) (payments []Payment, err *httphelpers.APIError) {
+	return ta.getPayments(ctx, nil)
+}
+
+func (ta *trueAccordAPIConnector) getPaymentPlans(ctx context.Context, params url.Values) (paymentPlans []PaymentPlan, err *httphelpers.APIError) {
+	paymentPlans = []PaymentPlan{}
+	err = ta.eachPage(ctx, getPaymentPlans, params, "payment plans", func(b []byte) *httphelpers.APIError {
+		var page []PaymentPlan
+		if err := unmarshalPage(b, &page, "payment plans"); err != nil {
+			return err
+		}
+
+		paymentPlans = append(paymentPlans, page...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return
 }
 
-// GetPaymentPlan ... returns a payment plan (of any) for a given debt from TrueAccord API
-func (ta *trueAccordAPIConnector) GetPaymentPlan(debtID int64) (paymentPlan *PaymentPlan, err *httphelpers.APIError) {
-	params := url.Values{"debt_id": []string{strconv.Itoa(int(debtID))}}
-	resp, requestErr := ta.makeRequest(getPaymentPlans, "GET", nil, params)
+func (ta *trueAccordAPIConnector) getPayments(ctx context.Context, params url.Values) (payments []Payment, err *httphelpers.APIError) {
+	payments = []Payment{}
+	err = ta.eachPage(ctx, getPayments, params, "payments", func(b []byte) *httphelpers.APIError {
+		var page []Payment
+		if err := unmarshalPage(b, &page, "payments"); err != nil {
+			return err
+		}
+
+		payments = append(payments, page...)
+		return nil
+	})
 	if err != nil {
-		return
+		return nil, err
 	}
 
-	defer resp.Body.Close()
+	return
+}
 
-	b, requestErr := ioutil.ReadAll(resp.Body)
+// SortPaymentPlans ... orders payment plans by start_date then ID. Plans with a start_date that isn't YYYY-MM-DD go last.
+func SortPaymentPlans(paymentPlans []PaymentPlan) {
+	sort.SliceStable(paymentPlans, func(i, j int) bool {
+		a, aErr := time.Parse(dateLayout, paymentPlans[i].StartDate)
+		b, bErr := time.Parse(dateLayout, paymentPlans[j].StartDate)
+
+		switch {
+		case aErr != nil || bErr != nil:
+			return aErr == nil && bErr != nil
+		case !a.Equal(b):
+			return a.Before(b)
+		}
+		return paymentPlans[i].ID < paymentPlans[j].ID
+	})
+}
+
+// unmarshalPage ... unmarshals a JSON array response body into out
+func unmarshalPage(b []byte, out interface{}, resourceName string) (err *httphelpers.APIError) {
+	requestErr := json.Unmarshal(b, out)
 	if requestErr != nil {
-		clientErr := "Failed to GET payment plans"
-		err = httphelpers.NewAPIError(requestErr, clientErr).SetInternalErrorMessage("Failed to read response body from GET payment plans")
-		return
+		err = httphelpers.NewAPIError(requestErr, "Failed to GET "+resourceName).SetInternalErrorMessage("Failed to unmarshal GET " + resourceName + " result")
 	}
 
-	if resp.StatusCode != 200 {
-		requestErr = errors.New("Failed to GET payment plans, non-200 response: " + string(b))
-		clientErr := "Failed to GET payment plans"
-		err = httphelpers.NewAPIError(requestErr, clientErr)
-		return
+	return
+}
+
+// eachPage ... GETs an endpoint and passes each page of the response body to handlePage. Without a page size
+// the endpoint is requested once; otherwise pages are followed through Link headers, or by incrementing _page
+// while pages come back full when the API sends no Link header. Paging stops at a page identical to the previous
+// one, so a backend that ignores _page or links back to the same page isn't requested forever.
+func (ta *trueAccordAPIConnector) eachPage(ctx context.Context, endpoint string, params url.Values, resourceName string, handlePage func(b []byte) *httphelpers.APIError) (err *httphelpers.APIError) {
+	clientErr := "Failed to GET " + resourceName
+
+	query := url.Values{}
+	for key, values := range params {
+		query[key] = values
+	}
+
+	page := 1
+	if ta.pageSize > 0 {
+		query.Set("_page", strconv.Itoa(page))
+		query.Set("_limit", strconv.Itoa(ta.pageSize))
 	}
 
-	var paymentPlans []PaymentPlan
-	requestErr = json.Unmarshal(b, &paymentPlans)
+	requestURL, requestErr := ta.endpointURL(endpoint, query)
 	if requestErr != nil {
-		clientErr := "Failed to GET payment plans"
-		err = httphelpers.NewAPIError(requestErr, clientErr)
-		err.SetInternalErrorMessage("Failed to unmarshal GET payment plans result")
+		err = httphelpers.NewAPIError(requestErr, clientErr).SetInternalErrorMessage("Failed to build GET " + resourceName + " request URL")
 		return
 	}
 
-	if len(paymentPlans) > 1 {
-		/** TrueAccord API should enforce business logic 1:1 debt to paymentPlan.
-		This just adds monitoring if we come across failures in the business logic.
-
-		This logic is not blocking and will default to the first payment plan.
-		*/
-		log.WithFields(log.Fields{
-			"Message": fmt.Sprintf("More than 1 payment plan found for debtID %d", debtID),
-		}).Info()
-	} else if len(paymentPlans) == 0 {
-		return
+	var previous []byte
+	for requestURL != nil {
+		b, header, err := ta.get(ctx, endpoint, requestURL, resourceName)
+		if err != nil {
+			return err
+		}
+
+		if previous != nil && bytes.Equal(b, previous) {
+			log.WithFields(log.Fields{
+				"Message": fmt.Sprintf("Stopped paging %s, %s returned the previous page again", resourceName, requestURL),
+			}).Warn()
+			return nil
+		}
+		previous = b
+
+		if err = handlePage(b); err != nil {
+			return err
+		}
+
+		if ta.pageSize <= 0 {
+			return nil
+		}
+
+		if link := header.Get("Link"); link != "" {
+			requestURL = nextLink(requestURL, link)
+			continue
+		}
+
+		var items []json.RawMessage
+		if json.Unmarshal(b, &items) != nil || len(items) < ta.pageSize {
+			return nil
+		}
+
+		page++
+		query.Set("_page", strconv.Itoa(page))
+		requestURL.RawQuery = query.Encode()
 	}
 
-	paymentPlan = &paymentPlans[0]
-	return
+	return nil
 }
 
-// GetPayments ... returns the payment activities for a given payment plan from TrueAccord API
-func (ta *trueAccordAPIConnector) GetPayments(paymentPlanID int64) (payments []Payment, err *httphelpers.APIError) {
-	params := url.Values{"payment_plan_id": []string{strconv.Itoa(int(paymentPlanID))}}
-	resp, requestErr := ta.makeRequest(getPayments, "GET", nil, params)
-	if err != nil {
+// get ... makes a GET request and returns the response body and headers of a 200 response
+func (ta *trueAccordAPIConnector) get(ctx context.Context, endpoint string, requestURL *url.URL, resourceName string) (b []byte, header http.Header, err *httphelpers.APIError) {
+	clientErr := "Failed to GET " + resourceName
+
+	resp, attempts, requestErr := ta.makeRequest(ctx, endpoint, "GET", requestURL.String(), nil)
+	if requestErr != nil {
+		err = httphelpers.NewAPIError(requestErr, clientErr).SetInternalErrorMessage("Failed to send GET " + resourceName + " request").SetAttempts(attempts)
 		return
 	}
 
 	defer resp.Body.Close()
 
-	b, requestErr := ioutil.ReadAll(resp.Body)
+	b, requestErr = ioutil.ReadAll(resp.Body)
 	if requestErr != nil {
-		clientErr := "Failed to GET payments"
-		err = httphelpers.NewAPIError(requestErr, clientErr).SetInternalErrorMessage("Failed to read response body from GET payments")
+		err = httphelpers.NewAPIError(requestErr, clientErr).SetInternalErrorMessage("Failed to read response body from GET " + resourceName).SetAttempts(attempts)
 		return
 	}
 
 	if resp.StatusCode != 200 {
-		requestErr = errors.New("Failed to GET payments, non-200 response: " + string(b))
-		clientErr := "Failed to GET payments"
-		err = httphelpers.NewAPIError(requestErr, clientErr)
+		requestErr = errors.New(clientErr + ", non-200 response: " + string(b))
+		err = httphelpers.NewAPIError(requestErr, clientErr).SetAttempts(attempts)
 		return
 	}
 
-	requestErr = json.Unmarshal(b, &payments)
-	if requestErr != nil {
-		clientErr := "Failed to GET payments"
-		err = httphelpers.NewAPIError(requestErr, clientErr).SetInternalErrorMessage("Failed to unmarshal GET payments result")
+	return b, resp.Header, nil
+}
+
+// endpointURL ... returns the TrueAccord API URL of an endpoint with the given query parameters
+func (ta *trueAccordAPIConnector) endpointURL(endpoint string, query url.Values) (*url.URL, error) {
+	URL, err := url.Parse(fmt.Sprintf("%s/%s", ta.baseURL, endpoint))
+	if err != nil {
 		return nil, err
 	}
 
-	return
+	if len(query) > 0 {
+		URL.RawQuery = query.Encode()
+	}
+
+	return URL, nil
 }
 
-func (ta *trueAccordAPIConnector) makeRequest(endpoint, method string, body []byte, params url.Values) (resp *http.Response, err error) {
-	client := &http.Client{}
-	URL, err := url.Parse(fmt.Sprintf("%s/%s", trueAccordAPIURL, endpoint))
-	if err != nil {
-		return nil, err
+// nextLink ... returns the rel="next" URL of a Link header resolved against the current URL, or nil on the last page
+func nextLink(current *url.URL, link string) *url.URL {
+	for _, part := range strings.Split(link, ",") {
+		sections := strings.Split(part, ";")
+		target := strings.TrimSpace(sections[0])
+		if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+			continue
+		}
+
+		isNext := false
+		for _, param := range sections[1:] {
+			param = strings.Replace(strings.TrimSpace(param), " ", "", -1)
+			if param == `rel="next"` || param == "rel=next" {
+				isNext = true
+			}
+		}
+
+		if !isNext {
+			continue
+		}
+
+		next, err := url.Parse(strings.Trim(target, "<>"))
+		if err != nil {
+			return nil
+		}
+
+		resolved := current.ResolveReference(next)
+		if resolved.String() == current.String() {
+			return nil
+		}
+		return resolved
 	}
 
-	if params != nil {
-		URL.RawQuery = params.Encode()
+	return nil
+}
+
+// makeRequest ... sends a request, retrying idempotent requests on network errors, 429 and 5xx responses
+// according to the retry policy, waiting on the endpoint's rate limiter and authenticating before every attempt. Returns the last response (or error) and the number of attempts made.
+// A request resent once with refreshed credentials after a 401 isn't counted as another attempt.
+// Cancelling ctx aborts the request in flight and any backoff in progress.
+func (ta *trueAccordAPIConnector) makeRequest(ctx context.Context, endpoint, method, requestURL string, body []byte) (resp *http.Response, attempts int, err error) {
+	maxAttempts := ta.retryPolicy.MaxAttempts
+	if maxAttempts < 1 || !isIdempotent(method) {
+		maxAttempts = 1
 	}
 
-	req, err := http.NewRequest(method, URL.String(), bytes.NewBuffer(body))
-	if err != nil {
-		return nil, err
+	refreshed := false
+	for attempts = 1; ; {
+		if ctx.Err() != nil {
+			return nil, attempts, ctx.Err()
+		}
+
+		if limiter := ta.rateLimits[endpoint]; limiter != nil {
+			if limitErr := limiter.Wait(ctx); limitErr != nil {
+				return nil, attempts, limitErr
+			}
+		}
+
+		req, requestErr := http.NewRequest(method, requestURL, bytes.NewBuffer(body))
+		if requestErr != nil {
+			return nil, attempts, requestErr
+		}
+		req = req.WithContext(ctx)
+
+		if ta.authenticator != nil {
+			if authErr := ta.authenticator.Authenticate(req, body); authErr != nil {
+				return nil, attempts, authErr
+			}
+		}
+
+		resp, err = ta.client.Do(req)
+
+		// Refresh rejected credentials once per request; the retry with new credentials is not a backoff attempt
+		if err == nil && resp.StatusCode == http.StatusUnauthorized && ta.authenticator != nil && !refreshed {
+			refreshed = true
+
+			canRetry, refreshErr := ta.authenticator.Refresh(ctx, req)
+			if refreshErr != nil {
+				resp.Body.Close()
+				return nil, attempts, refreshErr
+			}
+
+			if canRetry {
+				ioutil.ReadAll(resp.Body)
+				resp.Body.Close()
+				continue
+			}
+		}
+
+		if attempts >= maxAttempts || ctx.Err() != nil {
+			return resp, attempts, err
+		}
+
+		delay := ta.retryPolicy.backoff(attempts, ta.random)
+		if err == nil {
+			if !isRetryableStatus(resp.StatusCode) {
+				return resp, attempts, nil
+			}
+
+			if requested, ok := retryAfter(resp.Header, time.Now()); ok {
+				delay = requested
+			}
+
+			// Drain the failed response so the connection can be reused
+			ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+		}
+
+		log.WithFields(log.Fields{
+			"Message": fmt.Sprintf("Retrying %s %s after attempt %d in %s", method, req.URL.Path, attempts, delay),
+		}).Info()
+
+		if sleepErr := ta.sleep(ctx, delay); sleepErr != nil {
+			return nil, attempts, sleepErr
+		}
+		attempts++
 	}
+}
 
-	resp, err = client.Do(req)
-	if err != nil {
-		return nil, err
+// sleepContext ... waits for d or until ctx is cancelled, whichever comes first
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
-	return resp, nil
 }
@@ -1,22 +1,34 @@
 package trueaccordapi
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/url"
 	"os"
 	"testing"
+	"time"
+
+	"true_accord/shared/money"
 
 	"github.com/jarcoal/httpmock"
-	log "github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 )
 
+// testAPIURL ... is the base URL of the connectors under test; httpmock intercepts every request to it
+const testAPIURL = "http://trueaccord.test"
+
 var trueAccordTestAPIConnector TrueAccordAPIConnector
 
+// withoutBackoff ... makes retries in tests immediate
+func withoutBackoff(ta *trueAccordAPIConnector) {
+	ta.sleep = func(context.Context, time.Duration) error {
+		return nil
+	}
+}
+
 func TestMain(m *testing.M) {
-	trueAccordTestAPIConnector = NewTrueAccordAPIConnector()
+	trueAccordTestAPIConnector = NewTrueAccordAPIConnector(WithBaseURL(testAPIURL), withoutBackoff)
 	os.Exit(m.Run())
 }
 
@@ -56,10 +68,10 @@ func TestGetDebtsSuccess(t *testing.T) {
 	}
 
 	// Exact URL match
-	httpmock.RegisterResponder("GET", fmt.Sprintf("%s/%s", trueAccordAPIURL, getDebts),
+	httpmock.RegisterResponder("GET", fmt.Sprintf("%s/%s", testAPIURL, getDebts),
 		httpmock.NewStringResponder(200, testDebtsResponse))
 
-	res, err := trueAccordTestAPIConnector.GetDebts()
+	res, err := trueAccordTestAPIConnector.GetDebts(context.Background())
 	assert.Nil(t, err, "GetDebts success")
 	assert.Equal(t, len(testDebts), len(res))
 }
@@ -79,10 +91,10 @@ func TestGetDebtsEmptyResponse(t *testing.T) {
 	}
 
 	// Exact URL match
-	httpmock.RegisterResponder("GET", fmt.Sprintf("%s/%s", trueAccordAPIURL, getDebts),
+	httpmock.RegisterResponder("GET", fmt.Sprintf("%s/%s", testAPIURL, getDebts),
 		httpmock.NewStringResponder(200, testDebtsResponse))
 
-	res, err := trueAccordTestAPIConnector.GetDebts()
+	res, err := trueAccordTestAPIConnector.GetDebts(context.Background())
 	assert.Nil(t, err, "GetDebts empty response")
 	assert.Equal(t, testDebts, res)
 }
@@ -115,10 +127,10 @@ func TestGetDebtsIncorrectResponseFormat(t *testing.T) {
 	]`
 
 	// Exact URL match
-	httpmock.RegisterResponder("GET", fmt.Sprintf("%s/%s", trueAccordAPIURL, getDebts),
+	httpmock.RegisterResponder("GET", fmt.Sprintf("%s/%s", testAPIURL, getDebts),
 		httpmock.NewStringResponder(200, testDebtsResponse))
 
-	_, err := trueAccordTestAPIConnector.GetDebts()
+	_, err := trueAccordTestAPIConnector.GetDebts(context.Background())
 	assert.NotNil(t, err, "GetDebts should return error with incorrect response struture")
 	assert.Equal(t, "Failed to unmarshal GET debts result", err.InternalErrorMessage)
 }
@@ -128,10 +140,10 @@ func TestGetDebtsNon200Response(t *testing.T) {
 	defer httpmock.DeactivateAndReset()
 
 	// Exact URL match
-	httpmock.RegisterResponder("GET", fmt.Sprintf("%s/%s", trueAccordAPIURL, getDebts),
+	httpmock.RegisterResponder("GET", fmt.Sprintf("%s/%s", testAPIURL, getDebts),
 		httpmock.NewStringResponder(503, ""))
 
-	_, err := trueAccordTestAPIConnector.GetDebts()
+	_, err := trueAccordTestAPIConnector.GetDebts(context.Background())
 	assert.NotNil(t, err, "GetDebts should return error with non-200 response")
 }
 
@@ -165,12 +177,13 @@ func TestGetPaymentPlansSuccess(t *testing.T) {
 	}
 
 	// Exact URL match
-	httpmock.RegisterResponderWithQuery("GET", fmt.Sprintf("%s/%s", trueAccordAPIURL, getPaymentPlans), expectedQuery,
+	httpmock.RegisterResponderWithQuery("GET", fmt.Sprintf("%s/%s", testAPIURL, getPaymentPlans), expectedQuery,
 		httpmock.NewStringResponder(200, testPaymentPlansResponse))
 
-	res, err := trueAccordTestAPIConnector.GetPaymentPlan(debtID)
-	assert.Nil(t, err, "GetPaymentPlanSuccess")
-	assert.Equal(t, testPaymentPlans[0], res)
+	res, err := trueAccordTestAPIConnector.GetPaymentPlans(context.Background(), debtID)
+	assert.Nil(t, err, "GetPaymentPlansSuccess")
+	assert.Equal(t, 1, len(res))
+	assert.Equal(t, *testPaymentPlans[0], res[0])
 }
 
 func TestGetPaymentPlansSuccessEmptyResponse(t *testing.T) {
@@ -194,23 +207,15 @@ func TestGetPaymentPlansSuccessEmptyResponse(t *testing.T) {
 	}
 
 	// Exact URL match
-	httpmock.RegisterResponderWithQuery("GET", fmt.Sprintf("%s/%s", trueAccordAPIURL, getPaymentPlans), expectedQuery,
+	httpmock.RegisterResponderWithQuery("GET", fmt.Sprintf("%s/%s", testAPIURL, getPaymentPlans), expectedQuery,
 		httpmock.NewStringResponder(200, testPaymentPlansResponse))
 
-	var emptyRes *PaymentPlan
-
-	res, err := trueAccordTestAPIConnector.GetPaymentPlan(debtID)
-	assert.Nil(t, err, "GetPaymentPlanSuccess empty response")
-	assert.Equal(t, emptyRes, res)
+	res, err := trueAccordTestAPIConnector.GetPaymentPlans(context.Background(), debtID)
+	assert.Nil(t, err, "GetPaymentPlansSuccess empty response")
+	assert.Empty(t, res)
 }
 
 func TestGetPaymentPlansMoreThanOneToDebt(t *testing.T) {
-	var loggedError bytes.Buffer
-	log.SetOutput(&loggedError)
-	defer func() {
-		log.SetOutput(os.Stderr)
-	}()
-
 	httpmock.Activate()
 	defer httpmock.DeactivateAndReset()
 
@@ -248,19 +253,44 @@ func TestGetPaymentPlansMoreThanOneToDebt(t *testing.T) {
 	}
 
 	// Exact URL match
-	httpmock.RegisterResponderWithQuery("GET", fmt.Sprintf("%s/%s", trueAccordAPIURL, getPaymentPlans), expectedQuery,
+	httpmock.RegisterResponderWithQuery("GET", fmt.Sprintf("%s/%s", testAPIURL, getPaymentPlans), expectedQuery,
 		httpmock.NewStringResponder(200, testPaymentPlansResponse))
 
-	res, err := trueAccordTestAPIConnector.GetPaymentPlan(debtID)
-	assert.Nil(t, err, "GetPaymentPlanSuccess more than one payment plan found")
-	assert.Equal(t, testPaymentPlans[0], res)
+	res, err := trueAccordTestAPIConnector.GetPaymentPlans(context.Background(), debtID)
+	assert.Nil(t, err, "GetPaymentPlansSuccess more than one payment plan found")
+	assert.Equal(t, 2, len(res), "Every payment plan of the debt is returned")
+	assert.Equal(t, *testPaymentPlans[0], res[0])
+	assert.Equal(t, *testPaymentPlans[1], res[1])
+}
+
+func TestGetPaymentPlansSuccessHistory(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	debtID := int64(0)
+
+	testPaymentPlansResponse := `[
+		{"amount_to_pay": 80, "debt_id": 0, "id": 2, "installment_amount": 20, "installment_frequency": "WEEKLY", "start_date": "2020-10-28"},
+		{"amount_to_pay": 102.5, "debt_id": 0, "id": 1, "installment_amount": 51.25, "installment_frequency": "WEEKLY", "start_date": "2020-09-28"},
+		{"amount_to_pay": 50, "debt_id": 0, "id": 3, "installment_amount": 25, "installment_frequency": "WEEKLY", "start_date": "10/28/2020"}
+	]`
+
+	expectedQuery := url.Values{
+		"debt_id": []string{fmt.Sprintf("%d", debtID)},
+	}
+
+	// Exact URL match
+	httpmock.RegisterResponderWithQuery("GET", fmt.Sprintf("%s/%s", testAPIURL, getPaymentPlans), expectedQuery,
+		httpmock.NewStringResponder(200, testPaymentPlansResponse))
 
-	/** Logrus is logging additional information in the format:
-	"time=\"2020-10-30T14:31:46-07:00\" level=info Message=\"More than 1 payment plan found for debtID 0\"\n"
+	res, err := trueAccordTestAPIConnector.GetPaymentPlans(context.Background(), debtID)
+	assert.Nil(t, err, "GetPaymentPlans success")
 
-	TODO: Fix error matching for logrus.
-	*/
-	assert.NotNil(t, loggedError.String(), "GetPaymentPlanSuccess should log an informational error when more than one payment plan is found")
+	var ids []int64
+	for _, paymentPlan := range res {
+		ids = append(ids, paymentPlan.ID)
+	}
+	assert.Equal(t, []int64{1, 2, 3}, ids, "GetPaymentPlans should order plans by start_date with unparseable dates last")
 }
 
 func TestGetPaymentPlansFailureIncorrectPaymentFormat(t *testing.T) {
@@ -285,11 +315,11 @@ func TestGetPaymentPlansFailureIncorrectPaymentFormat(t *testing.T) {
 	}
 
 	// Exact URL match
-	httpmock.RegisterResponderWithQuery("GET", fmt.Sprintf("%s/%s", trueAccordAPIURL, getPaymentPlans), expectedQuery,
+	httpmock.RegisterResponderWithQuery("GET", fmt.Sprintf("%s/%s", testAPIURL, getPaymentPlans), expectedQuery,
 		httpmock.NewStringResponder(200, testPaymentPlansResponse))
 
-	_, err := trueAccordTestAPIConnector.GetPaymentPlan(debtID)
-	assert.NotNil(t, err, "GetPaymentPlan should return error with incorrect response struture")
+	_, err := trueAccordTestAPIConnector.GetPaymentPlans(context.Background(), debtID)
+	assert.NotNil(t, err, "GetPaymentPlans should return error with incorrect response struture")
 }
 
 func TestGetPaymentPlansNon200Response(t *testing.T) {
@@ -303,10 +333,10 @@ func TestGetPaymentPlansNon200Response(t *testing.T) {
 	}
 
 	// Exact URL match
-	httpmock.RegisterResponderWithQuery("GET", fmt.Sprintf("%s/%s", trueAccordAPIURL, getPaymentPlans), expectedQuery,
+	httpmock.RegisterResponderWithQuery("GET", fmt.Sprintf("%s/%s", testAPIURL, getPaymentPlans), expectedQuery,
 		httpmock.NewStringResponder(503, ""))
 
-	_, err := trueAccordTestAPIConnector.GetPaymentPlan(debtID)
+	_, err := trueAccordTestAPIConnector.GetPaymentPlans(context.Background(), debtID)
 	assert.NotNil(t, err, "GetPaymentPlans should return error with non-200 response")
 }
 
@@ -342,10 +372,10 @@ func TestGetPaymentsSuccess(t *testing.T) {
 	}
 
 	// Exact URL match
-	httpmock.RegisterResponderWithQuery("GET", fmt.Sprintf("%s/%s", trueAccordAPIURL, getPayments), expectedQuery,
+	httpmock.RegisterResponderWithQuery("GET", fmt.Sprintf("%s/%s", testAPIURL, getPayments), expectedQuery,
 		httpmock.NewStringResponder(200, testPaymentsResponse))
 
-	res, err := trueAccordTestAPIConnector.GetPayments(paymentPlanID)
+	res, err := trueAccordTestAPIConnector.GetPayments(context.Background(), paymentPlanID)
 	assert.Nil(t, err, "GetPaymentsSuccess")
 	assert.Equal(t, testPayments, res)
 }
@@ -371,10 +401,10 @@ func TestGetPaymentsSuccessEmptyResponse(t *testing.T) {
 	}
 
 	// Exact URL match
-	httpmock.RegisterResponderWithQuery("GET", fmt.Sprintf("%s/%s", trueAccordAPIURL, getPayments), expectedQuery,
+	httpmock.RegisterResponderWithQuery("GET", fmt.Sprintf("%s/%s", testAPIURL, getPayments), expectedQuery,
 		httpmock.NewStringResponder(200, testPaymentsResponse))
 
-	res, err := trueAccordTestAPIConnector.GetPayments(paymentPlanID)
+	res, err := trueAccordTestAPIConnector.GetPayments(context.Background(), paymentPlanID)
 	assert.Nil(t, err, "GetPaymentsSuccess empty response")
 	assert.Equal(t, testPayments, res)
 }
@@ -403,10 +433,10 @@ func TestGetPaymentsFailureIncorrectFormat(t *testing.T) {
 	}
 
 	// Exact URL match
-	httpmock.RegisterResponderWithQuery("GET", fmt.Sprintf("%s/%s", trueAccordAPIURL, getPayments), expectedQuery,
+	httpmock.RegisterResponderWithQuery("GET", fmt.Sprintf("%s/%s", testAPIURL, getPayments), expectedQuery,
 		httpmock.NewStringResponder(200, testPaymentsResponse))
 
-	_, err := trueAccordTestAPIConnector.GetPayments(paymentPlanID)
+	_, err := trueAccordTestAPIConnector.GetPayments(context.Background(), paymentPlanID)
 	assert.NotNil(t, err, "GetPayments should return error with incorrect response struture")
 }
 
@@ -421,9 +451,271 @@ func TestGetPaymentsNon200Response(t *testing.T) {
 	}
 
 	// Exact URL match
-	httpmock.RegisterResponderWithQuery("GET", fmt.Sprintf("%s/%s", trueAccordAPIURL, getPayments), expectedQuery,
+	httpmock.RegisterResponderWithQuery("GET", fmt.Sprintf("%s/%s", testAPIURL, getPayments), expectedQuery,
 		httpmock.NewStringResponder(503, ""))
 
-	_, err := trueAccordTestAPIConnector.GetPayments(paymentPlanID)
+	_, err := trueAccordTestAPIConnector.GetPayments(context.Background(), paymentPlanID)
 	assert.NotNil(t, err, "GetPayments should return error with non-200 response")
 }
+
+func TestGetAllPaymentPlansSuccess(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	testPaymentPlansResponse := `[
+		{
+			"amount_to_pay": 102.5,
+			"debt_id": 0,
+			"id": 0,
+			"installment_amount": 51.25,
+			"installment_frequency": "WEEKLY",
+			"start_date": "2020-09-28"
+		},
+		{
+			"amount_to_pay": 100,
+			"debt_id": 1,
+			"id": 1,
+			"installment_amount": 25,
+			"installment_frequency": "WEEKLY",
+			"start_date": "2020-08-01"
+		}
+	]`
+
+	// Exact URL match
+	httpmock.RegisterResponder("GET", fmt.Sprintf("%s/%s", testAPIURL, getPaymentPlans),
+		httpmock.NewStringResponder(200, testPaymentPlansResponse))
+
+	res, err := trueAccordTestAPIConnector.GetAllPaymentPlans(context.Background())
+	assert.Nil(t, err, "GetAllPaymentPlans success")
+	assert.Equal(t, 2, len(res))
+	assert.Equal(t, int64(1), res[1].DebtID)
+}
+
+func TestGetAllPaymentsNon200Response(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	// Exact URL match
+	httpmock.RegisterResponder("GET", fmt.Sprintf("%s/%s", testAPIURL, getPayments),
+		httpmock.NewStringResponder(503, ""))
+
+	res, err := trueAccordTestAPIConnector.GetAllPayments(context.Background())
+	assert.NotNil(t, err, "GetAllPayments should return error with non-200 response")
+	assert.Nil(t, res)
+}
+
+func TestGetDebtByIDSuccess(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	// Exact URL match
+	httpmock.RegisterResponderWithQuery("GET", fmt.Sprintf("%s/%s", testAPIURL, getDebts), url.Values{"id": []string{"4"}},
+		httpmock.NewStringResponder(200, `[{"amount": 123.46, "id": 4}]`))
+	httpmock.RegisterResponderWithQuery("GET", fmt.Sprintf("%s/%s", testAPIURL, getDebts), url.Values{"id": []string{"5"}},
+		httpmock.NewStringResponder(200, `[]`))
+
+	debt, err := trueAccordTestAPIConnector.GetDebtByID(context.Background(), 4)
+	assert.Nil(t, err, "GetDebtByID success")
+	assert.Equal(t, &Debt{ID: 4, Amount: money.MustParse("123.46")}, debt)
+
+	debt, err = trueAccordTestAPIConnector.GetDebtByID(context.Background(), 5)
+	assert.Nil(t, err, "GetDebtByID success with no debt")
+	assert.Nil(t, debt)
+}
+
+func TestGetDebtByIDNon200Response(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder("GET", fmt.Sprintf("%s/%s", testAPIURL, getDebts),
+		httpmock.NewStringResponder(503, ""))
+
+	debt, err := trueAccordTestAPIConnector.GetDebtByID(context.Background(), 4)
+	assert.NotNil(t, err, "GetDebtByID should return error with non-200 response")
+	assert.Nil(t, debt)
+}
+
+func TestGetPaymentPlanByIDSuccess(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	testPaymentPlansResponse := `[
+		{
+			"amount_to_pay": 102.5,
+			"debt_id": 3,
+			"id": 7,
+			"installment_amount": 51.25,
+			"installment_frequency": "WEEKLY",
+			"start_date": "2020-09-28"
+		}
+	]`
+
+	// Exact URL match
+	httpmock.RegisterResponderWithQuery("GET", fmt.Sprintf("%s/%s", testAPIURL, getPaymentPlans), url.Values{"id": []string{"7"}},
+		httpmock.NewStringResponder(200, testPaymentPlansResponse))
+	httpmock.RegisterResponderWithQuery("GET", fmt.Sprintf("%s/%s", testAPIURL, getPaymentPlans), url.Values{"id": []string{"8"}},
+		httpmock.NewStringResponder(200, `[]`))
+
+	paymentPlan, err := trueAccordTestAPIConnector.GetPaymentPlanByID(context.Background(), 7)
+	assert.Nil(t, err, "GetPaymentPlanByID success")
+	if assert.NotNil(t, paymentPlan) {
+		assert.Equal(t, int64(3), paymentPlan.DebtID)
+		assert.Equal(t, money.MustParse("51.25"), paymentPlan.InstallmentAmount)
+	}
+
+	paymentPlan, err = trueAccordTestAPIConnector.GetPaymentPlanByID(context.Background(), 8)
+	assert.Nil(t, err, "GetPaymentPlanByID success with no payment plan")
+	assert.Nil(t, paymentPlan)
+}
+
+// linkResponder ... returns a 200 responder with the given body and Link header
+func linkResponder(body, link string) httpmock.Responder {
+	resp := httpmock.NewStringResponse(200, body)
+	if link != "" {
+		resp.Header.Set("Link", link)
+	}
+	return httpmock.ResponderFromResponse(resp)
+}
+
+func TestGetDebtsSuccessFollowsLinkHeaders(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	debtsURL := fmt.Sprintf("%s/%s", testAPIURL, getDebts)
+	pagedConnector := NewTrueAccordAPIConnector(WithBaseURL(testAPIURL), WithPageSize(2))
+
+	httpmock.RegisterResponderWithQuery("GET", debtsURL, url.Values{"_page": []string{"1"}, "_limit": []string{"2"}},
+		linkResponder(`[{"amount": 1, "id": 0}, {"amount": 2, "id": 1}]`,
+			fmt.Sprintf(`<%s?_page=1&_limit=2>; rel="first", <%s?_page=2&_limit=2>; rel="next", <%s?_page=2&_limit=2>; rel="last"`, debtsURL, debtsURL, debtsURL)))
+	httpmock.RegisterResponderWithQuery("GET", debtsURL, url.Values{"_page": []string{"2"}, "_limit": []string{"2"}},
+		linkResponder(`[{"amount": 3, "id": 2}, {"amount": 4, "id": 3}]`,
+			fmt.Sprintf(`<%s?_page=1&_limit=2>; rel="first", <%s?_page=1&_limit=2>; rel="prev", <%s?_page=2&_limit=2>; rel="last"`, debtsURL, debtsURL, debtsURL)))
+
+	res, err := pagedConnector.GetDebts(context.Background())
+	assert.Nil(t, err, "GetDebts paged success")
+	assert.Equal(t, 4, len(res))
+	assert.Equal(t, int64(3), res[3].ID)
+	assert.Equal(t, 2, httpmock.GetTotalCallCount())
+}
+
+func TestGetDebtsSuccessFollowsCursorLinks(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	debtsURL := fmt.Sprintf("%s/%s", testAPIURL, getDebts)
+	pagedConnector := NewTrueAccordAPIConnector(WithBaseURL(testAPIURL), WithPageSize(2))
+
+	httpmock.RegisterResponderWithQuery("GET", debtsURL, url.Values{"_page": []string{"1"}, "_limit": []string{"2"}},
+		linkResponder(`[{"amount": 1, "id": 0}, {"amount": 2, "id": 1}]`, `<debts?cursor=abc>; rel="next"`))
+	httpmock.RegisterResponderWithQuery("GET", debtsURL, url.Values{"cursor": []string{"abc"}},
+		linkResponder(`[{"amount": 3, "id": 2}]`, ""))
+
+	res, err := pagedConnector.GetDebts(context.Background())
+	assert.Nil(t, err, "GetDebts cursor success")
+	assert.Equal(t, 3, len(res))
+}
+
+func TestGetPaymentsSuccessPagesWithoutLinkHeaders(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	paymentsURL := fmt.Sprintf("%s/%s", testAPIURL, getPayments)
+	pagedConnector := NewTrueAccordAPIConnector(WithBaseURL(testAPIURL), WithPageSize(2))
+
+	pages := []string{
+		`[{"amount": 1, "date": "2020-09-29", "payment_plan_id": 0}, {"amount": 2, "date": "2020-09-30", "payment_plan_id": 0}]`,
+		`[{"amount": 3, "date": "2020-10-01", "payment_plan_id": 0}, {"amount": 4, "date": "2020-10-02", "payment_plan_id": 0}]`,
+		`[{"amount": 5, "date": "2020-10-03", "payment_plan_id": 0}]`,
+	}
+	for i, page := range pages {
+		expectedQuery := url.Values{
+			"payment_plan_id": []string{"0"},
+			"_page":           []string{fmt.Sprintf("%d", i+1)},
+			"_limit":          []string{"2"},
+		}
+		httpmock.RegisterResponderWithQuery("GET", paymentsURL, expectedQuery, httpmock.NewStringResponder(200, page))
+	}
+
+	res, err := pagedConnector.GetPayments(context.Background(), 0)
+	assert.Nil(t, err, "GetPayments paged success")
+	assert.Equal(t, 5, len(res))
+	assert.Equal(t, 3, httpmock.GetTotalCallCount())
+}
+
+func TestGetDebtsSuccessStopsWhenPageIsIgnored(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	debtsURL := fmt.Sprintf("%s/%s", testAPIURL, getDebts)
+	pagedConnector := NewTrueAccordAPIConnector(WithBaseURL(testAPIURL), WithPageSize(2))
+
+	// Every _page gets the same full page and no Link header
+	httpmock.RegisterResponder("GET", debtsURL, httpmock.NewStringResponder(200, `[{"amount": 1, "id": 0}, {"amount": 2, "id": 1}]`))
+
+	res, err := pagedConnector.GetDebts(context.Background())
+	assert.Nil(t, err, "GetDebts ignored page success")
+	assert.Equal(t, 2, len(res))
+	assert.Equal(t, 2, httpmock.GetTotalCallCount())
+}
+
+func TestGetDebtsSuccessStopsOnSelfLink(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	debtsURL := fmt.Sprintf("%s/%s", testAPIURL, getDebts)
+	pagedConnector := NewTrueAccordAPIConnector(WithBaseURL(testAPIURL), WithPageSize(2))
+
+	httpmock.RegisterResponder("GET", debtsURL,
+		linkResponder(`[{"amount": 1, "id": 0}, {"amount": 2, "id": 1}]`, fmt.Sprintf(`<%s?_page=1&_limit=2>; rel="next"`, debtsURL)))
+
+	res, err := pagedConnector.GetDebts(context.Background())
+	assert.Nil(t, err, "GetDebts self link success")
+	assert.Equal(t, 2, len(res))
+	assert.Equal(t, 2, httpmock.GetTotalCallCount())
+}
+
+func TestStreamDebtsFailureStopsOnHandlerError(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	debtsURL := fmt.Sprintf("%s/%s", testAPIURL, getDebts)
+	pagedConnector := NewTrueAccordAPIConnector(WithBaseURL(testAPIURL), WithPageSize(1))
+
+	httpmock.RegisterResponder("GET", debtsURL, httpmock.NewStringResponder(200, `[{"amount": 1, "id": 0}]`))
+
+	pages := 0
+	err := pagedConnector.StreamDebts(context.Background(), func(debts []Debt) error {
+		pages++
+		return fmt.Errorf("Stop after page %d", pages)
+	})
+	assert.NotNil(t, err, "StreamDebts should return the handler error")
+	assert.Equal(t, 1, pages)
+	assert.Equal(t, 1, httpmock.GetTotalCallCount())
+}
+
+func TestNextLinkSuccess(t *testing.T) {
+	current, _ := url.Parse("http://localhost/debts?_page=1&_limit=2")
+
+	next := nextLink(current, `<http://localhost/debts?_page=2&_limit=2>; rel="next", <http://localhost/debts?_page=5&_limit=2>; rel="last"`)
+	assert.Equal(t, "http://localhost/debts?_page=2&_limit=2", next.String())
+
+	assert.Nil(t, nextLink(current, `<http://localhost/debts?_page=1&_limit=2>; rel="first"`))
+	assert.Nil(t, nextLink(current, `<http://localhost/debts?_page=1&_limit=2>; rel="next"`))
+	assert.Nil(t, nextLink(current, `garbage`))
+}
+
+func TestGetDebtsSuccessSeparateBaseURLs(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder("GET", "http://first.test/debts", httpmock.NewStringResponder(200, `[{"id": 1, "amount": 10}]`))
+	httpmock.RegisterResponder("GET", "http://second.test/api/debts", httpmock.NewStringResponder(200, `[{"id": 2, "amount": 20}]`))
+
+	first, err := NewTrueAccordAPIConnector(WithBaseURL("http://first.test")).GetDebts(context.Background())
+	assert.Nil(t, err)
+	second, err := NewTrueAccordAPIConnector(WithBaseURL("http://second.test/api/")).GetDebts(context.Background())
+	assert.Nil(t, err)
+
+	assert.Equal(t, int64(1), first[0].ID)
+	assert.Equal(t, int64(2), second[0].ID)
+}
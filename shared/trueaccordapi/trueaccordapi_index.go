@@ -0,0 +1,89 @@
+package trueaccordapi
+
+import (
+	"context"
+
+	"true_accord/shared/httphelpers"
+)
+
+// indexedConnector ... serves payment plans and payments from memory, indexed by debt_id and payment_plan_id
+type indexedConnector struct {
+	TrueAccordAPIConnector
+
+	paymentPlans         []PaymentPlan
+	payments             []Payment
+	paymentPlansByID     map[int64]PaymentPlan
+	paymentPlansByDebtID map[int64][]PaymentPlan
+	paymentsByPlanID     map[int64][]Payment
+}
+
+// NewIndexedConnector ... fetches every payment plan and payment once through connector and returns a
+// TrueAccordAPIConnector that answers GetPaymentPlans, GetPaymentPlanByID and GetPayments from memory.
+// GetDebts and GetDebtByID are passed through.
+func NewIndexedConnector(ctx context.Context, connector TrueAccordAPIConnector) (TrueAccordAPIConnector, *httphelpers.APIError) {
+	paymentPlans, err := connector.GetAllPaymentPlans(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	payments, err := connector.GetAllPayments(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return newIndexedConnector(connector, paymentPlans, payments), nil
+}
+
+func newIndexedConnector(connector TrueAccordAPIConnector, paymentPlans []PaymentPlan, payments []Payment) *indexedConnector {
+	ic := &indexedConnector{
+		TrueAccordAPIConnector: connector,
+		paymentPlans:           paymentPlans,
+		payments:               payments,
+		paymentPlansByID:       make(map[int64]PaymentPlan),
+		paymentPlansByDebtID:   make(map[int64][]PaymentPlan),
+		paymentsByPlanID:       make(map[int64][]Payment),
+	}
+
+	for _, paymentPlan := range paymentPlans {
+		if _, ok := ic.paymentPlansByID[paymentPlan.ID]; !ok {
+			ic.paymentPlansByID[paymentPlan.ID] = paymentPlan
+		}
+		ic.paymentPlansByDebtID[paymentPlan.DebtID] = append(ic.paymentPlansByDebtID[paymentPlan.DebtID], paymentPlan)
+	}
+
+	for _, payment := range payments {
+		ic.paymentsByPlanID[payment.PaymentPlanID] = append(ic.paymentsByPlanID[payment.PaymentPlanID], payment)
+	}
+
+	return ic
+}
+
+// GetPaymentPlans ... returns every indexed payment plan for a given debt, ordered by start_date
+func (ic *indexedConnector) GetPaymentPlans(ctx context.Context, debtID int64) (paymentPlans []PaymentPlan, err *httphelpers.APIError) {
+	paymentPlans = append([]PaymentPlan{}, ic.paymentPlansByDebtID[debtID]...)
+	SortPaymentPlans(paymentPlans)
+	return paymentPlans, nil
+}
+
+// GetPaymentPlanByID ... returns the indexed payment plan with the given ID, or nil if there is none
+func (ic *indexedConnector) GetPaymentPlanByID(ctx context.Context, paymentPlanID int64) (paymentPlan *PaymentPlan, err *httphelpers.APIError) {
+	if found, ok := ic.paymentPlansByID[paymentPlanID]; ok {
+		return &found, nil
+	}
+	return nil, nil
+}
+
+// GetPayments ... returns the indexed payment activities for a given payment plan
+func (ic *indexedConnector) GetPayments(ctx context.Context, paymentPlanID int64) (payments []Payment, err *httphelpers.APIError) {
+	return append([]Payment(nil), ic.paymentsByPlanID[paymentPlanID]...), nil
+}
+
+// GetAllPaymentPlans ... returns every indexed payment plan
+func (ic *indexedConnector) GetAllPaymentPlans(ctx context.Context) (paymentPlans []PaymentPlan, err *httphelpers.APIError) {
+	return append([]PaymentPlan(nil), ic.paymentPlans...), nil
+}
+
+// GetAllPayments ... returns every indexed payment
+func (ic *indexedConnector) GetAllPayments(ctx context.Context) (payments []Payment, err *httphelpers.APIError) {
+	return append([]Payment(nil), ic.payments...), nil
+}
@@ -0,0 +1,76 @@
+package trueaccordapi
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"true_accord/shared/money"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewIndexedConnectorSuccess(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	testPaymentPlansResponse := `[
+		{"amount_to_pay": 102.5, "debt_id": 0, "id": 0, "installment_amount": 51.25, "installment_frequency": "WEEKLY", "start_date": "2020-09-28"},
+		{"amount_to_pay": 100, "debt_id": 1, "id": 1, "installment_amount": 25, "installment_frequency": "WEEKLY", "start_date": "2020-08-01"}
+	]`
+
+	testPaymentsResponse := `[
+		{"amount": 51.25, "date": "2020-09-29", "payment_plan_id": 0},
+		{"amount": 25, "date": "2020-08-08", "payment_plan_id": 1},
+		{"amount": 25, "date": "2020-08-15", "payment_plan_id": 1}
+	]`
+
+	httpmock.RegisterResponder("GET", fmt.Sprintf("%s/%s", testAPIURL, getPaymentPlans),
+		httpmock.NewStringResponder(200, testPaymentPlansResponse))
+	httpmock.RegisterResponder("GET", fmt.Sprintf("%s/%s", testAPIURL, getPayments),
+		httpmock.NewStringResponder(200, testPaymentsResponse))
+
+	indexedConnector, err := NewIndexedConnector(context.Background(), trueAccordTestAPIConnector)
+	assert.Nil(t, err)
+
+	for debtID := int64(0); debtID < 3; debtID++ {
+		_, err = indexedConnector.GetPaymentPlans(context.Background(), debtID)
+		assert.Nil(t, err)
+	}
+
+	paymentPlans, _ := indexedConnector.GetPaymentPlans(context.Background(), 1)
+	assert.Equal(t, 1, len(paymentPlans))
+	assert.Equal(t, money.MustParse("100"), paymentPlans[0].AmountToPay)
+
+	noPaymentPlans, _ := indexedConnector.GetPaymentPlans(context.Background(), 2)
+	assert.Equal(t, 0, len(noPaymentPlans))
+
+	payments, _ := indexedConnector.GetPayments(context.Background(), 1)
+	assert.Equal(t, 2, len(payments))
+
+	noPayments, _ := indexedConnector.GetPayments(context.Background(), 5)
+	assert.Equal(t, 0, len(noPayments))
+
+	paymentPlan, _ := indexedConnector.GetPaymentPlanByID(context.Background(), 1)
+	if assert.NotNil(t, paymentPlan) {
+		assert.Equal(t, int64(1), paymentPlan.DebtID)
+	}
+
+	noPaymentPlan, _ := indexedConnector.GetPaymentPlanByID(context.Background(), 5)
+	assert.Nil(t, noPaymentPlan)
+
+	// A full run costs one request per resource regardless of how many debts are looked up
+	assert.Equal(t, 2, httpmock.GetTotalCallCount())
+}
+
+func TestNewIndexedConnectorFailureNon200Response(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder("GET", fmt.Sprintf("%s/%s", testAPIURL, getPaymentPlans),
+		httpmock.NewStringResponder(503, ""))
+
+	_, err := NewIndexedConnector(context.Background(), trueAccordTestAPIConnector)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,34 @@
+package trueaccordapi
+
+import (
+	"true_accord/shared/ratelimit"
+)
+
+// Endpoints ... are the TrueAccord API endpoints used by the connector, as accepted by WithRateLimits
+var Endpoints = []string{getDebts, getPaymentPlans, getPayments}
+
+// WithRateLimits ... throttles requests to each endpoint (debts, payment_plans, payments) with its limiter.
+// Every attempt, including retries, takes a token. Endpoints without a limiter are not throttled.
+func WithRateLimits(limits map[string]*ratelimit.Limiter) Option {
+	return func(ta *trueAccordAPIConnector) {
+		ta.rateLimits = limits
+	}
+}
+
+// NewRateLimits ... returns a limiter per endpoint from its "RATE" or "RATE:BURST" requests per second.
+// Endpoints without a spec are left out.
+func NewRateLimits(specs map[string]string) (limits map[string]*ratelimit.Limiter, err error) {
+	limits = make(map[string]*ratelimit.Limiter)
+	for endpoint, spec := range specs {
+		if spec == "" {
+			continue
+		}
+
+		limits[endpoint], err = ratelimit.Parse(spec)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return limits, nil
+}
@@ -0,0 +1,57 @@
+package trueaccordapi
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"true_accord/shared/clock"
+	"true_accord/shared/ratelimit"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewRateLimitsSuccess(t *testing.T) {
+	limits, err := NewRateLimits(map[string]string{getPaymentPlans: "5:10", getPayments: ""})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(limits))
+	assert.NotNil(t, limits[getPaymentPlans])
+}
+
+func TestNewRateLimitsFailureInvalidSpec(t *testing.T) {
+	_, err := NewRateLimits(map[string]string{getDebts: "fast"})
+	assert.NotNil(t, err)
+}
+
+func TestGetPaymentsSuccessRateLimitedPerEndpoint(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	var waits []time.Duration
+	recordWait := func(ctx context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}
+	fixedClock := clock.NewFixedClock(time.Date(2020, 10, 30, 12, 0, 0, 0, time.UTC))
+
+	connector := NewTrueAccordAPIConnector(WithBaseURL(testAPIURL), WithRateLimits(map[string]*ratelimit.Limiter{
+		getPayments: ratelimit.NewLimiterWithClock(4, 1, fixedClock, recordWait),
+	}))
+
+	httpmock.RegisterResponder("GET", fmt.Sprintf("%s/%s", testAPIURL, getPayments),
+		httpmock.NewStringResponder(200, `[]`))
+	httpmock.RegisterResponder("GET", fmt.Sprintf("%s/%s", testAPIURL, getDebts),
+		httpmock.NewStringResponder(200, `[]`))
+
+	for i := 0; i < 3; i++ {
+		_, err := connector.GetAllPayments(context.Background())
+		assert.Nil(t, err)
+
+		_, err = connector.GetDebts(context.Background())
+		assert.Nil(t, err)
+	}
+
+	assert.Equal(t, []time.Duration{250 * time.Millisecond, 500 * time.Millisecond}, waits, "Only the payments endpoint is throttled")
+}
@@ -0,0 +1,91 @@
+package trueaccordapi
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RetryPolicy ... controls how failed idempotent requests are retried
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts per request, including the first; 1 disables retries
+	MaxAttempts int
+	// BaseDelay is the backoff before the second attempt; it doubles on every following attempt
+	BaseDelay time.Duration
+	// MaxDelay caps the exponential backoff (a Retry-After header from the API is honored as sent)
+	MaxDelay time.Duration
+}
+
+// DefaultRetryPolicy ... is the retry policy of connectors created without WithRetryPolicy
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   200 * time.Millisecond,
+	MaxDelay:    5 * time.Second,
+}
+
+// WithRetryPolicy ... sets how GET requests are retried on network errors, 429 and 5xx responses
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(ta *trueAccordAPIConnector) {
+		ta.retryPolicy = policy
+	}
+}
+
+// isIdempotent ... returns whether a request with the given method is safe to retry
+func isIdempotent(method string) bool {
+	switch strings.ToUpper(method) {
+	case "GET", "HEAD", "OPTIONS":
+		return true
+	}
+	return false
+}
+
+// isRetryableStatus ... returns whether a response status code is worth retrying
+func isRetryableStatus(statusCode int) bool {
+	return statusCode == http.StatusTooManyRequests || statusCode >= 500
+}
+
+// backoff ... returns the delay before the attempt after the given (1-based) attempt: exponential with equal
+// jitter, so the delay is between half and all of min(MaxDelay, BaseDelay * 2^(attempt-1))
+func (p RetryPolicy) backoff(attempt int, random func(n int64) int64) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < attempt && (p.MaxDelay <= 0 || delay < p.MaxDelay); i++ {
+		delay *= 2
+	}
+
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+
+	if delay <= 0 {
+		return 0
+	}
+
+	half := delay / 2
+	return half + time.Duration(random(int64(delay-half)+1))
+}
+
+// retryAfter ... returns the delay requested by a Retry-After header (seconds or HTTP date), if any
+func retryAfter(header http.Header, now time.Time) (delay time.Duration, ok bool) {
+	value := strings.TrimSpace(header.Get("Retry-After"))
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			seconds = 0
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		delay = date.Sub(now)
+		if delay < 0 {
+			delay = 0
+		}
+		return delay, true
+	}
+
+	return 0, false
+}
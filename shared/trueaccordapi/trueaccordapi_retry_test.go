@@ -0,0 +1,216 @@
+package trueaccordapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+)
+
+// sequenceResponder ... answers each call with the next responder, repeating the last one
+func sequenceResponder(responders ...httpmock.Responder) httpmock.Responder {
+	calls := 0
+	return func(req *http.Request) (*http.Response, error) {
+		responder := responders[len(responders)-1]
+		if calls < len(responders) {
+			responder = responders[calls]
+		}
+		calls++
+		return responder(req)
+	}
+}
+
+// newRetryTestConnector ... returns a connector that records backoff delays instead of sleeping
+func newRetryTestConnector(policy RetryPolicy, delays *[]time.Duration) TrueAccordAPIConnector {
+	return NewTrueAccordAPIConnector(WithBaseURL(testAPIURL), WithRetryPolicy(policy), func(ta *trueAccordAPIConnector) {
+		ta.sleep = func(ctx context.Context, d time.Duration) error {
+			*delays = append(*delays, d)
+			return nil
+		}
+		ta.random = func(n int64) int64 {
+			return n - 1
+		}
+	})
+}
+
+func TestGetDebtsSuccessAfterRetries(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	var delays []time.Duration
+	connector := newRetryTestConnector(RetryPolicy{MaxAttempts: 4, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}, &delays)
+
+	httpmock.RegisterResponder("GET", fmt.Sprintf("%s/%s", testAPIURL, getDebts), sequenceResponder(
+		httpmock.NewStringResponder(502, ""),
+		httpmock.NewErrorResponder(errors.New("connection reset by peer")),
+		httpmock.NewStringResponder(200, `[{"amount": 100, "id": 1}]`),
+	))
+
+	res, err := connector.GetDebts(context.Background())
+	assert.Nil(t, err, "GetDebts should succeed after retrying")
+	assert.Equal(t, 1, len(res))
+	assert.Equal(t, 3, httpmock.GetTotalCallCount())
+	assert.Equal(t, []time.Duration{100 * time.Millisecond, 200 * time.Millisecond}, delays)
+}
+
+func TestGetDebtsFailureRetriesExhausted(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	var delays []time.Duration
+	connector := newRetryTestConnector(RetryPolicy{MaxAttempts: 3, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}, &delays)
+
+	httpmock.RegisterResponder("GET", fmt.Sprintf("%s/%s", testAPIURL, getDebts),
+		httpmock.NewStringResponder(503, "unavailable"))
+
+	_, err := connector.GetDebts(context.Background())
+	assert.NotNil(t, err, "GetDebts should fail once retries are exhausted")
+	assert.Equal(t, 3, err.Attempts)
+	assert.Equal(t, 3, httpmock.GetTotalCallCount())
+	assert.Equal(t, 2, len(delays))
+}
+
+func TestGetDebtsFailureNetworkErrorRecordsAttempts(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	var delays []time.Duration
+	connector := newRetryTestConnector(RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond}, &delays)
+
+	httpmock.RegisterResponder("GET", fmt.Sprintf("%s/%s", testAPIURL, getDebts),
+		httpmock.NewErrorResponder(errors.New("connection reset by peer")))
+
+	_, err := connector.GetDebts(context.Background())
+	assert.NotNil(t, err)
+	assert.Equal(t, 2, err.Attempts)
+	assert.Equal(t, "Failed to send GET debts request", err.InternalErrorMessage)
+}
+
+func TestGetDebtsFailureNoRetryOnClientError(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	var delays []time.Duration
+	connector := newRetryTestConnector(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}, &delays)
+
+	httpmock.RegisterResponder("GET", fmt.Sprintf("%s/%s", testAPIURL, getDebts),
+		httpmock.NewStringResponder(404, ""))
+
+	_, err := connector.GetDebts(context.Background())
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, err.Attempts)
+	assert.Equal(t, 1, httpmock.GetTotalCallCount())
+}
+
+func TestGetDebtsSuccessHonorsRetryAfter(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	var delays []time.Duration
+	connector := newRetryTestConnector(RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond, MaxDelay: time.Second}, &delays)
+
+	tooManyRequests := httpmock.NewStringResponse(429, "")
+	tooManyRequests.Header.Set("Retry-After", "7")
+
+	httpmock.RegisterResponder("GET", fmt.Sprintf("%s/%s", testAPIURL, getDebts), sequenceResponder(
+		httpmock.ResponderFromResponse(tooManyRequests),
+		httpmock.NewStringResponder(200, `[]`),
+	))
+
+	_, err := connector.GetDebts(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, []time.Duration{7 * time.Second}, delays)
+}
+
+func TestBackoffSuccess(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 10, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	maxJitter := func(n int64) int64 { return n - 1 }
+	noJitter := func(n int64) int64 { return 0 }
+
+	assert.Equal(t, 100*time.Millisecond, policy.backoff(1, maxJitter))
+	assert.Equal(t, 400*time.Millisecond, policy.backoff(3, maxJitter))
+	assert.Equal(t, time.Second, policy.backoff(8, maxJitter))
+	assert.Equal(t, 500*time.Millisecond, policy.backoff(8, noJitter))
+}
+
+func TestRetryAfterSuccess(t *testing.T) {
+	now := time.Date(2020, 10, 30, 12, 0, 0, 0, time.UTC)
+
+	header := http.Header{}
+	_, ok := retryAfter(header, now)
+	assert.False(t, ok)
+
+	header.Set("Retry-After", "3")
+	delay, ok := retryAfter(header, now)
+	assert.True(t, ok)
+	assert.Equal(t, 3*time.Second, delay)
+
+	header.Set("Retry-After", now.Add(90*time.Second).Format(http.TimeFormat))
+	delay, ok = retryAfter(header, now)
+	assert.True(t, ok)
+	assert.Equal(t, 90*time.Second, delay)
+
+	header.Set("Retry-After", "soon")
+	_, ok = retryAfter(header, now)
+	assert.False(t, ok)
+}
+
+func TestGetDebtsFailureContextCancelledDuringBackoff(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	connector := NewTrueAccordAPIConnector(WithBaseURL(testAPIURL), WithRetryPolicy(RetryPolicy{MaxAttempts: 5, BaseDelay: time.Hour}), func(ta *trueAccordAPIConnector) {
+		ta.sleep = func(ctx context.Context, d time.Duration) error {
+			cancel()
+			return sleepContext(ctx, d)
+		}
+	})
+
+	httpmock.RegisterResponder("GET", fmt.Sprintf("%s/%s", testAPIURL, getDebts),
+		httpmock.NewStringResponder(503, ""))
+
+	_, err := connector.GetDebts(ctx)
+	assert.NotNil(t, err)
+	assert.Equal(t, context.Canceled, err.ErrorMessage)
+	assert.Equal(t, 1, err.Attempts)
+	assert.Equal(t, 1, httpmock.GetTotalCallCount())
+}
+
+func TestGetDebtsFailureContextAlreadyCancelled(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	httpmock.RegisterResponder("GET", fmt.Sprintf("%s/%s", testAPIURL, getDebts),
+		httpmock.NewStringResponder(200, `[]`))
+
+	_, err := trueAccordTestAPIConnector.GetDebts(ctx)
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, err.Attempts)
+}
+
+func TestSleepContextSuccess(t *testing.T) {
+	assert.Nil(t, sleepContext(context.Background(), time.Millisecond))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, sleepContext(ctx, time.Hour))
+}
+
+func TestWithTimeoutSuccessDoesNotModifySharedClient(t *testing.T) {
+	client := NewHTTPClient(16, time.Minute)
+
+	connector := NewTrueAccordAPIConnector(WithBaseURL(testAPIURL), WithHTTPClient(client), WithTimeout(time.Second)).(*trueAccordAPIConnector)
+
+	assert.Equal(t, time.Second, connector.client.Timeout)
+	assert.Equal(t, time.Minute, client.Timeout)
+	assert.Equal(t, client.Transport, connector.client.Transport)
+}
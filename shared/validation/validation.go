@@ -0,0 +1,324 @@
+package validation
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"true_accord/shared/interest"
+	"true_accord/shared/money"
+	"true_accord/shared/schedule"
+	"true_accord/shared/trueaccordapi"
+)
+
+// Finding severities
+const (
+	// SeverityError ... marks data the enrichment can't process correctly
+	SeverityError = "ERROR"
+	// SeverityWarning ... marks data the enrichment processes, but that is likely wrong
+	SeverityWarning = "WARNING"
+)
+
+// Checks
+const (
+	CheckPlanExceedsDebt  = "PLAN_EXCEEDS_DEBT"
+	CheckMultiplePlans    = "MULTIPLE_PLANS"
+	CheckPlanWithoutDebt  = "PLAN_WITHOUT_DEBT"
+	CheckOrphanedPayment  = "ORPHANED_PAYMENT"
+	CheckInvalidDate      = "INVALID_DATE"
+	CheckZeroInstallment  = "ZERO_INSTALLMENTS"
+	CheckUnknownFrequency = "UNKNOWN_FREQUENCY"
+	CheckPaymentEarly     = "PAYMENT_BEFORE_START"
+	CheckOverpayment      = "OVERPAYMENT"
+	CheckInterestTerms    = "INVALID_INTEREST_TERMS"
+)
+
+// Checks ... lists every check, in the order they are documented
+var Checks = []string{
+	CheckPlanExceedsDebt,
+	CheckMultiplePlans,
+	CheckPlanWithoutDebt,
+	CheckOrphanedPayment,
+	CheckPaymentEarly,
+	CheckOverpayment,
+	CheckZeroInstallment,
+	CheckUnknownFrequency,
+	CheckInvalidDate,
+	CheckInterestTerms,
+}
+
+// Finding ... is one data-quality problem, with the IDs of the entities involved
+type Finding struct {
+	Severity      string `json:"severity"`
+	Check         string `json:"check"`
+	DebtID        *int64 `json:"debt_id,omitempty"`
+	PaymentPlanID *int64 `json:"payment_plan_id,omitempty"`
+	// PaymentIndex is the position of the payment in the /payments response, as payments have no ID
+	PaymentIndex *int   `json:"payment_index,omitempty"`
+	Message      string `json:"message"`
+}
+
+// Counts ... is the number of entities validated
+type Counts struct {
+	Debts        int `json:"debts"`
+	PaymentPlans int `json:"payment_plans"`
+	Payments     int `json:"payments"`
+}
+
+// Report ... is the findings of a validation run with totals by severity and check
+type Report struct {
+	Checked  Counts         `json:"checked"`
+	Errors   int            `json:"errors"`
+	Warnings int            `json:"warnings"`
+	ByCheck  map[string]int `json:"by_check"`
+	Findings []Finding      `json:"findings"`
+}
+
+// NewReport ... returns the report of findings over checked entities, counting every check
+func NewReport(checked Counts, findings []Finding) Report {
+	report := Report{
+		Checked:  checked,
+		ByCheck:  make(map[string]int),
+		Findings: findings,
+	}
+	if report.Findings == nil {
+		report.Findings = []Finding{}
+	}
+
+	for _, check := range Checks {
+		report.ByCheck[check] = 0
+	}
+
+	for _, finding := range findings {
+		report.ByCheck[finding.Check]++
+		if finding.Severity == SeverityError {
+			report.Errors++
+		} else {
+			report.Warnings++
+		}
+	}
+
+	return report
+}
+
+// HasErrors ... returns whether any finding has error severity
+func HasErrors(findings []Finding) bool {
+	for _, finding := range findings {
+		if finding.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate ... checks debts, payment plans and payments for consistency with each other and returns the findings
+// ordered by debt ID, payment plan ID and payment index
+func Validate(debts []trueaccordapi.Debt, paymentPlans []trueaccordapi.PaymentPlan, payments []trueaccordapi.Payment) (findings []Finding) {
+	debtsByID := make(map[int64]trueaccordapi.Debt)
+	for _, debt := range debts {
+		debtsByID[debt.ID] = debt
+	}
+
+	plansByID := make(map[int64]trueaccordapi.PaymentPlan)
+	plansByDebtID := make(map[int64][]trueaccordapi.PaymentPlan)
+	for _, paymentPlan := range paymentPlans {
+		plansByID[paymentPlan.ID] = paymentPlan
+		plansByDebtID[paymentPlan.DebtID] = append(plansByDebtID[paymentPlan.DebtID], paymentPlan)
+	}
+
+	for _, debt := range debts {
+		findings = append(findings, validateDebt(debt)...)
+	}
+
+	for _, paymentPlan := range paymentPlans {
+		findings = append(findings, validatePaymentPlan(paymentPlan, debtsByID)...)
+	}
+
+	for debtID, debtPlans := range plansByDebtID {
+		if len(debtPlans) > 1 {
+			findings = append(findings, Finding{
+				Severity: SeverityWarning,
+				Check:    CheckMultiplePlans,
+				DebtID:   int64Ptr(debtID),
+				Message:  fmt.Sprintf("Debt has %d payment plans", len(debtPlans)),
+			})
+		}
+	}
+
+	paidByPlanID := make(map[int64]money.Money)
+	for i, payment := range payments {
+		findings = append(findings, validatePayment(i, payment, plansByID)...)
+		paidByPlanID[payment.PaymentPlanID] += payment.Amount
+	}
+
+	for _, paymentPlan := range paymentPlans {
+		if paid := paidByPlanID[paymentPlan.ID]; paid > paymentPlan.AmountToPay {
+			findings = append(findings, Finding{
+				Severity:      SeverityWarning,
+				Check:         CheckOverpayment,
+				DebtID:        int64Ptr(paymentPlan.DebtID),
+				PaymentPlanID: int64Ptr(paymentPlan.ID),
+				Message:       fmt.Sprintf("Payments total %s, more than amount_to_pay %s", paid, paymentPlan.AmountToPay),
+			})
+		}
+	}
+
+	sortFindings(findings)
+	return findings
+}
+
+// validateDebt ... checks the interest terms of a debt
+func validateDebt(debt trueaccordapi.Debt) (findings []Finding) {
+	newFinding := func(message string) Finding {
+		return Finding{
+			Severity: SeverityError,
+			Check:    CheckInterestTerms,
+			DebtID:   int64Ptr(debt.ID),
+			Message:  message,
+		}
+	}
+
+	if debt.APR < 0 {
+		findings = append(findings, newFinding(fmt.Sprintf("apr %v is negative", debt.APR)))
+	}
+	if debt.APR == 0 {
+		return
+	}
+
+	if _, err := time.Parse(schedule.DateLayout, debt.AccrualStartDate); err != nil {
+		findings = append(findings, newFinding(fmt.Sprintf("accrual_start_date %q is not a YYYY-MM-DD date", debt.AccrualStartDate)))
+	}
+	if debt.DayCount != "" && !interest.IsDayCount(debt.DayCount) {
+		findings = append(findings, newFinding(fmt.Sprintf("day_count %q is not one of %s", debt.DayCount, strings.Join(interest.DayCounts, ", "))))
+	}
+
+	return
+}
+
+// validatePaymentPlan ... checks a payment plan against its debt
+func validatePaymentPlan(paymentPlan trueaccordapi.PaymentPlan, debtsByID map[int64]trueaccordapi.Debt) (findings []Finding) {
+	newFinding := func(severity, check, message string) Finding {
+		return Finding{
+			Severity:      severity,
+			Check:         check,
+			DebtID:        int64Ptr(paymentPlan.DebtID),
+			PaymentPlanID: int64Ptr(paymentPlan.ID),
+			Message:       message,
+		}
+	}
+
+	if _, err := time.Parse(schedule.DateLayout, paymentPlan.StartDate); err != nil {
+		findings = append(findings, newFinding(SeverityError, CheckInvalidDate,
+			fmt.Sprintf("start_date %q is not a YYYY-MM-DD date", paymentPlan.StartDate)))
+	}
+
+	if paymentPlan.AmountToPay <= money.Zero || paymentPlan.InstallmentAmount <= money.Zero {
+		findings = append(findings, newFinding(SeverityError, CheckZeroInstallment,
+			fmt.Sprintf("amount_to_pay %s and installment_amount %s give no installments to schedule", paymentPlan.AmountToPay, paymentPlan.InstallmentAmount)))
+	}
+
+	if _, err := schedule.Lookup(paymentPlan.InstallmentFrequency); err != nil {
+		findings = append(findings, newFinding(SeverityError, CheckUnknownFrequency,
+			fmt.Sprintf("installment_frequency %q has no schedule", paymentPlan.InstallmentFrequency)))
+	}
+
+	debt, found := debtsByID[paymentPlan.DebtID]
+	if !found {
+		findings = append(findings, newFinding(SeverityError, CheckPlanWithoutDebt, "Payment plan references a debt that doesn't exist"))
+		return
+	}
+
+	if paymentPlan.AmountToPay > debt.Amount {
+		findings = append(findings, newFinding(SeverityWarning, CheckPlanExceedsDebt,
+			fmt.Sprintf("amount_to_pay %s exceeds the debt amount %s", paymentPlan.AmountToPay, debt.Amount)))
+	}
+
+	return
+}
+
+// validatePayment ... checks the payment at index i against its payment plan
+func validatePayment(i int, payment trueaccordapi.Payment, plansByID map[int64]trueaccordapi.PaymentPlan) (findings []Finding) {
+	newFinding := func(severity, check, message string) Finding {
+		finding := Finding{
+			Severity:      severity,
+			Check:         check,
+			PaymentPlanID: int64Ptr(payment.PaymentPlanID),
+			PaymentIndex:  intPtr(i),
+			Message:       message,
+		}
+		if paymentPlan, found := plansByID[payment.PaymentPlanID]; found {
+			finding.DebtID = int64Ptr(paymentPlan.DebtID)
+		}
+		return finding
+	}
+
+	paymentDate, dateErr := time.Parse(schedule.DateLayout, payment.Date)
+	if dateErr != nil {
+		findings = append(findings, newFinding(SeverityError, CheckInvalidDate,
+			fmt.Sprintf("date %q is not a YYYY-MM-DD date", payment.Date)))
+	}
+
+	paymentPlan, found := plansByID[payment.PaymentPlanID]
+	if !found {
+		findings = append(findings, newFinding(SeverityError, CheckOrphanedPayment,
+			"Payment references a payment plan that doesn't exist, so it can't be linked to a debt"))
+		return
+	}
+
+	startDate, startErr := time.Parse(schedule.DateLayout, paymentPlan.StartDate)
+	if dateErr == nil && startErr == nil && paymentDate.Before(startDate) {
+		findings = append(findings, newFinding(SeverityWarning, CheckPaymentEarly,
+			fmt.Sprintf("Payment dated %s is before the payment plan start_date %s", payment.Date, paymentPlan.StartDate)))
+	}
+
+	return
+}
+
+// sortFindings ... orders findings by debt ID, payment plan ID, payment index and check, with missing IDs first
+func sortFindings(findings []Finding) {
+	sort.SliceStable(findings, func(i, j int) bool {
+		a, b := findings[i], findings[j]
+		if c := compareInt64Ptr(a.DebtID, b.DebtID); c != 0 {
+			return c < 0
+		}
+		if c := compareInt64Ptr(a.PaymentPlanID, b.PaymentPlanID); c != 0 {
+			return c < 0
+		}
+		if c := compareInt64Ptr(intToInt64Ptr(a.PaymentIndex), intToInt64Ptr(b.PaymentIndex)); c != 0 {
+			return c < 0
+		}
+		return a.Check < b.Check
+	})
+}
+
+func compareInt64Ptr(a, b *int64) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	case *a < *b:
+		return -1
+	case *a > *b:
+		return 1
+	}
+	return 0
+}
+
+func int64Ptr(v int64) *int64 {
+	return &v
+}
+
+func intPtr(v int) *int {
+	return &v
+}
+
+func intToInt64Ptr(v *int) *int64 {
+	if v == nil {
+		return nil
+	}
+	return int64Ptr(int64(*v))
+}
@@ -0,0 +1,158 @@
+package validation
+
+import (
+	"testing"
+
+	"true_accord/shared/money"
+	"true_accord/shared/trueaccordapi"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateSuccessConsistentData(t *testing.T) {
+	debts := []trueaccordapi.Debt{{ID: 0, Amount: money.MustParse("100")}}
+	paymentPlans := []trueaccordapi.PaymentPlan{{ID: 0, DebtID: 0, AmountToPay: money.MustParse("100"), InstallmentFrequency: "WEEKLY", InstallmentAmount: money.MustParse("25"), StartDate: "2020-10-01"}}
+	payments := []trueaccordapi.Payment{{Amount: money.MustParse("25"), Date: "2020-10-01", PaymentPlanID: 0}}
+
+	findings := Validate(debts, paymentPlans, payments)
+
+	assert.Empty(t, findings)
+	assert.False(t, HasErrors(findings))
+}
+
+func TestValidateSuccessFindings(t *testing.T) {
+	debts := []trueaccordapi.Debt{
+		{ID: 0, Amount: money.MustParse("100")},
+		{ID: 1, Amount: money.MustParse("50")},
+	}
+	paymentPlans := []trueaccordapi.PaymentPlan{
+		{ID: 0, DebtID: 0, AmountToPay: money.MustParse("100"), InstallmentFrequency: "WEEKLY", InstallmentAmount: money.MustParse("25"), StartDate: "2020-10-01"},
+		{ID: 1, DebtID: 0, AmountToPay: money.MustParse("80"), InstallmentFrequency: "WEEKLY", InstallmentAmount: money.MustParse("25"), StartDate: "10/01/2020"},
+		{ID: 2, DebtID: 1, AmountToPay: money.MustParse("60"), InstallmentFrequency: "WEEKLY", InstallmentAmount: money.MustParse("25"), StartDate: "2020-10-01"},
+		{ID: 3, DebtID: 9, AmountToPay: money.MustParse("10"), InstallmentFrequency: "WEEKLY", InstallmentAmount: money.MustParse("25"), StartDate: "2020-10-01"},
+	}
+	payments := []trueaccordapi.Payment{
+		{Amount: money.MustParse("25"), Date: "2020-10-01", PaymentPlanID: 0},
+		{Amount: money.MustParse("25"), Date: "2020-10-01", PaymentPlanID: 7},
+		{Amount: money.MustParse("25"), Date: "Oct 1 2020", PaymentPlanID: 2},
+	}
+
+	findings := Validate(debts, paymentPlans, payments)
+
+	var checks []string
+	for _, finding := range findings {
+		checks = append(checks, finding.Check)
+	}
+
+	assert.Equal(t, []string{
+		CheckOrphanedPayment, // payment 1, plan 7 has no debt
+		CheckMultiplePlans,   // debt 0
+		CheckInvalidDate,     // debt 0, plan 1 start date
+		CheckPlanExceedsDebt, // debt 1, plan 2
+		CheckInvalidDate,     // debt 1, plan 2, payment 2
+		CheckPlanWithoutDebt, // debt 9, plan 3
+	}, checks)
+	assert.True(t, HasErrors(findings))
+
+	assert.Nil(t, findings[0].DebtID)
+	assert.Equal(t, int64(7), *findings[0].PaymentPlanID)
+	assert.Equal(t, 1, *findings[0].PaymentIndex)
+
+	assert.Equal(t, SeverityWarning, findings[3].Severity)
+	assert.Equal(t, "amount_to_pay 60.00 exceeds the debt amount 50.00", findings[3].Message)
+	assert.Equal(t, int64(1), *findings[4].DebtID)
+	assert.Equal(t, 2, *findings[4].PaymentIndex)
+}
+
+func TestValidateSuccessPaymentFindings(t *testing.T) {
+	debts := []trueaccordapi.Debt{
+		{ID: 0, Amount: money.MustParse("100")},
+		{ID: 1, Amount: money.MustParse("100")},
+	}
+	paymentPlans := []trueaccordapi.PaymentPlan{
+		{ID: 0, DebtID: 0, AmountToPay: money.MustParse("50"), InstallmentFrequency: "WEEKLY", InstallmentAmount: money.MustParse("25"), StartDate: "2020-10-01"},
+		{ID: 1, DebtID: 1, AmountToPay: money.MustParse("100"), InstallmentFrequency: "WEEKLY", InstallmentAmount: money.Zero, StartDate: "2020-10-01"},
+	}
+	payments := []trueaccordapi.Payment{
+		{Amount: money.MustParse("25"), Date: "2020-09-30", PaymentPlanID: 0},
+		{Amount: money.MustParse("30"), Date: "2020-10-08", PaymentPlanID: 0},
+	}
+
+	findings := Validate(debts, paymentPlans, payments)
+
+	var checks []string
+	for _, finding := range findings {
+		checks = append(checks, finding.Check)
+	}
+
+	assert.Equal(t, []string{
+		CheckOverpayment,     // debt 0, plan 0: 55.00 paid of 50.00
+		CheckPaymentEarly,    // debt 0, plan 0, payment 0
+		CheckZeroInstallment, // debt 1, plan 1
+	}, checks)
+	assert.Equal(t, "Payments total 55.00, more than amount_to_pay 50.00", findings[0].Message)
+	assert.Equal(t, int64(0), *findings[1].DebtID)
+	assert.Equal(t, 0, *findings[1].PaymentIndex)
+	assert.Equal(t, SeverityError, findings[2].Severity)
+}
+
+func TestValidateSuccessInterestTermFindings(t *testing.T) {
+	debts := []trueaccordapi.Debt{
+		{ID: 0, Amount: money.MustParse("100"), APR: 0.18, AccrualStartDate: "2020-01-01", DayCount: "act/365"},
+		{ID: 1, Amount: money.MustParse("100"), APR: 0.18, AccrualStartDate: "01/01/2020", DayCount: "ACT/360"},
+		{ID: 2, Amount: money.MustParse("100"), APR: -0.05, AccrualStartDate: "2020-01-01"},
+		{ID: 3, Amount: money.MustParse("100"), DayCount: "ACT/360"},
+	}
+
+	findings := Validate(debts, nil, nil)
+
+	assert.Equal(t, 3, len(findings), "Terms without an APR accrue nothing and aren't checked")
+	for _, finding := range findings {
+		assert.Equal(t, CheckInterestTerms, finding.Check)
+		assert.Equal(t, SeverityError, finding.Severity)
+	}
+	assert.Equal(t, `accrual_start_date "01/01/2020" is not a YYYY-MM-DD date`, findings[0].Message)
+	assert.Equal(t, `day_count "ACT/360" is not one of ACT/365, 30/360`, findings[1].Message)
+	assert.Equal(t, "apr -0.05 is negative", findings[2].Message)
+	assert.Equal(t, int64(2), *findings[2].DebtID)
+}
+
+func TestValidateSuccessUnknownFrequencyFindings(t *testing.T) {
+	debts := []trueaccordapi.Debt{{ID: 0, Amount: money.MustParse("100")}}
+	paymentPlans := []trueaccordapi.PaymentPlan{
+		{ID: 0, DebtID: 0, AmountToPay: money.MustParse("100"), InstallmentFrequency: "every_10_days", InstallmentAmount: money.MustParse("25"), StartDate: "2020-10-01"},
+		{ID: 1, DebtID: 0, AmountToPay: money.MustParse("100"), InstallmentFrequency: "YEARLY", InstallmentAmount: money.MustParse("25"), StartDate: "2020-10-01"},
+		{ID: 2, DebtID: 0, AmountToPay: money.MustParse("100"), InstallmentAmount: money.MustParse("25"), StartDate: "2020-10-01"},
+	}
+
+	var unknown []Finding
+	for _, finding := range Validate(debts, paymentPlans, nil) {
+		if finding.Check == CheckUnknownFrequency {
+			unknown = append(unknown, finding)
+		}
+	}
+
+	assert.Equal(t, 2, len(unknown), "Custom EVERY_<N>_DAYS frequencies are known")
+	assert.Equal(t, SeverityError, unknown[0].Severity)
+	assert.Equal(t, int64(1), *unknown[0].PaymentPlanID)
+	assert.Equal(t, `installment_frequency "YEARLY" has no schedule`, unknown[0].Message)
+	assert.Equal(t, `installment_frequency "" has no schedule`, unknown[1].Message)
+}
+
+func TestNewReportSuccess(t *testing.T) {
+	findings := []Finding{
+		{Severity: SeverityError, Check: CheckOrphanedPayment},
+		{Severity: SeverityWarning, Check: CheckOverpayment},
+		{Severity: SeverityWarning, Check: CheckOverpayment},
+	}
+
+	report := NewReport(Counts{Debts: 2, PaymentPlans: 1, Payments: 3}, findings)
+
+	assert.Equal(t, 1, report.Errors)
+	assert.Equal(t, 2, report.Warnings)
+	assert.Equal(t, 2, report.ByCheck[CheckOverpayment])
+	assert.Equal(t, 0, report.ByCheck[CheckInvalidDate])
+	assert.Equal(t, len(Checks), len(report.ByCheck))
+
+	assert.Equal(t, []Finding{}, NewReport(Counts{}, nil).Findings, "An empty report lists no findings rather than null")
+}
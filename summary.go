@@ -0,0 +1,131 @@
+package main
+
+import (
+	"time"
+
+	"true_accord/shared/money"
+	"true_accord/shared/output"
+	"true_accord/shared/reconciliation"
+)
+
+// AgeingBucket ... is the number of payment plans in an ageing bucket and how much they have past due
+type AgeingBucket struct {
+	Debts         int         `json:"debts"`
+	AmountPastDue money.Money `json:"amount_past_due"`
+}
+
+// Ageing ... is the payment plans grouped by how many days their oldest unpaid installment is past due
+type Ageing struct {
+	Current    AgeingBucket `json:"current"`
+	Days1To30  AgeingBucket `json:"1_30_days"`
+	Days31To60 AgeingBucket `json:"31_60_days"`
+	Days61To90 AgeingBucket `json:"61_90_days"`
+	Over90     AgeingBucket `json:"over_90_days"`
+}
+
+// bucket ... returns the ageing bucket of a payment plan daysPastDue days past due
+func (a *Ageing) bucket(daysPastDue int) *AgeingBucket {
+	switch {
+	case daysPastDue <= 0:
+		return &a.Current
+	case daysPastDue <= 30:
+		return &a.Days1To30
+	case daysPastDue <= 60:
+		return &a.Days31To60
+	case daysPastDue <= 90:
+		return &a.Days61To90
+	default:
+		return &a.Over90
+	}
+}
+
+// Summary ... is the portfolio totals over enriched debts
+type Summary struct {
+	Debts              int            `json:"debts"`
+	TotalDebt          money.Money    `json:"total_debt"`
+	TotalOutstanding   money.Money    `json:"total_outstanding"`
+	InPaymentPlan      int            `json:"in_payment_plan"`
+	TotalInPaymentPlan money.Money    `json:"total_in_payment_plan"`
+	CollectedToDate    money.Money    `json:"collected_to_date"`
+	DueNext7Days       money.Money    `json:"due_next_7_days"`
+	DueNext30Days      money.Money    `json:"due_next_30_days"`
+	AmountPastDue      money.Money    `json:"amount_past_due"`
+	ByFrequency        map[string]int `json:"by_frequency"`
+	ByStatus           map[string]int `json:"by_status"`
+	Ageing             Ageing         `json:"ageing"`
+}
+
+// SummaryMetric ... is one summary total, the row written for the csv, tsv and table formats
+type SummaryMetric struct {
+	Metric string `json:"metric"`
+	Value  string `json:"value"`
+}
+
+// newSummary ... returns an empty summary counting every delinquency status
+func newSummary() *Summary {
+	s := &Summary{ByFrequency: make(map[string]int), ByStatus: make(map[string]int)}
+	for _, status := range reconciliation.Statuses {
+		s.ByStatus[status] = 0
+	}
+	return s
+}
+
+// add ... adds an enriched debt to the totals. Debts whose payment plan couldn't be scheduled are counted under
+// FAILED and left out of the ageing.
+func (s *Summary) add(res EnrichedDebt) {
+	s.Debts++
+	s.TotalDebt += res.Amount
+	s.TotalOutstanding += res.RemainingDebt
+	s.AmountPastDue += res.AmountPastDue
+	s.ByStatus[res.Status]++
+
+	if !res.HasPaymentPlan {
+		return
+	}
+
+	s.InPaymentPlan++
+	s.TotalInPaymentPlan += res.RemainingOnPlan
+	s.CollectedToDate += res.TotalPaid
+
+	if res.paymentPlan != nil {
+		s.ByFrequency[res.paymentPlan.InstallmentFrequency]++
+	}
+
+	// A plan that couldn't be scheduled has no installments to age or to come due
+	if res.Status == reconciliation.StatusFailed {
+		return
+	}
+
+	bucket := s.Ageing.bucket(res.DaysPastDue)
+	bucket.Debts++
+	bucket.AmountPastDue += res.AmountPastDue
+
+	// Compare calendar dates, since installments are due at midnight in their plan's time zone
+	today := reconciliation.UTCDate(nowIn(defaultLocation()))
+	s.DueNext7Days += amountDueBefore(res.installments, today, today.AddDate(0, 0, 7))
+	s.DueNext30Days += amountDueBefore(res.installments, today, today.AddDate(0, 0, 30))
+}
+
+// amountDueBefore ... returns the unpaid amount of the installments due on or after from and before to, comparing
+// the calendar date of each due date in its own time zone to the UTC dates from and to
+func amountDueBefore(installments []reconciliation.InstallmentStatus, from, to time.Time) (due money.Money) {
+	for _, installment := range installments {
+		dueDate := reconciliation.UTCDate(installment.DueDate)
+		if dueDate.Before(from) || !dueDate.Before(to) {
+			continue
+		}
+		due += installment.AmountDue - installment.AmountPaid
+	}
+	return
+}
+
+// metrics ... returns the summary as one metric per total, nested totals named parent.key
+func (s *Summary) metrics() []SummaryMetric {
+	header, row := output.Flatten(s)
+
+	metrics := make([]SummaryMetric, len(header))
+	for i := range header {
+		metrics[i] = SummaryMetric{Metric: header[i], Value: row[i]}
+	}
+	return metrics
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"true_accord/shared/clock"
+	"true_accord/shared/config"
+	"true_accord/shared/money"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func summarize(t *testing.T, count int) *Summary {
+	trueAccordAPIConnector = newTestPortfolio(count)
+
+	summary := newSummary()
+	err := enrichDebts(context.Background(), trueAccordAPIConnector.(*fakeConnector).debts, 1, func(done, total int) {}, summary.add)
+
+	assert.Nil(t, err)
+	return summary
+}
+
+func TestSummarySuccessUpcoming(t *testing.T) {
+	enrichmentClock = clock.NewFixedClock(time.Date(2020, 10, 5, 9, 0, 0, 0, time.UTC))
+	defer func() {
+		enrichmentClock = clock.NewFixedClock(testNow)
+	}()
+
+	summary := summarize(t, 4)
+
+	assert.Equal(t, 4, summary.Debts)
+	assert.Equal(t, money.MustParse("350.04"), summary.TotalOutstanding)
+	assert.Equal(t, 2, summary.InPaymentPlan)
+	assert.Equal(t, money.MustParse("150"), summary.TotalInPaymentPlan)
+	assert.Equal(t, money.MustParse("50"), summary.CollectedToDate)
+	assert.Equal(t, money.MustParse("50"), summary.DueNext7Days, "Only the installments due on 2020-10-08")
+	assert.Equal(t, money.MustParse("150"), summary.DueNext30Days)
+	assert.Equal(t, map[string]int{"WEEKLY": 2}, summary.ByFrequency)
+	assert.Equal(t, 2, summary.ByStatus["CURRENT"])
+	assert.Equal(t, AgeingBucket{Debts: 2}, summary.Ageing.Current)
+}
+
+func TestSummarySuccessAgeing(t *testing.T) {
+	summary := summarize(t, 4)
+
+	assert.Equal(t, money.Zero, summary.DueNext7Days, "Every installment is already past due")
+	assert.Equal(t, money.MustParse("150"), summary.AmountPastDue)
+	assert.Equal(t, 2, summary.ByStatus["LATE"])
+	assert.Equal(t, AgeingBucket{}, summary.Ageing.Current)
+	assert.Equal(t, AgeingBucket{Debts: 2, AmountPastDue: money.MustParse("150")}, summary.Ageing.Days1To30)
+}
+
+func TestSummarySuccessFailedPlan(t *testing.T) {
+	portfolio := newTestPortfolio(4)
+	portfolio.paymentPlans[2][0].InstallmentFrequency = "YEARLY"
+	trueAccordAPIConnector = portfolio
+
+	summary := newSummary()
+	assert.Nil(t, enrichDebts(context.Background(), portfolio.debts, 1, func(done, total int) {}, summary.add))
+
+	assert.Equal(t, 2, summary.InPaymentPlan)
+	assert.Equal(t, money.MustParse("150"), summary.TotalInPaymentPlan)
+	assert.Equal(t, 1, summary.ByStatus["FAILED"])
+	assert.Equal(t, 1, summary.ByStatus["LATE"])
+	assert.NotContains(t, summary.ByStatus, "")
+	assert.Equal(t, AgeingBucket{Debts: 1, AmountPastDue: money.MustParse("75")}, summary.Ageing.Days1To30)
+	assert.Equal(t, AgeingBucket{}, summary.Ageing.Current, "The FAILED plan isn't aged")
+}
+
+func TestSummarySuccessRemainingPolicyDebt(t *testing.T) {
+	defer func(policy string) {
+		appConfig.RemainingPolicy = policy
+	}(appConfig.RemainingPolicy)
+	appConfig.RemainingPolicy = config.RemainingPolicyDebt
+
+	summary := summarize(t, 4)
+
+	assert.Equal(t, money.MustParse("150"), summary.TotalInPaymentPlan, "What is left to pay on the plans, whatever the policy")
+	assert.Equal(t, money.MustParse("350.06"), summary.TotalOutstanding)
+}
+
+func TestAgeingBucketSuccess(t *testing.T) {
+	var ageing Ageing
+
+	assert.Equal(t, &ageing.Current, ageing.bucket(0))
+	assert.Equal(t, &ageing.Days1To30, ageing.bucket(30))
+	assert.Equal(t, &ageing.Days31To60, ageing.bucket(31))
+	assert.Equal(t, &ageing.Days61To90, ageing.bucket(90))
+	assert.Equal(t, &ageing.Over90, ageing.bucket(91))
+}
+
+func TestSummaryMetricsSuccess(t *testing.T) {
+	metrics := summarize(t, 2).metrics()
+
+	assert.Equal(t, SummaryMetric{"debts", "2"}, metrics[0])
+	assert.Contains(t, metrics, SummaryMetric{"by_frequency.WEEKLY", "1"})
+	assert.Contains(t, metrics, SummaryMetric{"ageing.1_30_days.amount_past_due", "75.00"})
+}